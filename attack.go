@@ -117,6 +117,9 @@ func getSee(brd *Board, from, to int, capturedPiece Piece) int {
 		// return SEE_MIN
 	}
 	t = brd.TypeAt(from)
+	if t == KING && brd.occupied[brd.c]&sqMaskOn[to] > 0 {
+		return 0 // castling moves are only generated if legal.
+	}
 	if t == KING { // Only commit to the attack if target piece is undefended.
 		if tempMap&brd.occupied[tempColor] > 0 {
 			return SEE_MIN
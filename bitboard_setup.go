@@ -39,15 +39,11 @@ var oppositeDir = [16]int{SE, SW, NW, NE, SOUTH, WEST, NORTH, EAST, DIR_INVALID}
 
 var rowMasks, columnMasks [8]BB
 
-var castleMasks [16]BB
-
 var pawnIsolatedMasks, pawnSideMasks, pawnDoubledMasks, knightMasks, bishopMasks, rookMasks,
 	queenMasks, kingMasks, sqMaskOn, sqMaskOff [64]BB
 
 var intervening, lineMasks [64][64]BB
 
-var castleQueensideIntervening, castleKingsideIntervening [2]BB
-
 var pawnAttackMasks, pawnPassedMasks, pawnAttackSpans, pawnBackwardSpans, pawnFrontSpans,
 	pawnStopMasks, kingZoneMasks, kingShieldMasks [2][64]BB
 
@@ -239,28 +235,6 @@ func setupPawnStructureMasks() {
 	}
 }
 
-func setupCastleMasks() {
-	castleQueensideIntervening[WHITE] |= (sqMaskOn[B1] | sqMaskOn[C1] | sqMaskOn[D1])
-	castleKingsideIntervening[WHITE] |= (sqMaskOn[F1] | sqMaskOn[G1])
-	castleQueensideIntervening[BLACK] = (castleQueensideIntervening[WHITE] << 56)
-	castleKingsideIntervening[BLACK] = (castleKingsideIntervening[WHITE] << 56)
-
-	for i := uint8(0); i < 16; i++ {
-		if i&C_WQ > 0 {
-			castleMasks[i] |= (sqMaskOn[A1] | sqMaskOn[E1])
-		}
-		if i&C_WK > 0 {
-			castleMasks[i] |= (sqMaskOn[E1] | sqMaskOn[H1])
-		}
-		if i&C_BQ > 0 {
-			castleMasks[i] |= (sqMaskOn[A8] | sqMaskOn[E8])
-		}
-		if i&C_BK > 0 {
-			castleMasks[i] |= (sqMaskOn[E8] | sqMaskOn[H8])
-		}
-	}
-}
-
 func setupMasks() {
 	setupRowMasks() // Create bitboard masks for each row and column.
 	setupColumnMasks()
@@ -273,5 +247,4 @@ func setupMasks() {
 	setupDirections()
 	setupPawnMasks()
 	setupPawnStructureMasks()
-	setupCastleMasks()
 }
@@ -20,19 +20,22 @@ var printMutex sync.Mutex
 // When spawning new goroutines for subtree search, a deep copy of the Board struct will have to be made
 // and passed to the new goroutine.  Keep this struct as small as possible.
 type Board struct {
-	pieces         [2][8]BB  // 1024 bits
-	squares        [64]Piece //  512 bits
-	occupied       [2]BB     //  128 bits
-	hashKey        uint64    //   64 bits
-	worker         *Worker   //   64 bits
-	material       [2]int16  //   32 bits
-	pawnHashKey    uint32    //   32 bits
-	c              uint8     //    8 bits
-	castle         uint8     //    8 bits
-	enpTarget      uint8     //    8 bits
-	halfmoveClock  uint8     //    8 bits
-	endgameCounter uint8     //    8 bits
-	// ...24 bits padding
+	pieces         [2][8]BB     // 1024 bits
+	squares        [64]Piece    //  512 bits
+	occupied       [2]BB        //  128 bits
+	hashKey        uint64       //   64 bits
+	worker         *Worker      //   64 bits
+	nnue           *Accumulator //   64 bits - NNUE hidden layer, or nil when using the classical eval.
+	material       [2][2]int16  //   64 bits - midgame and endgame values, including the PST.
+	pawnHashKey    uint32       //   32 bits
+	c              uint8        //    8 bits
+	castle         uint8        //    8 bits
+	enpTarget      uint8        //    8 bits
+	halfmoveClock  uint8        //    8 bits
+	endgameCounter uint8        //    8 bits
+	castleRooks    [4]uint8     //   32 bits - starting square of the rook for each castling right.
+	fullmoveNumber uint16       //   16 bits
+	// ...8 bits padding
 }
 
 type BoardMemento struct { // memento object used to store board state to unmake later.
@@ -116,6 +119,9 @@ func (brd *Board) Copy() *Board {
 		enpTarget:      brd.enpTarget,
 		halfmoveClock:  brd.halfmoveClock,
 		endgameCounter: brd.endgameCounter,
+		castleRooks:    brd.castleRooks,
+		fullmoveNumber: brd.fullmoveNumber,
+		nnue:           brd.nnue.Copy(),
 	}
 }
 
@@ -127,7 +133,8 @@ func (brd *Board) PrintDetails() {
 	fmt.Printf("hashKey: %x, pawnHashKey: %x\n", brd.hashKey, brd.pawnHashKey)
 	fmt.Printf("castle: %d, enpTarget: %d, halfmoveClock: %d\noccupied:\n", brd.castle, brd.enpTarget, brd.halfmoveClock)
 	for i := 0; i < 2; i++ {
-		fmt.Printf("side: %s, material: %d\n", sideNames[i], brd.material[i])
+		fmt.Printf("side: %s, material: %d (midgame), %d (endgame)\n", sideNames[i],
+			brd.material[i][MIDGAME], brd.material[i][ENDGAME])
 		brd.occupied[i].Print()
 		for pc := 0; pc < 6; pc++ {
 			fmt.Printf("%s\n", pieceNames[pc])
@@ -178,7 +185,9 @@ func (brd *Board) PrintRow(start int, row []Piece) {
 
 func EmptyBoard() *Board {
 	brd := &Board{
-		enpTarget: SQ_INVALID,
+		enpTarget:      SQ_INVALID,
+		castleRooks:    standardCastleRooks,
+		fullmoveNumber: 1,
 	}
 	for sq := 0; sq < 64; sq++ {
 		brd.squares[sq] = EMPTY
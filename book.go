@@ -0,0 +1,156 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Implements opening book support using the Polyglot .bin format:
+// http://hgm.nubati.net/book_format.html
+
+// A Polyglot book is a sequence of 16-byte entries sorted by position key. Each entry stores
+// (in big-endian byte order) the Polyglot hash key of a position, a suggested move, the weight
+// of the move relative to other moves for the same position, and learning data (unused).
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+)
+
+const (
+	BOOK_ENTRY_SIZE   = 16
+	DEFAULT_BOOK_FILE = "book.bin"
+)
+
+type BookEntry struct {
+	key    uint64
+	move   uint16
+	weight uint16
+}
+
+type Book struct {
+	entries []BookEntry
+}
+
+func LoadBook(path string) (*Book, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("The specified book file could not be loaded: %s", path))
+	}
+	if len(data)%BOOK_ENTRY_SIZE != 0 {
+		return nil, errors.New(fmt.Sprintf("The specified book file is not a valid Polyglot book: %s", path))
+	}
+	book := &Book{
+		entries: make([]BookEntry, len(data)/BOOK_ENTRY_SIZE),
+	}
+	for i := range book.entries {
+		entry := data[i*BOOK_ENTRY_SIZE:]
+		book.entries[i] = BookEntry{
+			key:    binary.BigEndian.Uint64(entry[0:8]),
+			move:   binary.BigEndian.Uint16(entry[8:10]),
+			weight: binary.BigEndian.Uint16(entry[10:12]),
+		}
+	}
+	return book, nil
+}
+
+// Probe uses binary search to find the entries stored for the position brd.
+func (b *Book) Probe(brd *Board) []BookEntry {
+	key := polyglotKey(brd)
+	first := sort.Search(len(b.entries), func(i int) bool {
+		return b.entries[i].key >= key
+	})
+	last := first
+	for last < len(b.entries) && b.entries[last].key == key {
+		last++
+	}
+	return b.entries[first:last]
+}
+
+// Move returns a book move for brd, or NO_MOVE if the position isn't in the book. If random is
+// set, moves are chosen at random in proportion to their weight.  Otherwise, the move with the
+// highest weight is chosen.
+func (b *Book) Move(brd *Board, random bool) Move {
+	var candidates []BookEntry
+	var m Move
+	totalWeight := 0
+	for _, entry := range b.Probe(brd) { // ignore any moves that are illegal in the current position.
+		if m = polyglotMove(brd, entry.move); m != NO_MOVE && entry.weight > 0 {
+			candidates = append(candidates, entry)
+			totalWeight += int(entry.weight)
+		}
+	}
+	if len(candidates) == 0 {
+		return NO_MOVE
+	}
+	best := candidates[0]
+	if random {
+		choice := rand.Intn(totalWeight)
+		for _, entry := range candidates {
+			if choice < int(entry.weight) {
+				best = entry
+				break
+			}
+			choice -= int(entry.weight)
+		}
+	} else {
+		for _, entry := range candidates {
+			if entry.weight > best.weight {
+				best = entry
+			}
+		}
+	}
+	return polyglotMove(brd, best.move)
+}
+
+// Polyglot piece kinds are ordered black pawn, white pawn, black knight, white knight, etc.
+func polyglotKey(brd *Board) uint64 {
+	var key uint64
+	var sq int
+	for c := uint8(BLACK); c <= WHITE; c++ {
+		for pc := Piece(PAWN); pc <= KING; pc++ {
+			kind := (int(pc) << 1) + int(c)
+			for b := brd.pieces[c][pc]; b > 0; b.Clear(sq) {
+				sq = lsb(b)
+				key ^= polyglotRandom[(kind<<6)+sq]
+			}
+		}
+	}
+	castleKeys := [4]uint8{C_WK, C_WQ, C_BK, C_BQ}
+	for i, castle := range castleKeys {
+		if brd.castle&castle > 0 {
+			key ^= polyglotRandom[768+i]
+		}
+	}
+	// The en passant file is only hashed if a pawn of the side to move can make the capture.
+	if brd.enpTarget != SQ_INVALID && pawnSideMasks[brd.enpTarget]&brd.pieces[brd.c][PAWN] > 0 {
+		key ^= polyglotRandom[772+column(int(brd.enpTarget))]
+	}
+	if brd.c == WHITE {
+		key ^= polyglotRandom[780]
+	}
+	return key
+}
+
+// Polyglot moves are encoded using 15 bits as follows (in LSB order):
+// To file, to row, from file, from row - 3 bits each
+// Promoted to - 3 bits (none, knight, bishop, rook, queen)
+// Castling is encoded as the king capturing its own rook, as it is in Move.
+func polyglotMove(brd *Board, pm uint16) Move {
+	to := Square(int((pm>>3)&7), int(pm&7))
+	from := Square(int((pm>>9)&7), int((pm>>6)&7))
+	promotedTo := Piece(EMPTY)
+	if promotion := (pm >> 12) & 7; promotion > 0 {
+		promotedTo = Piece(promotion)
+	}
+	for _, m := range perftMoves(brd) { // includes underpromotions to rook and bishop.
+		if m.From() == from && m.To() == to && m.PromotedTo() == promotedTo {
+			return m
+		}
+	}
+	return NO_MOVE
+}
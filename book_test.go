@@ -0,0 +1,91 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Reference keys from the Polyglot book format specification.
+var polyglotTestKeys = []struct {
+	moves string
+	key   uint64
+}{
+	{"", 0x463b96181691fc9c},
+	{"e2e4", 0x823c9b50fd114196},
+	{"e2e4 d7d5", 0x0756b94461c50fb0},
+	{"e2e4 d7d5 e4e5", 0x662fafb965db29d4},
+	{"e2e4 d7d5 e4e5 f7f5", 0x22a48b5a8e47ff78},
+	{"e2e4 d7d5 e4e5 f7f5 e1e2", 0x652a607ca3f242c1},
+	{"e2e4 d7d5 e4e5 f7f5 e1e2 e8f7", 0x00fdd303c946bdd9},
+	{"a2a4 b7b5 h2h4 b5b4 c2c4", 0x3c8123ea7b067637},
+	{"a2a4 b7b5 h2h4 b5b4 c2c4 b4c3 a1a3", 0x5c3f9b829b279560},
+}
+
+func TestPolyglotKey(t *testing.T) {
+	for _, test := range polyglotTestKeys {
+		brd := StartPos()
+		for _, str := range strings.Fields(test.moves) {
+			makeMove(brd, mustParseMove(t, brd, str))
+		}
+		if key := polyglotKey(brd); key != test.key {
+			t.Errorf("Expected key %016x, got %016x after moves: %s", test.key, key, test.moves)
+		}
+	}
+}
+
+func TestBookMove(t *testing.T) {
+	brd := StartPos()
+	var data []byte
+	entry := make([]byte, BOOK_ENTRY_SIZE)
+	for _, e := range []BookEntry{
+		{polyglotKey(brd), uint16(Square(1, 3)<<6 | Square(3, 3)), 10}, // d2d4
+		{polyglotKey(brd), uint16(Square(1, 4)<<6 | Square(3, 4)), 20}, // e2e4
+	} {
+		binary.BigEndian.PutUint64(entry[0:8], e.key)
+		binary.BigEndian.PutUint16(entry[8:10], e.move)
+		binary.BigEndian.PutUint16(entry[10:12], e.weight)
+		data = append(data, entry...)
+	}
+	f, err := ioutil.TempFile("", "book")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(data)
+	f.Close()
+
+	book, err := LoadBook(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := book.Move(brd, false); m.ToUCI() != "e2e4" {
+		t.Errorf("Expected best book move e2e4, got %s", m.ToUCI())
+	}
+	for i := 0; i < 20; i++ {
+		if m := book.Move(brd, true); m == NO_MOVE {
+			t.Errorf("Expected a random book move for the initial position")
+		}
+	}
+	makeMove(brd, book.Move(brd, false))
+	if m := book.Move(brd, true); m != NO_MOVE {
+		t.Errorf("Expected no book move, got %s", m.ToUCI())
+	}
+}
+
+func TestPolyglotUnderpromotion(t *testing.T) {
+	brd := ParseFENString("8/4P3/8/8/8/8/k7/4K3 w - - 0 1")
+	for i, expected := range []string{"e7e8n", "e7e8b", "e7e8r", "e7e8q"} {
+		pm := uint16((i+1)<<12 | Square(6, 4)<<6 | Square(7, 4))
+		if m := polyglotMove(brd, pm); m.ToUCI() != expected {
+			t.Errorf("Expected book move %s, got %s", expected, m.ToUCI())
+		}
+	}
+}
@@ -0,0 +1,96 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Castling
+
+// To support Chess960 (Fischer Random Chess), castling is encoded internally as the king capturing
+// its own rook. The starting square of the rook for each castling right is stored in the board,
+// and the king must be on its starting square for as long as any castling rights remain. After
+// castling, the king and rook always end up on the same squares as in standard chess.
+// https://en.wikipedia.org/wiki/Fischer_random_chess
+
+package main
+
+const (
+	CASTLE_KINGSIDE = iota
+	CASTLE_QUEENSIDE
+)
+
+// When set, castling moves are sent and received in king-takes-rook form (UCI_Chess960).
+// Otherwise, the king's two-square move is used.
+var chess960 = false
+
+// Destination squares indexed by color and castling side.
+var castleKingTo = [2][2]int{{G8, C8}, {G1, C1}}
+var castleRookTo = [2][2]int{{F8, D8}, {F1, D1}}
+
+// Castling rights are stored in brd.castle as bits C_BK, C_BQ, C_WK, C_WQ (LSB order).
+func castleIndex(c uint8, side int) uint8 {
+	return (c << 1) + uint8(side)
+}
+
+func castleRight(c uint8, side int) uint8 {
+	return uint8(1) << castleIndex(c, side)
+}
+
+func castleSide(from, to int) int {
+	if to > from {
+		return CASTLE_KINGSIDE
+	}
+	return CASTLE_QUEENSIDE
+}
+
+// Rook starting squares in standard chess, indexed by castleIndex.
+var standardCastleRooks = [4]uint8{H8, A8, H1, A1}
+
+// IsCastle determines if m castles for the side to move in brd. Only the king can move to a square
+// occupied by a friendly piece.
+func (brd *Board) IsCastle(m Move) bool {
+	return m.Piece() == KING && brd.occupied[brd.c]&sqMaskOn[m.To()] > 0
+}
+
+// castleMove returns the castling move for the side to move on the given side of the board, or
+// NO_MOVE if castling isn't legal. Assumes the side to move isn't in check.
+func (brd *Board) castleMove(side int) Move {
+	c := brd.c
+	i := castleIndex(c, side)
+	if brd.castle&(uint8(1)<<i) == 0 {
+		return NO_MOVE
+	}
+	kingSq, rookSq := brd.KingSq(c), int(brd.castleRooks[i])
+	kingTo, rookTo := castleKingTo[c][side], castleRookTo[c][side]
+	// Squares the king and rook travel over must be empty, apart from the king and rook themselves.
+	occ := brd.AllOccupied() & sqMaskOff[kingSq] & sqMaskOff[rookSq]
+	if (intervening[kingSq][kingTo]|intervening[rookSq][rookTo]|sqMaskOn[kingTo]|sqMaskOn[rookTo])&
+		occ > 0 {
+		return NO_MOVE
+	}
+	// The king may not pass over or land on an attacked square. Since the castling rook is removed
+	// from occ, this also detects attacks revealed by the rook moving away from the king.
+	e := brd.Enemy()
+	if isAttackedBy(brd, occ, kingTo, e, c) {
+		return NO_MOVE
+	}
+	for b := intervening[kingSq][kingTo]; b > 0; b.Clear(lsb(b)) {
+		if isAttackedBy(brd, occ, lsb(b), e, c) {
+			return NO_MOVE
+		}
+	}
+	return NewRegularMove(kingSq, rookSq, KING)
+}
+
+// Castling moves are sent as the king's two-square move unless UCI_Chess960 is enabled. In standard
+// chess, only castling moves the king more than one square along its rank.
+func uciCastleTo(m Move) int {
+	from, to := m.From(), m.To()
+	if chess960 || m.Piece() != KING || row(from) != row(to) || abs(to-from) < 2 {
+		return to
+	}
+	c := uint8(WHITE)
+	if row(from) == 7 {
+		c = BLACK
+	}
+	return castleKingTo[c][castleSide(from, to)]
+}
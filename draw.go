@@ -0,0 +1,103 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Draw Recognition
+
+// Positions where neither side can force mate (KvK, KBvK, KNvK, KNNvK, and any number of bishops
+// all on the same color) are scored as draws by the search. Other endings that are usually drawn
+// despite a material advantage are recognized by the evaluation, which scales its score toward
+// zero: https://chessprogramming.wikispaces.com/Draw+Evaluation
+
+package main
+
+const DARK_SQUARES = BB(0xAA55AA55AA55AA55) // a1 is a dark square.
+
+const (
+	SCALE_NORMAL   = 16 // the evaluation is multiplied by (scale / SCALE_NORMAL).
+	SCALE_OCB      = 8  // opposite-colored bishops with no other pieces.
+	SCALE_PAWNLESS = 2  // the stronger side has no pawns, and is ahead by at most a minor piece.
+	SCALE_DRAW     = 0  // a rook pawn that can't be promoted with the help of the stronger side's bishop.
+)
+
+// InsufficientMaterial returns true if neither side has enough material to force checkmate.
+func (brd *Board) InsufficientMaterial() bool {
+	if brd.pieces[WHITE][PAWN]|brd.pieces[BLACK][PAWN]|brd.pieces[WHITE][ROOK]|brd.pieces[BLACK][ROOK]|
+		brd.pieces[WHITE][QUEEN]|brd.pieces[BLACK][QUEEN] > 0 {
+		return false
+	}
+	knights := brd.pieces[WHITE][KNIGHT] | brd.pieces[BLACK][KNIGHT]
+	bishops := brd.pieces[WHITE][BISHOP] | brd.pieces[BLACK][BISHOP]
+	if knights == 0 { // all bishops on the same color can never mate.
+		return bishops&DARK_SQUARES == 0 || bishops&^DARK_SQUARES == 0
+	}
+	if bishops > 0 {
+		return false
+	}
+	// a lone knight, or two knights against a bare king.
+	return popCount(knights) == 1 || (popCount(knights) == 2 &&
+		(brd.pieces[WHITE][KNIGHT] == knights || brd.pieces[BLACK][KNIGHT] == knights))
+}
+
+func nonPawnMaterial(brd *Board, c uint8) int {
+	value := 0
+	for pc := KNIGHT; pc < KING; pc++ {
+		value += popCount(brd.pieces[c][pc]) * pieceValues[pc]
+	}
+	return value
+}
+
+// scaleFactor returns how much of the evaluation should be kept, in units of 1/SCALE_NORMAL, given
+// the material of the side that the evaluation favors.
+func scaleFactor(brd *Board, strong uint8) int {
+	weak := strong ^ 1
+	if brd.pieces[strong][ROOK]|brd.pieces[strong][QUEEN]|brd.pieces[strong][KNIGHT] == 0 {
+		if scale, ok := rookPawnScale(brd, strong, weak); ok {
+			return scale
+		}
+	}
+	if brd.pieces[strong][PAWN] == 0 &&
+		nonPawnMaterial(brd, strong)-nonPawnMaterial(brd, weak) <= BISHOP_VALUE {
+		return SCALE_PAWNLESS
+	}
+	if loneBishop(brd, strong) && loneBishop(brd, weak) {
+		bishops := brd.pieces[strong][BISHOP] | brd.pieces[weak][BISHOP]
+		if popCount(bishops&DARK_SQUARES) == 1 { // one bishop on each color.
+			return SCALE_OCB
+		}
+	}
+	return SCALE_NORMAL
+}
+
+// loneBishop returns true if a single bishop is the only piece c has besides its king and pawns.
+func loneBishop(brd *Board, c uint8) bool {
+	bishops := brd.pieces[c][BISHOP]
+	return bishops > 0 && bishops&(bishops-1) == 0 &&
+		brd.occupied[c] == brd.pieces[c][PAWN]|brd.pieces[c][KING]|bishops
+}
+
+// If all of the stronger side's pawns are on the same rook file, and its bishops (if any) can't
+// control the promotion square, the weaker king can't be driven out once it reaches the corner.
+func rookPawnScale(brd *Board, strong, weak uint8) (int, bool) {
+	pawns := brd.pieces[strong][PAWN]
+	var promotionSq int
+	if pawns == 0 {
+		return SCALE_NORMAL, false
+	} else if pawns&^columnMasks[0] == 0 {
+		promotionSq = Square(7*int(strong), 0)
+	} else if pawns&^columnMasks[7] == 0 {
+		promotionSq = Square(7*int(strong), 7)
+	} else {
+		return SCALE_NORMAL, false
+	}
+	promotionColor := DARK_SQUARES
+	if sqMaskOn[promotionSq]&DARK_SQUARES == 0 {
+		promotionColor = ^DARK_SQUARES
+	}
+	if brd.pieces[strong][BISHOP]&promotionColor == 0 &&
+		chebyshevDistance(brd.KingSq(weak), promotionSq) <= 1 {
+		return SCALE_DRAW, true
+	}
+	return SCALE_NORMAL, false
+}
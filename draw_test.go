@@ -0,0 +1,54 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import "testing"
+
+var insufficientMaterialTests = []struct {
+	fen      string
+	expected bool
+}{
+	{"8/8/4k3/8/8/3K4/8/8 w - - 0 1", true},      // KvK
+	{"8/8/4k3/8/8/3K4/8/5B2 w - - 0 1", true},    // KBvK
+	{"8/8/4k3/8/8/3K4/8/6N1 b - - 0 1", true},    // KNvK
+	{"8/8/4k3/8/8/3K4/8/1N4N1 w - - 0 1", true},  // KNNvK
+	{"8/8/4k3/8/4b3/3K4/8/5B2 w - - 0 1", true},  // bishops on the same color
+	{"8/8/4k3/8/3b4/3K4/8/5B2 w - - 0 1", false}, // bishops on opposite colors
+	{"8/8/4k3/8/8/3K4/8/5BN1 w - - 0 1", false},  // KBNvK
+	{"8/8/4k3/8/3n4/3K4/8/6N1 w - - 0 1", false}, // KNvKN
+	{"8/8/4k3/8/8/3K4/P7/8 w - - 0 1", false},    // KPvK
+}
+
+func TestInsufficientMaterial(t *testing.T) {
+	for _, test := range insufficientMaterialTests {
+		if ParseFENString(test.fen).InsufficientMaterial() != test.expected {
+			t.Errorf("Expected insufficient material to be %t for %s", test.expected, test.fen)
+		}
+	}
+}
+
+var scaleFactorTests = []struct {
+	fen      string
+	strong   uint8
+	expected int
+}{
+	{"k7/8/2K5/P7/8/8/8/1B6 w - - 0 1", WHITE, SCALE_NORMAL},     // the bishop controls a8.
+	{"k7/8/2K5/P7/8/8/8/2B5 w - - 0 1", WHITE, SCALE_DRAW},       // wrong bishop.
+	{"8/8/8/8/8/1k6/7p/4K3 b - - 0 1", BLACK, SCALE_NORMAL},      // the king is too far from h1.
+	{"8/8/8/8/8/8/5k1p/7K b - - 0 1", BLACK, SCALE_DRAW},         // rook pawn.
+	{"8/5k2/8/3b4/8/8/2R5/4K3 w - - 0 1", WHITE, SCALE_PAWNLESS}, // KRvKB
+	{"8/5k2/8/3r4/8/8/2Q5/4K3 w - - 0 1", WHITE, SCALE_NORMAL},   // KQvKR
+	{"8/5k2/5p2/3b4/4P3/4B3/3PK3/8 w - - 0 1", WHITE, SCALE_OCB},
+	{"8/5k2/5p2/4b3/4P3/4B3/3PK3/8 w - - 0 1", WHITE, SCALE_NORMAL},
+}
+
+func TestScaleFactor(t *testing.T) {
+	for _, test := range scaleFactorTests {
+		if scale := scaleFactor(ParseFENString(test.fen), test.strong); scale != test.expected {
+			t.Errorf("Expected scale factor %d, got %d for %s", test.expected, scale, test.fen)
+		}
+	}
+}
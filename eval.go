@@ -5,11 +5,6 @@
 
 package main
 
-const ( // TODO: expose these options via UCI interface.
-	LAZY_EVAL_MARGIN = BISHOP_VALUE
-	TEMPO_BONUS      = 5
-)
-
 const (
 	MAX_ENDGAME_COUNT = 24
 )
@@ -39,53 +34,112 @@ var endgamePhase [64]int
 // piece values used to determine endgame status. 0-12 per side,
 var endgameCountValues = [8]uint8{0, 1, 1, 2, 4, 0}
 
-var mainPst = [2][8][64]int{ // Black. White PST will be set in setup_eval.
-	{ // Pawn
-		{0, 0, 0, 0, 0, 0, 0, 0,
-			-11, 1, 1, 1, 1, 1, 1, -11,
-			-12, 0, 1, 2, 2, 1, 0, -12,
-			-13, -1, 2, 10, 10, 2, -1, -13,
-			-14, -2, 4, 14, 14, 4, -2, -14,
-			-15, -3, 0, 9, 9, 0, -3, -15,
-			-16, -4, 0, -20, -20, 0, -4, -16,
-			0, 0, 0, 0, 0, 0, 0, 0},
-
-		// Knight
-		{-8, -8, -6, -6, -6, -6, -8, -8,
-			-8, 0, 0, 0, 0, 0, 0, -8,
-			-6, 0, 4, 4, 4, 4, 0, -6,
-			-6, 0, 4, 8, 8, 4, 0, -6,
-			-6, 0, 4, 8, 8, 4, 0, -6,
-			-6, 0, 4, 4, 4, 4, 0, -6,
-			-8, 0, 1, 2, 2, 1, 0, -8,
-			-10, -12, -6, -6, -6, -6, -12, -10},
-		// Bishop
-		{-3, -3, -3, -3, -3, -3, -3, -3,
-			-3, 0, 0, 0, 0, 0, 0, -3,
-			-3, 0, 2, 4, 4, 2, 0, -3,
-			-3, 0, 4, 5, 5, 4, 0, -3,
-			-3, 0, 4, 5, 5, 4, 0, -3,
-			-3, 1, 2, 4, 4, 2, 1, -3,
-			-3, 2, 1, 1, 1, 1, 2, -3,
-			-3, -3, -10, -3, -3, -10, -3, -3},
-		// Rook
-		{4, 4, 4, 4, 4, 4, 4, 4,
-			16, 16, 16, 16, 16, 16, 16, 16,
-			-4, 0, 0, 0, 0, 0, 0, -4,
-			-4, 0, 0, 0, 0, 0, 0, -4,
-			-4, 0, 0, 0, 0, 0, 0, -4,
-			-4, 0, 0, 0, 0, 0, 0, -4,
-			-4, 0, 0, 0, 0, 0, 0, -4,
-			0, 0, 0, 2, 2, 0, 0, 0},
-		// Queen
-		{0, 0, 0, 1, 1, 0, 0, 0,
-			0, 0, 1, 2, 2, 1, 0, 0,
-			0, 1, 2, 2, 2, 2, 1, 0,
-			0, 1, 2, 3, 3, 2, 1, 0,
-			0, 1, 2, 3, 3, 2, 1, 0,
-			0, 1, 1, 2, 2, 1, 1, 0,
-			0, 0, 1, 1, 1, 1, 0, 0,
-			-6, -6, -6, -6, -6, -6, -6, -6},
+var mainPst = [2][2][8][64]int{ // Black. White PST will be set in setup_eval.
+	{
+		{ // Early game
+			{ // Pawn
+				0, 0, 0, 0, 0, 0, 0, 0,
+				-11, 1, 1, 1, 1, 1, 1, -11,
+				-12, 0, 1, 2, 2, 1, 0, -12,
+				-13, -1, 2, 10, 10, 2, -1, -13,
+				-14, -2, 4, 14, 14, 4, -2, -14,
+				-15, -3, 0, 9, 9, 0, -3, -15,
+				-16, -4, 0, -20, -20, 0, -4, -16,
+				0, 0, 0, 0, 0, 0, 0, 0,
+			},
+			{ // Knight
+				-8, -8, -6, -6, -6, -6, -8, -8,
+				-8, 0, 0, 0, 0, 0, 0, -8,
+				-6, 0, 4, 4, 4, 4, 0, -6,
+				-6, 0, 4, 8, 8, 4, 0, -6,
+				-6, 0, 4, 8, 8, 4, 0, -6,
+				-6, 0, 4, 4, 4, 4, 0, -6,
+				-8, 0, 1, 2, 2, 1, 0, -8,
+				-10, -12, -6, -6, -6, -6, -12, -10,
+			},
+			{ // Bishop
+				-3, -3, -3, -3, -3, -3, -3, -3,
+				-3, 0, 0, 0, 0, 0, 0, -3,
+				-3, 0, 2, 4, 4, 2, 0, -3,
+				-3, 0, 4, 5, 5, 4, 0, -3,
+				-3, 0, 4, 5, 5, 4, 0, -3,
+				-3, 1, 2, 4, 4, 2, 1, -3,
+				-3, 2, 1, 1, 1, 1, 2, -3,
+				-3, -3, -10, -3, -3, -10, -3, -3,
+			},
+			{ // Rook
+				4, 4, 4, 4, 4, 4, 4, 4,
+				16, 16, 16, 16, 16, 16, 16, 16,
+				-4, 0, 0, 0, 0, 0, 0, -4,
+				-4, 0, 0, 0, 0, 0, 0, -4,
+				-4, 0, 0, 0, 0, 0, 0, -4,
+				-4, 0, 0, 0, 0, 0, 0, -4,
+				-4, 0, 0, 0, 0, 0, 0, -4,
+				0, 0, 0, 2, 2, 0, 0, 0,
+			},
+			{ // Queen
+				0, 0, 0, 1, 1, 0, 0, 0,
+				0, 0, 1, 2, 2, 1, 0, 0,
+				0, 1, 2, 2, 2, 2, 1, 0,
+				0, 1, 2, 3, 3, 2, 1, 0,
+				0, 1, 2, 3, 3, 2, 1, 0,
+				0, 1, 1, 2, 2, 1, 1, 0,
+				0, 0, 1, 1, 1, 1, 0, 0,
+				-6, -6, -6, -6, -6, -6, -6, -6,
+			},
+		},
+		{ // Endgame
+			{ // Pawn
+				0, 0, 0, 0, 0, 0, 0, 0,
+				-11, 1, 1, 1, 1, 1, 1, -11,
+				-12, 0, 1, 2, 2, 1, 0, -12,
+				-13, -1, 2, 10, 10, 2, -1, -13,
+				-14, -2, 4, 14, 14, 4, -2, -14,
+				-15, -3, 0, 9, 9, 0, -3, -15,
+				-16, -4, 0, -20, -20, 0, -4, -16,
+				0, 0, 0, 0, 0, 0, 0, 0,
+			},
+			{ // Knight
+				-8, -8, -6, -6, -6, -6, -8, -8,
+				-8, 0, 0, 0, 0, 0, 0, -8,
+				-6, 0, 4, 4, 4, 4, 0, -6,
+				-6, 0, 4, 8, 8, 4, 0, -6,
+				-6, 0, 4, 8, 8, 4, 0, -6,
+				-6, 0, 4, 4, 4, 4, 0, -6,
+				-8, 0, 1, 2, 2, 1, 0, -8,
+				-10, -12, -6, -6, -6, -6, -12, -10,
+			},
+			{ // Bishop
+				-3, -3, -3, -3, -3, -3, -3, -3,
+				-3, 0, 0, 0, 0, 0, 0, -3,
+				-3, 0, 2, 4, 4, 2, 0, -3,
+				-3, 0, 4, 5, 5, 4, 0, -3,
+				-3, 0, 4, 5, 5, 4, 0, -3,
+				-3, 1, 2, 4, 4, 2, 1, -3,
+				-3, 2, 1, 1, 1, 1, 2, -3,
+				-3, -3, -10, -3, -3, -10, -3, -3,
+			},
+			{ // Rook
+				4, 4, 4, 4, 4, 4, 4, 4,
+				16, 16, 16, 16, 16, 16, 16, 16,
+				-4, 0, 0, 0, 0, 0, 0, -4,
+				-4, 0, 0, 0, 0, 0, 0, -4,
+				-4, 0, 0, 0, 0, 0, 0, -4,
+				-4, 0, 0, 0, 0, 0, 0, -4,
+				-4, 0, 0, 0, 0, 0, 0, -4,
+				0, 0, 0, 2, 2, 0, 0, 0,
+			},
+			{ // Queen
+				0, 0, 0, 1, 1, 0, 0, 0,
+				0, 0, 1, 2, 2, 1, 0, 0,
+				0, 1, 2, 2, 2, 2, 1, 0,
+				0, 1, 2, 3, 3, 2, 1, 0,
+				0, 1, 2, 3, 3, 2, 1, 0,
+				0, 1, 1, 2, 2, 1, 1, 0,
+				0, 0, 1, 1, 1, 1, 0, 0,
+				-6, -6, -6, -6, -6, -6, -6, -6,
+			},
+		},
 	},
 }
 
@@ -125,15 +179,18 @@ var squareMirror = [64]int{
 	A1, B1, C1, D1, E1, F1, G1, H1,
 }
 
-var kingThreatBonus = [64]int{
-	0, 2, 3, 5, 9, 15, 24, 37,
-	55, 79, 111, 150, 195, 244, 293, 337,
-	370, 389, 389, 389, 389, 389, 389, 389,
-	389, 389, 389, 389, 389, 389, 389, 389,
-	389, 389, 389, 389, 389, 389, 389, 389,
-	389, 389, 389, 389, 389, 389, 389, 389,
-	389, 389, 389, 389, 389, 389, 389, 389,
-	389, 389, 389, 389, 389, 389, 389, 389,
+var kingThreatBonus = [2][64]int{
+	{
+		0, 2, 3, 5, 9, 15, 24, 37,
+		55, 79, 111, 150, 195, 244, 293, 337,
+		370, 389, 389, 389, 389, 389, 389, 389,
+		389, 389, 389, 389, 389, 389, 389, 389,
+		389, 389, 389, 389, 389, 389, 389, 389,
+		389, 389, 389, 389, 389, 389, 389, 389,
+		389, 389, 389, 389, 389, 389, 389, 389,
+		389, 389, 389, 389, 389, 389, 389, 389,
+	},
+	{}, // In the endgame, there are too few attackers left to threaten the king.
 }
 
 var kingSafteyBase = [2][64]int{
@@ -150,31 +207,96 @@ var kingSafteyBase = [2][64]int{
 }
 
 // adjusts value of knights and rooks based on number of own pawns in play.
-var knightPawns = [16]int{-20, -16, -12, -8, -4, 0, 4, 8, 12}
-var rookPawns = [16]int{16, 12, 8, 4, 2, 0, -2, -4, -8}
+var knightPawns = [2][16]int{
+	{-20, -16, -12, -8, -4, 0, 4, 8, 12},
+	{-20, -16, -12, -8, -4, 0, 4, 8, 12},
+}
+var rookPawns = [2][16]int{
+	{16, 12, 8, 4, 2, 0, -2, -4, -8},
+	{16, 12, 8, 4, 2, 0, -2, -4, -8},
+}
+
+var bishopPairBonus = [2]int{40, 40}
 
 // adjusts the value of bishop pairs based on number of enemy pawns in play.
-var bishopPairPawns = [16]int{10, 10, 9, 8, 6, 4, 2, 0, -2}
+var bishopPairPawns = [2][16]int{
+	{10, 10, 9, 8, 6, 4, 2, 0, -2},
+	{10, 10, 9, 8, 6, 4, 2, 0, -2},
+}
+
+var knightMobility = [2][16]int{
+	{-16, -12, -6, -3, 0, 1, 3, 5, 6, 0, 0, 0, 0, 0, 0},
+	{-16, -12, -6, -3, 0, 1, 3, 5, 6, 0, 0, 0, 0, 0, 0},
+}
 
-var knightMobility = [16]int{-16, -12, -6, -3, 0, 1, 3, 5, 6, 0, 0, 0, 0, 0, 0}
+var bishopMobility = [2][16]int{
+	{-24, -16, -8, -4, -2, 0, 2, 4, 6, 7, 8, 9, 10, 11, 12, 13},
+	{-24, -16, -8, -4, -2, 0, 2, 4, 6, 7, 8, 9, 10, 11, 12, 13},
+}
 
-var bishopMobility = [16]int{-24, -16, -8, -4, -2, 0, 2, 4, 6, 7, 8, 9, 10, 11, 12, 13}
+var rookMobility = [2][16]int{
+	{}, // only reward rook mobility in the late-game.
+	{-12, -8, -4, -2, 0, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+}
 
-var rookMobility = [16]int{-12, -8, -4, -2, 0, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+var queenMobility = [2][32]int{
+	{-24, -18, -12, -6, -3, 0, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 24, 24, 24},
+	{-24, -18, -12, -6, -3, 0, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 24, 24, 24},
+}
 
-var queenMobility = [32]int{-24, -18, -12, -6, -3, 0, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
-	12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 24, 24, 24}
+// encourage queen to move toward enemy king in the late-game.
+var queenTropismBonus = [2][8]int{
+	{},
+	{0, 12, 9, 6, 3, 0, -3, -6},
+}
 
-var queenTropismBonus = [8]int{0, 12, 9, 6, 3, 0, -3, -6}
+var pawnShieldBonus = [2][4]int{
+	{-9, -3, 3, 9},
+	{}, // In the endgame, the king should leave its shelter.
+}
 
+const (
+	TERM_MATERIAL = iota
+	TERM_PST
+	TERM_PAWN_STRUCTURE
+	TERM_PASSED_PAWNS
+	TERM_PAWN_COUNT // knight and rook values adjusted for the number of friendly pawns.
+	TERM_BISHOP_PAIR
+	TERM_MOBILITY
+	TERM_QUEEN_TROPISM
+	TERM_KING_PST
+	TERM_PAWN_SHIELD
+	TERM_KING_THREATS
+	TERM_TEMPO
+	EVAL_TERMS
+)
+
+// EvalTerms holds the midgame and endgame value of each evaluation term for one side.
+type EvalTerms [EVAL_TERMS][2]int
+
+func (terms *EvalTerms) add(term, mg, eg int) {
+	terms[term][MIDGAME] += mg
+	terms[term][ENDGAME] += eg
+}
+
+// Every evaluation term has separate midgame and endgame values. These are summed separately, and
+// combined according to the endgame phase only once the evaluation is complete.
 func evaluate(brd *Board, alpha, beta int) int {
+	if brd.nnue != nil {
+		return scaleScore(brd, brd.nnue.Evaluate(brd.c))
+	}
 	c, e := brd.c, brd.Enemy()
+	phase := endgamePhase[brd.endgameCounter]
 	// lazy evaluation: if material balance is already outside the search window by an amount that outweighs
 	// the largest likely placement evaluation, return the material as an approximate evaluation.
 	// This prevents the engine from wasting a lot of time evaluating unrealistic positions.
-	score := int(brd.material[c]-brd.material[e]) + TEMPO_BONUS
-	if score+LAZY_EVAL_MARGIN < alpha || score-LAZY_EVAL_MARGIN > beta {
-		return score
+	mg := int(brd.material[c][MIDGAME]-brd.material[e][MIDGAME]) + tempoBonus[MIDGAME]
+	eg := int(brd.material[c][ENDGAME]-brd.material[e][ENDGAME]) + tempoBonus[ENDGAME]
+	score := weightScore(phase, mg, eg)
+	if score+lazyEvalMargin < alpha || score-lazyEvalMargin > beta {
+		return scaleScore(brd, score)
 	}
 
 	pentry := brd.worker.ptt.Probe(brd.pawnHashKey)
@@ -182,30 +304,44 @@ func evaluate(brd *Board, alpha, beta int) int {
 		// collisions can occur, but are too infrequent to matter much (1 / 20+ million)
 		setPawnStructure(brd, pentry) // evaluate pawn structure and save to pentry.
 	}
+	mg += pentry.value[c][MIDGAME]
+	eg += pentry.value[c][ENDGAME]
+
+	var terms [2]EvalTerms
+	netPassedPawns(brd, pentry, c, e, &terms)
+	netMajorPlacement(brd, pentry, c, e, &terms) // 3x as expensive as pawn eval...
+	for term := 0; term < EVAL_TERMS; term++ {
+		mg += terms[c][term][MIDGAME] - terms[e][term][MIDGAME]
+		eg += terms[c][term][ENDGAME] - terms[e][term][ENDGAME]
+	}
+	return scaleScore(brd, weightScore(phase, mg, eg))
+}
 
-	score += netPawnPlacement(brd, pentry, c, e)
-	score += netMajorPlacement(brd, pentry, c, e) // 3x as expensive as pawn eval...
-
-	return score
+// scaleScore damps the evaluation toward zero in endings the favored side is unlikely to win.
+func scaleScore(brd *Board, score int) int {
+	strong := brd.c
+	if score < 0 {
+		strong = brd.Enemy()
+	}
+	return score * scaleFactor(brd, strong) / SCALE_NORMAL
 }
 
-func netMajorPlacement(brd *Board, pentry *PawnEntry, c, e uint8) int {
+func netMajorPlacement(brd *Board, pentry *PawnEntry, c, e uint8, terms *[2]EvalTerms) {
 	kingSq, enemyKingSq := brd.KingSq(c), brd.KingSq(e)
-	return majorPlacement(brd, pentry, c, e, kingSq, enemyKingSq) -
-		majorPlacement(brd, pentry, e, c, enemyKingSq, kingSq)
+	majorPlacement(brd, pentry, c, e, kingSq, enemyKingSq, &terms[c])
+	majorPlacement(brd, pentry, e, c, enemyKingSq, kingSq, &terms[e])
 }
 
-var pawnShieldBonus = [4]int{-9, -3, 3, 9}
-
-func majorPlacement(brd *Board, pentry *PawnEntry, c, e uint8, kingSq,
-	enemyKingSq int) (totalPlacement int) {
+// majorPlacement adds the value of the pieces and king of side c to terms.
+func majorPlacement(brd *Board, pentry *PawnEntry, c, e uint8, kingSq, enemyKingSq int,
+	terms *EvalTerms) {
 
 	friendly := brd.Placement(c)
 	occ := brd.AllOccupied()
 
 	available := (^friendly) & (^(pentry.allAttacks[e]))
 
-	var sq, mobility, placement, kingThreats int
+	var sq, mobility, kingThreats int
 	var b, attacks BB
 
 	enemyKingZone := kingZoneMasks[e][enemyKingSq]
@@ -214,52 +350,54 @@ func majorPlacement(brd *Board, pentry *PawnEntry, c, e uint8, kingSq,
 
 	for b = brd.pieces[c][KNIGHT]; b > 0; b.Clear(sq) {
 		sq = furthestForward(c, b)
-		placement += knightPawns[pawnCount]
+		terms.add(TERM_PAWN_COUNT, knightPawns[MIDGAME][pawnCount], knightPawns[ENDGAME][pawnCount])
 		attacks = knightMasks[sq] & available
 		kingThreats += popCount(attacks & enemyKingZone)
-		mobility += knightMobility[popCount(attacks)]
+		mobility = popCount(attacks)
+		terms.add(TERM_MOBILITY, knightMobility[MIDGAME][mobility], knightMobility[ENDGAME][mobility])
 	}
 
 	for b = brd.pieces[c][BISHOP]; b > 0; b.Clear(sq) {
 		sq = furthestForward(c, b)
 		attacks = bishopAttacks(occ, sq) & available
 		kingThreats += popCount(attacks & enemyKingZone)
-		mobility += bishopMobility[popCount(attacks)]
+		mobility = popCount(attacks)
+		terms.add(TERM_MOBILITY, bishopMobility[MIDGAME][mobility], bishopMobility[ENDGAME][mobility])
 	}
 	if popCount(brd.pieces[c][BISHOP]) > 1 { // bishop pairs
-		placement += 40 + bishopPairPawns[pentry.count[e]]
+		enemyPawns := pentry.count[e]
+		terms.add(TERM_BISHOP_PAIR, bishopPairBonus[MIDGAME]+bishopPairPawns[MIDGAME][enemyPawns],
+			bishopPairBonus[ENDGAME]+bishopPairPawns[ENDGAME][enemyPawns])
 	}
 
-	phase := endgamePhase[brd.endgameCounter]
-
 	for b = brd.pieces[c][ROOK]; b > 0; b.Clear(sq) {
 		sq = furthestForward(c, b)
-		placement += rookPawns[pawnCount]
+		terms.add(TERM_PAWN_COUNT, rookPawns[MIDGAME][pawnCount], rookPawns[ENDGAME][pawnCount])
 		attacks = rookAttacks(occ, sq) & available
 		kingThreats += popCount(attacks & enemyKingZone)
-		// only reward rook mobility in the late-game.
-		mobility += weightScore(phase, 0, rookMobility[popCount(attacks)])
+		mobility = popCount(attacks)
+		terms.add(TERM_MOBILITY, rookMobility[MIDGAME][mobility], rookMobility[ENDGAME][mobility])
 	}
 
 	for b = brd.pieces[c][QUEEN]; b > 0; b.Clear(sq) {
 		sq = furthestForward(c, b)
 		attacks = queenAttacks(occ, sq) & available
 		kingThreats += popCount(attacks & enemyKingZone)
-		mobility += queenMobility[popCount(attacks)]
-		placement += weightScore(phase, 0, // encourage queen to move toward enemy king in the late-game.
-			queenTropismBonus[chebyshevDistance(sq, enemyKingSq)])
+		mobility = popCount(attacks)
+		terms.add(TERM_MOBILITY, queenMobility[MIDGAME][mobility], queenMobility[ENDGAME][mobility])
+		distance := chebyshevDistance(sq, enemyKingSq)
+		terms.add(TERM_QUEEN_TROPISM, queenTropismBonus[MIDGAME][distance],
+			queenTropismBonus[ENDGAME][distance])
 	}
 
-	placement += weightScore(phase,
-		pawnShieldBonus[popCount(brd.pieces[c][PAWN]&kingShieldMasks[c][kingSq])], 0)
-
-	placement += weightScore(phase,
-		kingPst[c][MIDGAME][kingSq], kingPst[c][ENDGAME][kingSq])
+	shield := popCount(brd.pieces[c][PAWN] & kingShieldMasks[c][kingSq])
+	terms.add(TERM_PAWN_SHIELD, pawnShieldBonus[MIDGAME][shield], pawnShieldBonus[ENDGAME][shield])
 
-	placement += weightScore(phase,
-		kingThreatBonus[kingThreats+kingSafteyBase[e][enemyKingSq]], 0)
+	terms.add(TERM_KING_PST, kingPst[c][MIDGAME][kingSq], kingPst[c][ENDGAME][kingSq])
 
-	return placement + mobility
+	kingThreats += kingSafteyBase[e][enemyKingSq]
+	terms.add(TERM_KING_THREATS, kingThreatBonus[MIDGAME][kingThreats],
+		kingThreatBonus[ENDGAME][kingThreats])
 }
 
 // Tapered Evaluation: adjust the score based on how close we are to the endgame.
@@ -273,20 +411,31 @@ func weightScore(phase, mgScore, egScore int) int {
 }
 
 func setupEval() {
-	for piece := PAWN; piece < KING; piece++ { // Main PST
-		for sq := 0; sq < 64; sq++ {
-			mainPst[WHITE][piece][sq] = mainPst[BLACK][piece][squareMirror[sq]]
-		}
+	mirrorEval()
+	defaultEvalValues = evalValues(evalParams())
+	for i := 0; i <= 24; i++ { // Endgame phase scaling factor
+		endgamePhase[i] = (((MAX_ENDGAME_COUNT - i) * 256) + (MAX_ENDGAME_COUNT / 2)) / MAX_ENDGAME_COUNT
 	}
-	for endgame := 0; endgame < 2; endgame++ { // King PST
-		for sq := 0; sq < 64; sq++ {
-			kingPst[WHITE][endgame][sq] = kingPst[BLACK][endgame][squareMirror[sq]]
+}
+
+// mirrorEval sets the white half of each color-indexed eval table from the black half.
+func mirrorEval() {
+	for phase := MIDGAME; phase <= ENDGAME; phase++ {
+		for piece := PAWN; piece < KING; piece++ { // Main PST
+			for sq := 0; sq < 64; sq++ {
+				mainPst[WHITE][phase][piece][sq] = mainPst[BLACK][phase][piece][squareMirror[sq]]
+			}
+		}
+		for sq := 0; sq < 64; sq++ { // King PST
+			kingPst[WHITE][phase][sq] = kingPst[BLACK][phase][squareMirror[sq]]
+		}
+		for _, table := range []*[2][2][8]int{&passedPawnBonus, &tarraschBonus, &defenseBonus, &duoBonus} {
+			for r := 0; r < 8; r++ { // Pawn bonuses by row
+				table[WHITE][phase][r] = table[BLACK][phase][7-r]
+			}
 		}
 	}
 	for sq := 0; sq < 64; sq++ { // King saftey counters
 		kingSafteyBase[WHITE][sq] = kingSafteyBase[BLACK][squareMirror[sq]]
 	}
-	for i := 0; i <= 24; i++ { // Endgame phase scaling factor
-		endgamePhase[i] = (((MAX_ENDGAME_COUNT - i) * 256) + (MAX_ENDGAME_COUNT / 2)) / MAX_ENDGAME_COUNT
-	}
 }
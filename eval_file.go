@@ -0,0 +1,225 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Eval Files
+
+// Evaluation parameters can be loaded from a JSON file instead of being compiled in, so that tuning
+// experiments don't require a rebuild. An eval file is a JSON object containing a "version" number
+// and an array of integers for each parameter, e.g.:
+
+// {
+//   "version": 2,
+//   "KingSafetyBase": [4,4,4,4,4,4,4,4, ...],
+//   "PawnPstMidgame": [-11,1,1,1,1,1,1,-11, ...],
+//   ...
+//   "TempoBonusEndgame": [5]
+// }
+
+// Parameters left out of the file keep their built-in values. Only the black half of each
+// color-indexed table is stored; the white half is set by mirrorEval. Version 1 files, written
+// before most terms had separate midgame and endgame values, are still accepted.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+)
+
+const EVAL_FILE_VERSION = 2 // version 2 added separate midgame and endgame values for every term.
+
+var defaultEvalValues [][]int // the built-in value of each parameter returned by evalParams.
+
+// EvalParam refers to a table of evaluation parameters, or a single parameter.
+type EvalParam struct {
+	name     string
+	values   []*int
+	min, max int
+}
+
+func tableParam(name string, table []int) EvalParam {
+	p := EvalParam{name: name, min: -INF, max: INF}
+	for i := range table {
+		p.values = append(p.values, &table[i])
+	}
+	return p
+}
+
+func scalarParam(name string, value *int) EvalParam {
+	return EvalParam{name, []*int{value}, -INF, INF}
+}
+
+// bounded limits the values of p, for parameters used as table indices or exposed as UCI options.
+func (p EvalParam) bounded(min, max int) EvalParam {
+	p.min, p.max = min, max
+	return p
+}
+
+// evalParams returns every tunable evaluation parameter. Table entries that can never be used
+// (e.g. pawns on the first or last row, or mobility greater than the maximum possible) are left out.
+// Material values are also left out. The evaluation counts each piece's value and its PST entry
+// together, so shifting a piece's PSTs already tunes its value separately in each phase. The
+// values in pieceValues are also used by SEE and move ordering, which assume the built-in values
+// (e.g. SEE_MIN is the loss of a queen for a pawn).
+func evalParams() []EvalParam {
+	params := []EvalParam{
+		tableParam("KingSafetyBase", kingSafteyBase[BLACK][:]).bounded(0, 16), // kingThreatBonus index
+	}
+	for phase, suffix := range []string{"Midgame", "Endgame"} {
+		params = append(params,
+			tableParam("PawnPst"+suffix, mainPst[BLACK][phase][PAWN][8:56]),
+			tableParam("KnightPst"+suffix, mainPst[BLACK][phase][KNIGHT][:]),
+			tableParam("BishopPst"+suffix, mainPst[BLACK][phase][BISHOP][:]),
+			tableParam("RookPst"+suffix, mainPst[BLACK][phase][ROOK][:]),
+			tableParam("QueenPst"+suffix, mainPst[BLACK][phase][QUEEN][:]),
+			tableParam("KingPst"+suffix, kingPst[BLACK][phase][:]),
+			tableParam("KingThreatBonus"+suffix, kingThreatBonus[phase][:]),
+			tableParam("KnightPawns"+suffix, knightPawns[phase][:9]),
+			tableParam("RookPawns"+suffix, rookPawns[phase][:9]),
+			scalarParam("BishopPairBonus"+suffix, &bishopPairBonus[phase]),
+			tableParam("BishopPairPawns"+suffix, bishopPairPawns[phase][:9]),
+			tableParam("KnightMobility"+suffix, knightMobility[phase][:9]),
+			tableParam("BishopMobility"+suffix, bishopMobility[phase][:14]),
+			tableParam("RookMobility"+suffix, rookMobility[phase][:15]),
+			tableParam("QueenMobility"+suffix, queenMobility[phase][:28]),
+			tableParam("QueenTropismBonus"+suffix, queenTropismBonus[phase][:]),
+			tableParam("PawnShieldBonus"+suffix, pawnShieldBonus[phase][:]),
+			tableParam("PassedPawnBonus"+suffix, passedPawnBonus[BLACK][phase][1:7]),
+			tableParam("TarraschBonus"+suffix, tarraschBonus[BLACK][phase][1:7]),
+			tableParam("DefenseBonus"+suffix, defenseBonus[BLACK][phase][1:7]),
+			tableParam("DuoBonus"+suffix, duoBonus[BLACK][phase][1:7]),
+			scalarParam("DoubledPawnPenalty"+suffix, &doubledPenalty[phase]).bounded(0, 100),
+			scalarParam("IsolatedPawnPenalty"+suffix, &isolatedPenalty[phase]).bounded(0, 100),
+			scalarParam("BackwardPawnPenalty"+suffix, &backwardPenalty[phase]).bounded(0, 100),
+			scalarParam("TempoBonus"+suffix, &tempoBonus[phase]).bounded(0, 100),
+		)
+	}
+	return params
+}
+
+func evalValues(params []EvalParam) [][]int {
+	values := make([][]int, len(params))
+	for i, p := range params {
+		values[i] = make([]int, len(p.values))
+		for j, v := range p.values {
+			values[i][j] = *v
+		}
+	}
+	return values
+}
+
+// setEvalValues updates the parameters, and any tables derived from them.
+func setEvalValues(params []EvalParam, values [][]int) {
+	for i, p := range params {
+		for j, v := range p.values {
+			*v = values[i][j]
+		}
+	}
+	mirrorEval()
+	clearPawnTables()
+}
+
+// setEvalFile loads the eval file at path, and returns a message describing the result. If the
+// file can't be used, the built-in parameters are restored.
+func setEvalFile(path string) string {
+	if path == "" || path == "<empty>" {
+		setEvalValues(evalParams(), defaultEvalValues)
+		return "using built-in evaluation parameters\n"
+	}
+	if err := loadEvalFile(path); err != nil {
+		setEvalValues(evalParams(), defaultEvalValues)
+		return err.Error() + "; using built-in evaluation parameters\n"
+	}
+	return fmt.Sprintf("evaluation parameters loaded from %s\n", path)
+}
+
+// loadEvalFile replaces the current parameters with those in the file at path. The file is
+// validated before any parameter is changed.
+func loadEvalFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.New(fmt.Sprintf("eval file could not be read: %s", path))
+	}
+	var tables map[string]json.RawMessage
+	if err = json.Unmarshal(data, &tables); err != nil {
+		return errors.New(fmt.Sprintf("%s: %s", path, err))
+	}
+	var version int
+	if err = json.Unmarshal(tables["version"], &version); err != nil || version < 1 ||
+		version > EVAL_FILE_VERSION {
+		return errors.New(fmt.Sprintf("%s: missing or unsupported version (expected 1 to %d)", path,
+			EVAL_FILE_VERSION))
+	}
+	delete(tables, "version")
+
+	params := evalParams()
+	if version == 1 {
+		splitPhases(tables, params)
+	}
+	values := make([][]int, len(params))
+	for i, p := range params {
+		raw, ok := tables[p.name]
+		if !ok {
+			values[i] = defaultEvalValues[i]
+			continue
+		}
+		delete(tables, p.name)
+		if err = json.Unmarshal(raw, &values[i]); err != nil {
+			return errors.New(fmt.Sprintf("%s: %s must be an array of integers", path, p.name))
+		}
+		if len(values[i]) != len(p.values) {
+			return errors.New(fmt.Sprintf("%s: %s has %d values, expected %d", path, p.name,
+				len(values[i]), len(p.values)))
+		}
+		for _, v := range values[i] {
+			if v < p.min || v > p.max {
+				return errors.New(fmt.Sprintf("%s: values for %s must be between %d and %d", path,
+					p.name, p.min, p.max))
+			}
+		}
+	}
+	if len(tables) > 0 {
+		var unknown []string
+		for name := range tables {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		return errors.New(fmt.Sprintf("%s: unknown parameter %s", path, unknown[0]))
+	}
+	setEvalValues(params, values)
+	return nil
+}
+
+// splitPhases converts the tables of a version 1 file, where most terms had a single value, by
+// using each single value for both the midgame and the endgame.
+func splitPhases(tables map[string]json.RawMessage, params []EvalParam) {
+	names := make(map[string]bool)
+	for _, p := range params {
+		names[p.name] = true
+	}
+	for name, raw := range tables {
+		if !names[name] && names[name+"Midgame"] && names[name+"Endgame"] {
+			tables[name+"Midgame"], tables[name+"Endgame"] = raw, raw
+			delete(tables, name)
+		}
+	}
+}
+
+// writeEvalFile saves the current parameters to path, with one table per line.
+func writeEvalFile(path string) error {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("{\n  \"version\": %d", EVAL_FILE_VERSION))
+	params := evalParams()
+	for i, values := range evalValues(params) {
+		data, _ := json.Marshal(values)
+		buf.WriteString(fmt.Sprintf(",\n  %q: %s", params[i].name, data))
+	}
+	buf.WriteString("\n}\n")
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,112 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEvalFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopher_check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer setEvalFile("") // restore the built-in parameters.
+
+	path := filepath.Join(dir, "eval.json")
+	defaultTempo := tempoBonus[ENDGAME]
+	passedPawnBonus[BLACK][ENDGAME][6] += 50
+	tempoBonus[ENDGAME] += 10
+	if err = writeEvalFile(path); err != nil {
+		t.Fatal(err)
+	}
+	setEvalFile("")
+	if tempoBonus[ENDGAME] != defaultTempo {
+		t.Fatalf("Expected the built-in TempoBonusEndgame to be restored, got %d", tempoBonus[ENDGAME])
+	}
+	if err = loadEvalFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if tempoBonus[ENDGAME] != defaultTempo+10 {
+		t.Errorf("Expected TempoBonusEndgame %d, got %d", defaultTempo+10, tempoBonus[ENDGAME])
+	}
+	if passedPawnBonus[WHITE][ENDGAME][1] != passedPawnBonus[BLACK][ENDGAME][6] {
+		t.Errorf("Expected white passed pawn bonus to be mirrored from black")
+	}
+}
+
+// Version 1 files have a single value for most terms, which is used for both phases.
+func TestEvalFileVersion1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopher_check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer setEvalFile("")
+
+	path := filepath.Join(dir, "eval.json")
+	contents := `{"version": 1, "TempoBonus": [9], "PassedPawnBonus": [1,2,3,4,5,6], "KingPstEndgame": [` +
+		strings.Repeat("7,", 63) + `7]}`
+	if err = ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = loadEvalFile(path); err != nil {
+		t.Fatal(err)
+	}
+	for phase := MIDGAME; phase <= ENDGAME; phase++ {
+		if tempoBonus[phase] != 9 || passedPawnBonus[BLACK][phase][6] != 6 {
+			t.Errorf("Expected the version 1 values to be used in phase %d", phase)
+		}
+	}
+	if kingPst[BLACK][ENDGAME][0] != 7 {
+		t.Errorf("Expected KingPstEndgame to be loaded from the version 1 file")
+	}
+}
+
+var invalidEvalFiles = []string{
+	`{"TempoBonusMidgame": [5]}`,                  // missing version
+	`{"version": 3, "TempoBonusMidgame": [5]}`,    // unsupported version
+	`{"version": 1, "TempoBonus": [-5]}`,          // out of range in either phase
+	`{"version": 2, "TempoBonusMidgame": [5, 6]}`, // wrong length
+	`{"version": 2, "TempoBonusMidgame": [-5]}`,   // out of range
+	`{"version": 2, "TempoBonusMidgame": ["5"]}`,  // not an integer
+	`{"version": 2, "TempoBonus": [5]}`,           // unknown parameter
+	`{"version": 2, "TempoBonusMidgame": [5]`,     // invalid JSON
+}
+
+func TestInvalidEvalFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopher_check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer setEvalFile("")
+
+	path := filepath.Join(dir, "eval.json")
+	for _, contents := range invalidEvalFiles {
+		if err = ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		doubledPenalty[MIDGAME] = 99
+		if err = loadEvalFile(path); err == nil {
+			t.Errorf("Expected an error loading %s", contents)
+		} else if doubledPenalty[MIDGAME] != 99 {
+			t.Errorf("Expected no parameters to change loading %s", contents)
+		}
+		setEvalFile(path)
+		if doubledPenalty[MIDGAME] == 99 {
+			t.Errorf("Expected the built-in parameters to be restored after loading %s", contents)
+		}
+	}
+	if err = loadEvalFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Expected an error loading a missing file")
+	}
+}
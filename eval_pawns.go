@@ -7,27 +7,30 @@ package main
 
 // "fmt"
 
-const (
-	DOUBLED_PENALTY  = 20
-	ISOLATED_PENALTY = 12
-	BACKWARD_PENALTY = 4
-)
-
-var passedPawnBonus = [2][8]int{
-	{0, 192, 96, 48, 24, 12, 6, 0},
-	{0, 6, 12, 24, 48, 96, 192, 0},
+// Pawn bonuses by row, for black. The white half of each table is set in setup_eval.
+var passedPawnBonus = [2][2][8]int{
+	{
+		{0, 192, 96, 48, 24, 12, 6, 0},
+		{0, 192, 96, 48, 24, 12, 6, 0},
+	},
 }
-var tarraschBonus = [2][8]int{
-	{0, 12, 8, 4, 2, 0, 0, 0},
-	{0, 0, 0, 2, 4, 8, 12, 0},
+var tarraschBonus = [2][2][8]int{
+	{
+		{0, 12, 8, 4, 2, 0, 0, 0},
+		{0, 12, 8, 4, 2, 0, 0, 0},
+	},
 }
-var defenseBonus = [2][8]int{
-	{0, 12, 8, 6, 5, 4, 3, 0},
-	{0, 3, 4, 5, 6, 8, 12, 0},
+var defenseBonus = [2][2][8]int{
+	{
+		{0, 12, 8, 6, 5, 4, 3, 0},
+		{0, 12, 8, 6, 5, 4, 3, 0},
+	},
 }
-var duoBonus = [2][8]int{
-	{0, 0, 2, 1, 1, 1, 0, 0},
-	{0, 0, 1, 1, 1, 2, 0, 0},
+var duoBonus = [2][2][8]int{
+	{
+		{0, 0, 2, 1, 1, 1, 0, 0},
+		{0, 0, 2, 1, 1, 1, 0, 0},
+	},
 }
 
 // var promoteRow = [2][2]int{
@@ -49,9 +52,10 @@ func setPawnStructure(brd *Board, pentry *PawnEntry) {
 	pentry.key = brd.pawnHashKey
 	setPawnMaps(brd, pentry, WHITE)
 	setPawnMaps(brd, pentry, BLACK)
-	pentry.value[WHITE] = pawnStructure(brd, pentry, WHITE, BLACK) -
-		pawnStructure(brd, pentry, BLACK, WHITE)
-	pentry.value[BLACK] = -pentry.value[WHITE]
+	whiteMg, whiteEg := pawnStructure(brd, pentry, WHITE, BLACK)
+	blackMg, blackEg := pawnStructure(brd, pentry, BLACK, WHITE)
+	pentry.value[WHITE] = [2]int{whiteMg - blackMg, whiteEg - blackEg}
+	pentry.value[BLACK] = [2]int{blackMg - whiteMg, blackEg - whiteEg}
 }
 
 func setPawnMaps(brd *Board, pentry *PawnEntry, c uint8) {
@@ -61,32 +65,38 @@ func setPawnMaps(brd *Board, pentry *PawnEntry, c uint8) {
 	pentry.passedPawns[c] = 0
 }
 
-// pawn_structure() sets the remaining pentry attributes for side c
-func pawnStructure(brd *Board, pentry *PawnEntry, c, e uint8) int {
+// pawn_structure() sets the remaining pentry attributes for side c, and returns the midgame and
+// endgame value of its pawn structure.
+func pawnStructure(brd *Board, pentry *PawnEntry, c, e uint8) (mg, eg int) {
 
-	var value, sq, sqRow int
+	var sq, sqRow int
 	ownPawns, enemyPawns := brd.pieces[c][PAWN], brd.pieces[e][PAWN]
 	for b := ownPawns; b > 0; b.Clear(sq) {
 		sq = furthestForward(c, b)
 		sqRow = row(sq)
 
 		if (pawnAttackMasks[e][sq])&ownPawns > 0 { // defended pawns
-			value += defenseBonus[c][sqRow]
+			mg += defenseBonus[c][MIDGAME][sqRow]
+			eg += defenseBonus[c][ENDGAME][sqRow]
 		}
 		if (pawnSideMasks[sq] & ownPawns) > 0 { // pawn duos
-			value += duoBonus[c][sqRow]
+			mg += duoBonus[c][MIDGAME][sqRow]
+			eg += duoBonus[c][ENDGAME][sqRow]
 		}
 
 		if pawnDoubledMasks[sq]&ownPawns > 0 { // doubled or tripled pawns
-			value -= DOUBLED_PENALTY
+			mg -= doubledPenalty[MIDGAME]
+			eg -= doubledPenalty[ENDGAME]
 		}
 
 		if pawnPassedMasks[c][sq]&enemyPawns == 0 { // passed pawns
-			value += passedPawnBonus[c][sqRow]
+			mg += passedPawnBonus[c][MIDGAME][sqRow]
+			eg += passedPawnBonus[c][ENDGAME][sqRow]
 			pentry.passedPawns[c].Add(sq) // note the passed pawn location in the pawn hash entry.
 		} else { // don't penalize passed pawns for being isolated.
 			if pawnIsolatedMasks[sq]&ownPawns == 0 {
-				value -= ISOLATED_PENALTY // isolated pawns
+				mg -= isolatedPenalty[MIDGAME] // isolated pawns
+				eg -= isolatedPenalty[ENDGAME]
 			}
 		}
 
@@ -97,41 +107,40 @@ func pawnStructure(brd *Board, pentry *PawnEntry, c, e uint8) int {
 		// 3. their stop square is not defended by a friendly pawn
 		if (pawnBackwardSpans[c][sq]&ownPawns == 0) &&
 			(pentry.allAttacks[e]&pawnStopMasks[c][sq] > 0) {
-			value -= BACKWARD_PENALTY
+			mg -= backwardPenalty[MIDGAME]
+			eg -= backwardPenalty[ENDGAME]
 		}
 	}
-	return value
-}
-
-func netPawnPlacement(brd *Board, pentry *PawnEntry, c, e uint8) int {
-	return pentry.value[c] + netPassedPawns(brd, pentry, c, e)
+	return mg, eg
 }
 
-func netPassedPawns(brd *Board, pentry *PawnEntry, c, e uint8) int {
-	return evalPassedPawns(brd, c, e, pentry.passedPawns[c]) -
-		evalPassedPawns(brd, e, c, pentry.passedPawns[e])
+func netPassedPawns(brd *Board, pentry *PawnEntry, c, e uint8, terms *[2]EvalTerms) {
+	evalPassedPawns(brd, c, e, pentry.passedPawns[c], &terms[c])
+	evalPassedPawns(brd, e, c, pentry.passedPawns[e], &terms[e])
 }
 
-func evalPassedPawns(brd *Board, c, e uint8, passedPawns BB) int {
-	var value, sq int
+func evalPassedPawns(brd *Board, c, e uint8, passedPawns BB, terms *EvalTerms) {
+	var sq, sqRow int
 	enemyKingSq := brd.KingSq(e)
 	for ; passedPawns > 0; passedPawns.Clear(sq) {
 		sq = furthestForward(c, passedPawns)
+		sqRow = row(sq)
 		// Tarrasch rule: assign small bonus for friendly rook behind the passed pawn
 		if pawnFrontSpans[e][sq]&brd.pieces[c][ROOK] > 0 {
-			value += tarraschBonus[c][row(sq)]
+			terms.add(TERM_PASSED_PAWNS, tarraschBonus[c][MIDGAME][sqRow], tarraschBonus[c][ENDGAME][sqRow])
 		}
 		// pawn race: Assign a bonus if the pawn is closer to its promote square than the enemy king.
 		promoteSquare := pawnPromoteSq[c][sq]
 		if brd.c == c {
 			if chebyshevDistance(sq, promoteSquare) < (chebyshevDistance(enemyKingSq, promoteSquare)) {
-				value += passedPawnBonus[c][row(sq)]
+				terms.add(TERM_PASSED_PAWNS, passedPawnBonus[c][MIDGAME][sqRow],
+					passedPawnBonus[c][ENDGAME][sqRow])
 			}
 		} else {
 			if chebyshevDistance(sq, promoteSquare) < (chebyshevDistance(enemyKingSq, promoteSquare) - 1) {
-				value += passedPawnBonus[c][row(sq)]
+				terms.add(TERM_PASSED_PAWNS, passedPawnBonus[c][MIDGAME][sqRow],
+					passedPawnBonus[c][ENDGAME][sqRow])
 			}
 		}
 	}
-	return value
 }
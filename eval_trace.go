@@ -0,0 +1,116 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Evaluation Trace
+
+// Breaks the static evaluation into its terms for each side, so that misjudged positions can be
+// diagnosed from the console with the 'eval' command. The midgame and endgame values of each term
+// add up to the totals that evaluate combines by the endgame phase, so the trace always agrees with
+// the score returned by evaluate. When the NNUE is in use, the classical terms are still shown for
+// reference, but the total is the scaled network output used by the search.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+var evalTermNames = [EVAL_TERMS]string{"Material", "PST", "Pawn structure", "Passed pawns",
+	"Pawn count", "Bishop pair", "Mobility", "Queen tropism", "King PST", "Pawn shield", "King threats",
+	"Tempo"}
+
+type EvalTrace struct {
+	terms  [2]EvalTerms
+	c      uint8 // side to move.
+	phase  int   // from endgamePhase: 0 in the opening, 256 in the endgame.
+	mg, eg int   // net midgame and endgame values for the side to move.
+	scale  int   // from scaleFactor, in units of 1/SCALE_NORMAL.
+	score  int   // the evaluation from the side to move's point of view.
+	nnue   bool  // true if score is from the network rather than the classical terms.
+	output int   // the unscaled network output, if nnue is set.
+}
+
+// net returns the value of a term for side c, less the value of the same term for its opponent.
+func (t *EvalTrace) net(term, phase int, c uint8) int {
+	return t.terms[c][term][phase] - t.terms[c^1][term][phase]
+}
+
+// traceEval evaluates brd without lazy evaluation or the pawn hash table, recording each term.
+func traceEval(brd *Board) *EvalTrace {
+	c, e := brd.c, brd.Enemy()
+	t := &EvalTrace{c: c, phase: endgamePhase[brd.endgameCounter]}
+	var sq int
+	for side := uint8(BLACK); side <= WHITE; side++ {
+		for pc := PAWN; pc <= KING; pc++ {
+			for b := brd.pieces[side][pc]; b > 0; b.Clear(sq) {
+				sq = lsb(b)
+				if pc != KING {
+					t.terms[side].add(TERM_MATERIAL, pieceValues[pc], pieceValues[pc])
+				}
+				t.terms[side].add(TERM_PST, mainPst[side][MIDGAME][pc][sq], mainPst[side][ENDGAME][pc][sq])
+			}
+		}
+	}
+	t.terms[c].add(TERM_TEMPO, tempoBonus[MIDGAME], tempoBonus[ENDGAME])
+
+	var pentry PawnEntry
+	setPawnStructure(brd, &pentry)
+	for side := uint8(BLACK); side <= WHITE; side++ {
+		mg, eg := pawnStructure(brd, &pentry, side, side^1)
+		t.terms[side].add(TERM_PAWN_STRUCTURE, mg, eg)
+	}
+	netPassedPawns(brd, &pentry, c, e, &t.terms)
+	netMajorPlacement(brd, &pentry, c, e, &t.terms)
+
+	for term := 0; term < EVAL_TERMS; term++ {
+		t.mg += t.net(term, MIDGAME, c)
+		t.eg += t.net(term, ENDGAME, c)
+	}
+	score := weightScore(t.phase, t.mg, t.eg)
+	if evalMode == EVAL_NNUE && network != nil { // the search evaluates with the network instead.
+		t.nnue, t.output = true, network.NewAccumulator(brd).Evaluate(c)
+		score = t.output
+	}
+	strong := c
+	if score < 0 {
+		strong = e
+	}
+	t.scale = scaleFactor(brd, strong)
+	t.score = scaleScore(brd, score)
+	return t
+}
+
+// String returns a table of each term. Net values and totals are from white's point of view.
+func (t *EvalTrace) String() string {
+	var buf bytes.Buffer
+	sign := 1
+	if t.c == BLACK {
+		sign = -1
+	}
+	if t.nnue {
+		buf.WriteString("Classical evaluation (for reference only; the search uses the NNUE):\n")
+	}
+	buf.WriteString("Term            |     White     |     Black     |      Net\n")
+	buf.WriteString("                |    MG     EG  |    MG     EG  |    MG     EG\n")
+	buf.WriteString("----------------+---------------+---------------+--------------\n")
+	for term := 0; term < EVAL_TERMS; term++ {
+		w, b := t.terms[WHITE][term], t.terms[BLACK][term]
+		buf.WriteString(fmt.Sprintf("%-16s|%6d %6d  |%6d %6d  |%6d %6d\n", evalTermNames[term],
+			w[MIDGAME], w[ENDGAME], b[MIDGAME], b[ENDGAME], t.net(term, MIDGAME, WHITE),
+			t.net(term, ENDGAME, WHITE)))
+	}
+	buf.WriteString("----------------+---------------+---------------+--------------\n")
+	buf.WriteString(fmt.Sprintf("Total           |               |               |%6d %6d\n", sign*t.mg,
+		sign*t.eg))
+	buf.WriteString(fmt.Sprintf("Phase: %d/256 (0 = opening, 256 = endgame)\n", t.phase))
+	buf.WriteString(fmt.Sprintf("Tapered: %d\n", sign*weightScore(t.phase, t.mg, t.eg)))
+	if t.nnue {
+		buf.WriteString(fmt.Sprintf("NNUE output: %d\n", sign*t.output))
+	}
+	buf.WriteString(fmt.Sprintf("Scale factor: %d/%d\n", t.scale, SCALE_NORMAL))
+	buf.WriteString(fmt.Sprintf("Total: %d (white side)\n", sign*t.score))
+	return buf.String()
+}
@@ -0,0 +1,54 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEvalTrace(t *testing.T) {
+	paths, err := filepath.Glob("test_suites/*.epd")
+	if err != nil || len(paths) == 0 {
+		t.Fatal("Expected to find the EPD test suites")
+	}
+	w := &Worker{ptt: NewPawnTT()}
+	for _, path := range paths {
+		epds, err := loadEpdFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, epd := range epds {
+			brd := epd.brd
+			brd.worker = w
+			if trace, score := traceEval(brd), evaluate(brd, -INF, INF); trace.score != score {
+				t.Errorf("%s: expected the trace total to be %d, got %d\n%s%s", path, score, trace.score,
+					epd.String(), trace)
+			}
+		}
+	}
+}
+
+func TestEvalTraceNNUE(t *testing.T) {
+	defer func(net *Network, mode int) { network, evalMode = net, mode }(network, evalMode)
+	network, evalMode = randomNetwork(16), EVAL_NNUE
+	epds, err := loadEpdFile("test_suites/wac_150.epd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, epd := range epds {
+		brd := epd.brd
+		brd.nnue = network.NewAccumulator(brd)
+		trace := traceEval(brd)
+		if score := evaluate(brd, -INF, INF); trace.score != score {
+			t.Errorf("Expected the trace total to be %d, got %d\n%s%s", score, trace.score, epd.String(), trace)
+		}
+		if !strings.Contains(trace.String(), "NNUE output") {
+			t.Errorf("Expected the trace to show the NNUE output\n%s", trace)
+		}
+	}
+}
@@ -10,24 +10,46 @@
 // Per-game time control consists of a base amount of time, plus an increment of additional
 // time granted at the beginning of each move.
 
+// When playing on a clock, each search is given a soft limit and a hard limit. The soft limit is
+// checked between iterations, and is extended while the best move is unstable or the score is
+// dropping. The hard limit aborts the search, and is never extended.
+
 package main
 
 import (
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	AVG_MOVES_PER_GAME  = 55
-	MIN_MOVES_REMAINING = 15
-	MAX_TIME            = time.Duration(8) * time.Hour        // default search time limit
-	SAFETY_MARGIN       = time.Duration(5) * time.Millisecond // minimal amount of time to keep on clock
+	AVG_MOVES_PER_GAME    = 55
+	MIN_MOVES_REMAINING   = 15
+	MAX_TIME              = time.Duration(8) * time.Hour        // default search time limit
+	SAFETY_MARGIN         = time.Duration(5) * time.Millisecond // minimal amount of time to keep on clock
+	DEFAULT_MOVE_OVERHEAD = time.Duration(10) * time.Millisecond
+	MAX_MOVE_OVERHEAD     = time.Duration(5) * time.Second
+	HARD_LIMIT_FACTOR     = 3 // the hard limit is at most this multiple of the soft limit.
 )
 
+// Time lost between the engine sending a move and the GUI stopping its clock.
+var moveOverhead = DEFAULT_MOVE_OVERHEAD
+
+// Percentage of the soft limit used, by the number of iterations the best move has been stable.
+var stabilityScale = [5]int{140, 115, 100, 85, 70}
+
+// On ponderhit, the clock is started by the UCI goroutine while the search is running. The clock
+// start and soft limit are read by the search between iterations, and so are accessed atomically.
 type GameTimer struct {
+	clockStart     int64 // when the clock began running in Unix nanoseconds, or zero while pondering.
+	soft           int64 // the soft limit in nanoseconds.
 	inc            [2]time.Duration
 	remaining      [2]time.Duration
+	moveTime       time.Duration // fixed time per move, used instead of the clock if fixedTime is set.
+	fixedTime      bool
 	movesRemaining int
-	startTime      time.Time
+	startTime      time.Time // when the search began.
+	timerMutex     sync.Mutex
 	timer          *time.Timer
 	s              *Search
 	sideToMove     uint8
@@ -42,18 +64,62 @@ func NewGameTimer(movesPlayed int, sideToMove uint8) *GameTimer {
 	}
 }
 
+// SetMoveTime limits the search to exactly timeLimit, regardless of any clock times given.
 func (gt *GameTimer) SetMoveTime(timeLimit time.Duration) {
-	gt.remaining = [2]time.Duration{timeLimit, timeLimit}
-	gt.inc = [2]time.Duration{0, 0}
-	gt.movesRemaining = 1
+	gt.moveTime, gt.fixedTime = timeLimit, true
 }
 
+// Start begins running the clock.  When pondering, the clock starts on ponderhit.
 func (gt *GameTimer) Start() {
-	gt.timer = time.AfterFunc(gt.TimeLimit(), gt.s.Abort)
+	soft, hard := gt.limits()
+	atomic.StoreInt64(&gt.soft, int64(soft))
+	atomic.StoreInt64(&gt.clockStart, time.Now().UnixNano())
+	gt.timerMutex.Lock()
+	gt.timer = time.AfterFunc(hard, gt.s.Abort)
+	gt.timerMutex.Unlock()
+}
+
+// adaptive returns true if the search is playing on a clock, and can decide how much time to use.
+func (gt *GameTimer) adaptive() bool {
+	return !gt.fixedTime && gt.remaining[gt.sideToMove] < MAX_TIME
+}
+
+// limits returns the soft and hard time limits for the current move. Each move is given an equal
+// share of the time left until the next time control, plus most of the increment. The increment is
+// only added once the move is made, so the hard limit leaves a share of the clock for later moves.
+func (gt *GameTimer) limits() (time.Duration, time.Duration) {
+	if gt.fixedTime {
+		limit := maxDuration(0, gt.moveTime-moveOverhead)
+		return limit, limit
+	}
+	if !gt.adaptive() {
+		return MAX_TIME, MAX_TIME
+	}
+	available := maxDuration(0, gt.remaining[gt.sideToMove]-moveOverhead-SAFETY_MARGIN)
+	movesRemaining := time.Duration(max(1, gt.movesRemaining))
+	soft := available/movesRemaining + gt.inc[gt.sideToMove]*3/4
+	hard := available
+	if movesRemaining > 1 {
+		hard = available * 2 / 3
+	}
+	hard = minDuration(hard, soft*HARD_LIMIT_FACTOR)
+	return minDuration(soft, hard), hard
 }
 
-func (gt *GameTimer) TimeLimit() time.Duration {
-	return (gt.remaining[gt.sideToMove] - SAFETY_MARGIN) / time.Duration(gt.movesRemaining)
+// SoftLimitReached is checked after each iteration to decide if another should be started. stable
+// is the number of iterations since the best move last changed, and scoreDrop is how much the score
+// has fallen since the previous iteration.  With only one legal move, there's nothing to decide.
+func (gt *GameTimer) SoftLimitReached(stable, scoreDrop, rootMoves int) bool {
+	clockStart := atomic.LoadInt64(&gt.clockStart)
+	if !gt.adaptive() || clockStart == 0 {
+		return false
+	}
+	if rootMoves == 1 {
+		return true
+	}
+	scale := stabilityScale[min(stable, len(stabilityScale)-1)] + min(max(0, scoreDrop), PAWN_VALUE)
+	soft := time.Duration(atomic.LoadInt64(&gt.soft))
+	return time.Since(time.Unix(0, clockStart)) >= soft*time.Duration(scale)/100
 }
 
 func (gt *GameTimer) Elapsed() time.Duration {
@@ -61,9 +127,25 @@ func (gt *GameTimer) Elapsed() time.Duration {
 }
 
 func (gt *GameTimer) Stop() {
+	gt.timerMutex.Lock()
 	if gt.timer != nil {
 		gt.timer.Stop()
 	}
+	gt.timerMutex.Unlock()
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
 }
 
 //
@@ -0,0 +1,37 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeLimits(t *testing.T) {
+	gt := NewGameTimer(0, WHITE)
+	gt.SetMoveTime(time.Second)
+	if soft, hard := gt.limits(); soft != hard || hard != time.Second-moveOverhead {
+		t.Errorf("Expected both limits to be the move time less the overhead, got %v and %v", soft, hard)
+	}
+
+	gt = NewGameTimer(0, WHITE)
+	gt.remaining[WHITE], gt.remaining[BLACK] = time.Second, time.Minute
+	gt.movesRemaining = 1
+	if _, hard := gt.limits(); hard <= time.Second/2 || hard >= time.Second-moveOverhead {
+		t.Errorf("Expected the last move before the time control to use most of the clock, got %v", hard)
+	}
+
+	gt.movesRemaining = 40
+	soft, hard := gt.limits()
+	gt.inc[WHITE] = 2 * time.Second
+	softInc, hardInc := gt.limits()
+	if softInc <= soft || hardInc <= hard {
+		t.Errorf("Expected the increment to extend the limits")
+	}
+	if hardInc >= time.Second-moveOverhead {
+		t.Errorf("Expected the hard limit to leave time for later moves, got %v", hardInc)
+	}
+}
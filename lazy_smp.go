@@ -0,0 +1,100 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Lazy SMP
+
+// As an alternative to YBWC, each helper worker runs its own iterative deepening search on a
+// copy of the root position. Workers don't communicate except through the shared transposition
+// table, so no split points are created. Helpers skip some iterations according to their index
+// so that workers tend to be searching different depths at any given time. Only the result of the
+// main (root worker) search is reported.
+
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	SEARCH_YBWC = iota // parallel search modes
+	SEARCH_LAZY_SMP
+)
+
+var searchMode = SEARCH_YBWC
+
+// Helper i skips depth d when ((d + skipPhase[i]) / skipSize[i]) is odd.
+var skipSize = [20]int{1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4}
+var skipPhase = [20]int{0, 1, 0, 1, 2, 3, 0, 1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 5, 6, 7}
+
+func parseSearchMode(str string) (int, bool) {
+	switch str {
+	case "YBWC":
+		return SEARCH_YBWC, true
+	case "LazySMP":
+		return SEARCH_LAZY_SMP, true
+	default:
+		return SEARCH_YBWC, false
+	}
+}
+
+func searchModeName(mode int) string {
+	if mode == SEARCH_LAZY_SMP {
+		return "LazySMP"
+	}
+	return "YBWC"
+}
+
+type Helpers struct {
+	sync.WaitGroup
+	nodes int64
+}
+
+// startHelpers launches a helper search for each worker other than the root worker.
+func (s *Search) startHelpers(brd *Board, helpers *Helpers) {
+	for _, w := range loadBalancer.workers[1:] {
+		helper := &Search{
+			SearchParams: s.SearchParams,
+			sideToMove:   s.sideToMove,
+			allowedMoves: s.allowedMoves,
+			history:      s.history,
+			cancel:       s.cancel, // helpers stop when the main search is aborted.
+			bestMove:     NO_MOVE,
+			ponderMove:   NO_MOVE,
+		}
+		// Limits are enforced by the main search. Helpers never abort the search themselves.
+		helper.multiPV, helper.nodeLimit, helper.mateLimit, helper.verbose = 1, 0, 0, false
+		helperBrd := brd.Copy()
+		helperBrd.worker = w
+		helpers.Add(1)
+		go func(i int) {
+			defer helpers.Done()
+			atomic.AddInt64(&helpers.nodes, int64(helper.helperDeepening(helperBrd, i)))
+		}(int(w.index) - 1)
+	}
+}
+
+// helperDeepening searches the root position with a full window at each depth not skipped by the
+// helper, until the search is cancelled. Returns the number of nodes searched.
+func (s *Search) helperDeepening(brd *Board, i int) int {
+	var total, sum int
+	stk := brd.worker.stk
+	inCheck := brd.InCheck()
+	size, phase := skipSize[i%len(skipSize)], skipPhase[i%len(skipPhase)]
+	for d := 1; d <= s.maxDepth; d++ {
+		if ((d+phase)/size)%2 == 1 {
+			continue
+		}
+		stk[0].inCheck = inCheck
+		_, total = s.ybw(brd, stk, -INF, INF, d, 0, Y_PV, SP_NONE, false)
+		sum += total
+		select {
+		case <-s.cancel:
+			return sum
+		default:
+		}
+	}
+	return sum
+}
@@ -9,8 +9,10 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
+	"strings"
 
 	"github.com/pkg/profile"
 )
@@ -50,6 +52,7 @@ func init() {
 	runtime.GOMAXPROCS(numCPU)
 	setupChebyshevDistance()
 	setupMasks()
+	setupSyzygy()
 	setupMagicMoveGen()
 	setupEval()
 	setupRand()
@@ -68,11 +71,40 @@ func printName() {
 var cpuProfileFlag = flag.Bool("cpuprofile", false, "Runs cpu profiler on test suite.")
 var memProfileFlag = flag.Bool("memprofile", false, "Runs memory profiler on test suite.")
 var versionFlag = flag.Bool("version", false, "Prints version number and exits.")
+var lazySMPFlag = flag.Bool("lazysmp", false, "Uses Lazy SMP instead of YBWC for parallel search.")
+var perftFlag = flag.Int("perft", 0, "Runs the perft suite to the given depth (1-6) and exits.")
+var perftHashFlag = flag.Int("perfthash", 0, "Size in MB of the hash table used by -perft. 0 disables hashing.")
+var chess960Flag = flag.Bool("chess960", false, "Sends castling moves in Chess960 notation. With -perft, runs the Chess960 perft suite.")
+var tuneFlag = flag.String("tune", "", "Tunes the evaluation using the labeled positions in the given EPD or PGN file.")
+var tuneOutFlag = flag.String("tuneout", DEFAULT_TUNE_OUTPUT, "File the tuned evaluation parameters are written to by -tune.")
+var evalFileFlag = flag.String("evalfile", "", "Loads the evaluation parameters from the given JSON file.")
+var dumpEvalFlag = flag.String("dumpeval", "", "Writes the current evaluation parameters to the given JSON file and exits.")
 
 func main() {
 	flag.Parse()
+	if *lazySMPFlag {
+		searchMode = SEARCH_LAZY_SMP
+	}
+	chess960 = *chess960Flag
+	if *evalFileFlag != "" {
+		fmt.Print(setEvalFile(*evalFileFlag))
+	}
 	if *versionFlag {
 		printName()
+	} else if *perftFlag > 0 {
+		printName()
+		if chess960 {
+			RunPerftSuite(CHESS960_PERFT_SUITE, *perftFlag, *perftHashFlag)
+		} else {
+			RunPerftSuite(PERFT_SUITE, *perftFlag, *perftHashFlag)
+		}
+	} else if *dumpEvalFlag != "" {
+		if err := writeEvalFile(*dumpEvalFlag); err != nil {
+			fmt.Println(err)
+		}
+	} else if *tuneFlag != "" {
+		printName()
+		RunTuner(*tuneFlag, *tuneOutFlag)
 	} else {
 		if *cpuProfileFlag {
 			printName()
@@ -85,8 +117,18 @@ func main() {
 			// run 'go tool pprof -text --alloc_objects gopher_check mem.pprof > mem_profile.txt' to output profile to text
 			RunTestSuite("test_suites/wac_150.epd", MAX_DEPTH, 5000)
 		} else {
-			uci := NewUCIAdapter()
-			uci.Read(bufio.NewReader(os.Stdin))
+			// Use the XBoard protocol if it's requested by the first command sent by the GUI.
+			// Otherwise, default to UCI.
+			reader := bufio.NewReader(os.Stdin)
+			firstLine, _ := reader.ReadString('\n')
+			reader = bufio.NewReader(io.MultiReader(strings.NewReader(firstLine), reader))
+			if strings.TrimSpace(firstLine) == "xboard" {
+				xb := NewXBoardAdapter()
+				xb.Read(reader)
+			} else {
+				uci := NewUCIAdapter()
+				uci.Read(reader)
+			}
 		}
 	}
 }
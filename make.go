@@ -59,25 +59,14 @@ func makeMove(brd *Board, move Move) {
 		}
 
 	case KING:
+		if capturedPiece == EMPTY && brd.occupied[c]&sqMaskOn[to] > 0 { // king is castling.
+			brd.halfmoveClock = 0
+			makeCastle(brd, from, to, c)
+			break
+		}
 		switch capturedPiece {
 		case EMPTY:
 			brd.halfmoveClock += 1
-			if abs(to-from) == 2 { // king is castling.
-				brd.halfmoveClock = 0
-				if c == WHITE {
-					if to == G1 {
-						relocatePiece(brd, ROOK, H1, F1, c)
-					} else {
-						relocatePiece(brd, ROOK, A1, D1, c)
-					}
-				} else {
-					if to == G8 {
-						relocatePiece(brd, ROOK, H8, F8, c)
-					} else {
-						relocatePiece(brd, ROOK, A8, D8, c)
-					}
-				}
-			}
 		case PAWN:
 			removePiece(brd, capturedPiece, to, brd.Enemy())
 			brd.pawnHashKey ^= pawnZobrist(to, brd.Enemy())
@@ -123,6 +112,9 @@ func makeMove(brd *Board, move Move) {
 		relocatePiece(brd, piece, from, to, c)
 	}
 
+	if c == BLACK {
+		brd.fullmoveNumber++
+	}
 	brd.c ^= 1 // flip the current side to move.
 	brd.hashKey ^= sideKey64
 }
@@ -132,6 +124,9 @@ func unmakeMove(brd *Board, move Move, memento *BoardMemento) {
 	brd.c ^= 1 // flip the current side to move.
 
 	c := brd.c
+	if c == BLACK {
+		brd.fullmoveNumber--
+	}
 	piece := move.Piece()
 	from := move.From()
 	to := move.To()
@@ -172,22 +167,13 @@ func unmakeMove(brd *Board, move Move, memento *BoardMemento) {
 		}
 
 	case KING:
-		unmakeRelocateKing(brd, piece, capturedPiece, to, from, c)
-		if capturedPiece != EMPTY {
-			unmakeAddPiece(brd, capturedPiece, to, brd.Enemy())
-		} else if abs(to-from) == 2 { // king castled.
-			if c == WHITE {
-				if to == G1 {
-					unmakeRelocatePiece(brd, ROOK, F1, H1, WHITE)
-				} else {
-					unmakeRelocatePiece(brd, ROOK, D1, A1, WHITE)
-				}
-			} else {
-				if to == G8 {
-					unmakeRelocatePiece(brd, ROOK, F8, H8, BLACK)
-				} else {
-					unmakeRelocatePiece(brd, ROOK, D8, A8, BLACK)
-				}
+		// If the king moved to a square holding a castling rook, it must have castled.
+		if capturedPiece == EMPTY && memento.castle > 0 && isCastleRook(brd, memento.castle, from, to, c) {
+			unmakeCastle(brd, from, to, c)
+		} else {
+			unmakeRelocateKing(brd, piece, capturedPiece, to, from, c)
+			if capturedPiece != EMPTY {
+				unmakeAddPiece(brd, capturedPiece, to, brd.Enemy())
 			}
 		}
 
@@ -206,30 +192,50 @@ func unmakeMove(brd *Board, move Move, memento *BoardMemento) {
 // Update castling rights whenever a piece moves from or to a square associated with the
 // current castling rights.
 func updateCastleRights(brd *Board, from, to int) {
-	if castle := brd.castle; castle > 0 && (sqMaskOn[from]|sqMaskOn[to])&castleMasks[castle] > 0 {
-		updateCasleRightsForSq(brd, from)
-		updateCasleRightsForSq(brd, to)
+	castle := brd.castle
+	if castle == 0 {
+		return
+	}
+	fromTo := sqMaskOn[from] | sqMaskOn[to]
+	for i := uint8(0); i < 4; i++ {
+		right := uint8(1) << i
+		if castle&right > 0 && fromTo&(brd.pieces[i>>1][KING]|sqMaskOn[brd.castleRooks[i]]) > 0 {
+			brd.castle &= ^right
+		}
+	}
+	if brd.castle != castle { // if brd.castle remains unchanged, hash key will be unchanged.
 		brd.hashKey ^= castleZobrist(castle)
 		brd.hashKey ^= castleZobrist(brd.castle)
 	}
 }
 
-func updateCasleRightsForSq(brd *Board, sq int) {
-	switch sq { // if brd.castle remains unchanged, hash key will be unchanged.
-	case A1:
-		brd.castle &= (^uint8(C_WQ))
-	case E1: // white king starting position
-		brd.castle &= (^uint8(C_WK | C_WQ))
-	case H1:
-		brd.castle &= (^uint8(C_WK))
-	case A8:
-		brd.castle &= (^uint8(C_BQ))
-	case E8: // black king starting position
-		brd.castle &= (^uint8(C_BK | C_BQ))
-	case H8:
-		brd.castle &= (^uint8(C_BK))
-	default:
+func isCastleRook(brd *Board, castle uint8, from, to int, c uint8) bool {
+	i := castleIndex(c, castleSide(from, to))
+	return castle&(uint8(1)<<i) > 0 && int(brd.castleRooks[i]) == to
+}
+
+// The king and rook may start on each other's destination squares, so the rook is removed before
+// the king is relocated.
+func makeCastle(brd *Board, kingFrom, rookFrom int, c uint8) {
+	side := castleSide(kingFrom, rookFrom)
+	kingTo, rookTo := castleKingTo[c][side], castleRookTo[c][side]
+	removePiece(brd, ROOK, rookFrom, c)
+	brd.squares[rookFrom] = EMPTY
+	if kingFrom != kingTo {
+		relocateKing(brd, KING, EMPTY, kingFrom, kingTo, c)
+	}
+	addPiece(brd, ROOK, rookTo, c)
+}
+
+func unmakeCastle(brd *Board, kingFrom, rookFrom int, c uint8) {
+	side := castleSide(kingFrom, rookFrom)
+	kingTo, rookTo := castleKingTo[c][side], castleRookTo[c][side]
+	unmakeRemovePiece(brd, ROOK, rookTo, c)
+	brd.squares[rookTo] = EMPTY
+	if kingFrom != kingTo {
+		unmakeRelocateKing(brd, KING, EMPTY, kingTo, kingFrom, c)
 	}
+	unmakeAddPiece(brd, ROOK, rookFrom, c)
 }
 
 func removePiece(brd *Board, removedPiece Piece, sq int, e uint8) {
@@ -240,7 +246,11 @@ func removePiece(brd *Board, removedPiece Piece, sq int, e uint8) {
 func unmakeRemovePiece(brd *Board, removedPiece Piece, sq int, e uint8) {
 	brd.pieces[e][removedPiece].Clear(sq)
 	brd.occupied[e].Clear(sq)
-	brd.material[e] -= int16(removedPiece.Value() + mainPst[e][removedPiece][sq])
+	brd.material[e][MIDGAME] -= int16(removedPiece.Value() + mainPst[e][MIDGAME][removedPiece][sq])
+	brd.material[e][ENDGAME] -= int16(removedPiece.Value() + mainPst[e][ENDGAME][removedPiece][sq])
+	if brd.nnue != nil {
+		brd.nnue.remove(e, removedPiece, sq)
+	}
 	brd.endgameCounter -= endgameCountValues[removedPiece]
 }
 
@@ -253,7 +263,11 @@ func unmakeAddPiece(brd *Board, addedPiece Piece, sq int, c uint8) {
 	brd.pieces[c][addedPiece].Add(sq)
 	brd.squares[sq] = addedPiece
 	brd.occupied[c].Add(sq)
-	brd.material[c] += int16(addedPiece.Value() + mainPst[c][addedPiece][sq])
+	brd.material[c][MIDGAME] += int16(addedPiece.Value() + mainPst[c][MIDGAME][addedPiece][sq])
+	brd.material[c][ENDGAME] += int16(addedPiece.Value() + mainPst[c][ENDGAME][addedPiece][sq])
+	if brd.nnue != nil {
+		brd.nnue.add(c, addedPiece, sq)
+	}
 	brd.endgameCounter += endgameCountValues[addedPiece]
 }
 
@@ -269,7 +283,11 @@ func unmakeRelocatePiece(brd *Board, piece Piece, from, to int, c uint8) {
 	brd.occupied[c] ^= fromTo
 	brd.squares[from] = EMPTY
 	brd.squares[to] = piece
-	brd.material[c] += int16(mainPst[c][piece][to] - mainPst[c][piece][from])
+	brd.material[c][MIDGAME] += int16(mainPst[c][MIDGAME][piece][to] - mainPst[c][MIDGAME][piece][from])
+	brd.material[c][ENDGAME] += int16(mainPst[c][ENDGAME][piece][to] - mainPst[c][ENDGAME][piece][from])
+	if brd.nnue != nil {
+		brd.nnue.move(c, piece, from, to)
+	}
 }
 
 func relocateKing(brd *Board, piece, capturedPiece Piece, from, to int, c uint8) {
@@ -284,4 +302,7 @@ func unmakeRelocateKing(brd *Board, piece, capturedPiece Piece, from, to int, c
 	brd.occupied[c] ^= fromTo
 	brd.squares[from] = EMPTY
 	brd.squares[to] = piece
+	if brd.nnue != nil {
+		brd.nnue.move(c, piece, from, to)
+	}
 }
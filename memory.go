@@ -7,11 +7,13 @@ package main
 
 import (
 	"sync/atomic"
+	"unsafe"
 )
 
 const (
-	SLOT_COUNT = 1048576        // number of main TT slots. 4 buckets per slot.
-	TT_MASK    = SLOT_COUNT - 1 // a set bitmask used to index into TT.
+	DEFAULT_HASH_MB = 64    // default main TT size in megabytes. 1048576 slots, 4 buckets per slot.
+	MIN_HASH_MB     = 1     // smallest main TT size that can be requested via the UCI Hash option.
+	MAX_HASH_MB     = 65536 // largest main TT size that can be requested via the UCI Hash option.
 )
 
 const (
@@ -30,20 +32,92 @@ const (
 	UPPER_BOUND
 )
 
-var mainTt TT
+var mainTt *TT
 
+// Draw scores stored in the main TT include contempt, and so are relative to the side to move at the
+// root of the search that stored them. ttDrawScore is the score of a draw with the root side to move.
+var ttDrawScore int
+
+// resetMainTt clears all entries from the main TT, allocating it at the default size if needed.
 func resetMainTt() {
-	for i := 0; i < SLOT_COUNT; i++ {
+	if mainTt == nil {
+		mainTt = NewTT(DEFAULT_HASH_MB)
+	}
+	mainTt.Clear()
+}
+
+// syncMainTtDraws clears the main TT if its stored draw scores were computed for the other root side
+// or for a different contempt setting.
+func syncMainTtDraws(drawScore int) {
+	if drawScore != ttDrawScore {
+		ttDrawScore = drawScore
+		resetMainTt()
+	}
+}
+
+// resizeMainTt replaces the main TT with an empty table of the requested size. This must only be
+// called between searches.  Any goroutine still holding the old table will continue to use it safely
+// until it's garbage collected.
+func resizeMainTt(mb int) {
+	if mainTt == nil || mainTt.SizeMB() != mb {
+		tt := NewTT(mb)
+		tt.Clear()
+		mainTt = tt
+	}
+}
+
+// The TT is heap allocated with a power-of-two number of slots, so that a slot can be selected by
+// masking the low-order bits of the hash key.
+type TT struct {
+	slots  []Slot
+	mask   uint64 // a set bitmask used to index into TT.
+	sizeMB int
+}
+
+type Slot [4]Bucket // sized to fit in a single cache line
+
+// NewTT allocates the largest power-of-two table that fits in the given number of megabytes.
+func NewTT(mb int) *TT {
+	mb = max(MIN_HASH_MB, min(mb, MAX_HASH_MB))
+	maxSlots := (uint64(mb) << 20) / uint64(unsafe.Sizeof(Slot{}))
+	slotCount := uint64(1)
+	for slotCount<<1 <= maxSlots {
+		slotCount <<= 1
+	}
+	return &TT{
+		slots:  make([]Slot, slotCount),
+		mask:   slotCount - 1,
+		sizeMB: mb,
+	}
+}
+
+func (tt *TT) Clear() {
+	emptyData := NewData(NO_MOVE, 0, EXACT, NO_SCORE, 511)
+	for i := range tt.slots {
 		for j := 0; j < 4; j++ {
-			// main_tt[i][j].key = uint64(0)
-			// main_tt[i][j].data = uint64(NewData(NO_MOVE, 0, EXACT, NO_SCORE, 511))
-			mainTt[i][j].Store(NewData(NO_MOVE, 0, EXACT, NO_SCORE, 511), uint64(0))
+			tt.slots[i][j].Store(emptyData, uint64(0))
 		}
 	}
 }
 
-type TT [SLOT_COUNT]Slot
-type Slot [4]Bucket // sized to fit in a single cache line
+func (tt *TT) SizeMB() int {
+	return tt.sizeMB
+}
+
+// HashFull estimates how full the table is in permille, by sampling the first 1000 buckets for
+// entries written or accessed by the current search.
+func (tt *TT) HashFull() int {
+	count := 0
+	for i := 0; i < 250; i++ {
+		for j := 0; j < 4; j++ {
+			data, key := tt.slots[i][j].Load()
+			if data^key != 0 && data.Id() == searchId { // cleared entries have a hash key of 0.
+				count++
+			}
+		}
+	}
+	return count
+}
 
 // data stores the following: (54 bits total)
 // depth remaining - 5 bits
@@ -96,7 +170,7 @@ func (data BucketData) NewID(id int) BucketData {
 }
 
 func (tt *TT) getSlot(hashKey uint64) *Slot {
-	return &tt[hashKey&TT_MASK]
+	return &tt.slots[hashKey&tt.mask]
 }
 
 // Use Hyatt's lockless hashing approach to avoid having to lock/unlock shared TT memory
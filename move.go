@@ -21,6 +21,7 @@ type Move uint32
 // Piece - next 3 bits
 // Captured piece - next 3 bits
 // promoted to - next 3 bits
+// Castling is encoded as the king moving to the starting square of its rook.
 
 func (m Move) From() int {
 	return int(uint32(m) & uint32(63))
@@ -85,8 +86,8 @@ func (m Move) ToUCI() string {
 	if !m.IsMove() {
 		return "0000"
 	}
-	str := ParseCoordinates(row(m.From()), column(m.From())) +
-		ParseCoordinates(row(m.To()), column(m.To()))
+	to := uciCastleTo(m)
+	str := ParseCoordinates(row(m.From()), column(m.From())) + ParseCoordinates(row(to), column(to))
 	if m.PromotedTo() != EMPTY {
 		str += pieceChars[m.PromotedTo()]
 	}
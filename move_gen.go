@@ -14,30 +14,10 @@ func getNonCaptures(brd *Board, htable *HistoryTable, remainingMoves *MoveList)
 	var m Move
 
 	// Castles
-	castle := brd.castle
-	if castle > uint8(0) { // get_non_captures is only called when not in check.
-		e := brd.Enemy()
-		if c == WHITE {
-			if (castle&C_WQ > uint8(0)) && castleQueensideIntervening[WHITE]&occ == 0 &&
-				!isAttackedBy(brd, occ, C1, e, c) && !isAttackedBy(brd, occ, D1, e, c) {
-				m = NewRegularMove(E1, C1, KING)
-				remainingMoves.Push(SortItem{htable.Probe(KING, c, C1) | 1, m})
-			}
-			if (castle&C_WK > uint8(0)) && castleKingsideIntervening[WHITE]&occ == 0 &&
-				!isAttackedBy(brd, occ, F1, e, c) && !isAttackedBy(brd, occ, G1, e, c) {
-				m = NewRegularMove(E1, G1, KING)
-				remainingMoves.Push(SortItem{htable.Probe(KING, c, G1) | 1, m})
-			}
-		} else {
-			if (castle&C_BQ > uint8(0)) && castleQueensideIntervening[BLACK]&occ == 0 &&
-				!isAttackedBy(brd, occ, C8, e, c) && !isAttackedBy(brd, occ, D8, e, c) {
-				m = NewRegularMove(E8, C8, KING)
-				remainingMoves.Push(SortItem{htable.Probe(KING, c, C8) | 1, m})
-			}
-			if (castle&C_BK > uint8(0)) && castleKingsideIntervening[BLACK]&occ == 0 &&
-				!isAttackedBy(brd, occ, F8, e, c) && !isAttackedBy(brd, occ, G8, e, c) {
-				m = NewRegularMove(E8, G8, KING)
-				remainingMoves.Push(SortItem{htable.Probe(KING, c, G8) | 1, m})
+	if brd.castle > uint8(0) { // get_non_captures is only called when not in check.
+		for side := CASTLE_KINGSIDE; side <= CASTLE_QUEENSIDE; side++ {
+			if m = brd.castleMove(side); m != NO_MOVE {
+				remainingMoves.Push(SortItem{htable.Probe(KING, c, castleKingTo[c][side]) | 1, m})
 			}
 		}
 	}
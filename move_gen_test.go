@@ -25,25 +25,6 @@ func TestLegalMoveGen(t *testing.T) {
 // 	legal_movegen(PerftValidation, StartPos(), depth, legal_max_tree[depth], true)
 // }
 
-// func TestPerftSuite(t *testing.T) {
-// 	depth := 6
-// 	testPositions, err := loadEpdFile("test_suites/perftsuite.epd") // http://www.rocechess.ch/perft.html
-// 	if err != nil {
-// 		panic("could not load epd file")
-// 	}
-//
-// 	for i, epd := range testPositions {
-// 		if expected, ok := epd.nodeCount[depth]; ok {
-// 			fmt.Printf("%d.", i+1)
-// 			epd.brd.Print()
-// 			fmt.Println(epd.fen)
-// 			legalMovegen(Perft, epd.brd, depth, expected, false)
-// 		}
-// 	}
-// }
-
-// TODO: add parallelism
-
 func legalMovegen(fn func(*Board, *HistoryTable, Stack, int, int) int, brd *Board, depth, expected int, verbose bool) {
 	htable := new(HistoryTable)
 	copy := brd.Copy()
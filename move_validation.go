@@ -34,8 +34,8 @@ func (brd *Board) PseudolegalAvoidsCheck(m Move) bool {
 		}
 	case KNIGHT: // Knights can never move when pinned.
 		return isPinned(brd, brd.AllOccupied(), m.From(), brd.c, brd.Enemy()) == BB(ANY_SQUARE_MASK)
-	case KING:
-		return !isAttackedBy(brd, brd.AllOccupied(), m.To(), brd.Enemy(), brd.c)
+	case KING: // castling moves are only generated if legal.
+		return brd.IsCastle(m) || !isAttackedBy(brd, brd.AllOccupied(), m.To(), brd.Enemy(), brd.c)
 	default:
 		return pinnedCanMove(brd, m.From(), m.To(), brd.c, brd.Enemy())
 	}
@@ -87,14 +87,14 @@ func (brd *Board) ValidMove(m Move, inCheck bool) bool {
 	if !m.IsMove() {
 		return false
 	}
-	c, e := brd.c, brd.Enemy()
+	c := brd.c
 	piece, from, to, capturedPiece := m.Piece(), m.From(), m.To(), m.CapturedPiece()
 	// Check that the piece is of the correct type and color.
 	if brd.TypeAt(from) != piece || brd.pieces[c][piece]&sqMaskOn[from] == 0 {
 		// fmt.Printf("No piece of this type available at from square!{%s}", m.ToString())
 		return false
 	}
-	if sqMaskOn[to]&brd.occupied[c] > 0 {
+	if sqMaskOn[to]&brd.occupied[c] > 0 && piece != KING { // the king may castle.
 		// fmt.Printf("To square occupied by own piece!{%s}", m.ToString())
 		return false
 	}
@@ -133,40 +133,10 @@ func (brd *Board) ValidMove(m Move, inCheck bool) bool {
 		}
 
 	case KING:
-
-		if abs(to-from) == 2 { // validate castle moves
-			if inCheck {
-				return false
-			}
-			occ := brd.AllOccupied()
-			castle := brd.castle
-			if c == WHITE {
-				switch to {
-				case C1:
-					if (castle&C_WQ > uint8(0)) && castleQueensideIntervening[WHITE]&occ == 0 &&
-						!isAttackedBy(brd, occ, C1, e, c) && !isAttackedBy(brd, occ, D1, e, c) {
-						return true
-					}
-				case G1:
-					if (castle&C_WK > uint8(0)) && castleKingsideIntervening[WHITE]&occ == 0 &&
-						!isAttackedBy(brd, occ, F1, e, c) && !isAttackedBy(brd, occ, G1, e, c) {
-						return true
-					}
-				}
-			} else {
-				switch to {
-				case C8:
-					if (castle&C_BQ > uint8(0)) && castleQueensideIntervening[BLACK]&occ == 0 &&
-						!isAttackedBy(brd, occ, C8, e, c) && !isAttackedBy(brd, occ, D8, e, c) {
-						return true
-					}
-				case G8:
-					if (castle&C_BK > uint8(0)) && castleKingsideIntervening[BLACK]&occ == 0 &&
-						!isAttackedBy(brd, occ, F8, e, c) && !isAttackedBy(brd, occ, G8, e, c) {
-						return true
-					}
-				}
-			}
+		if sqMaskOn[to]&brd.occupied[c] > 0 { // validate castle moves
+			return !inCheck && capturedPiece == EMPTY && brd.castleMove(castleSide(from, to)) == m
+		}
+		if kingMasks[from]&sqMaskOn[to] == 0 {
 			return false
 		}
 	case KNIGHT:
@@ -178,3 +148,16 @@ func (brd *Board) ValidMove(m Move, inCheck bool) bool {
 	}
 	return brd.TypeAt(to) == capturedPiece
 }
+
+// Returns all legal moves available to the side to move.  Intended for use outside the main search
+// (e.g. at the root or when parsing input), where move ordering doesn't matter.
+func (brd *Board) LegalMoves() []Move {
+	var moves []Move
+	var thisStk StackItem
+	recycler := NewRecycler(0)
+	selector := NewMoveSelector(brd, &thisStk, new(HistoryTable), brd.InCheck(), NO_MOVE)
+	for m, _ := selector.Next(recycler, SP_NONE); m != NO_MOVE; m, _ = selector.Next(recycler, SP_NONE) {
+		moves = append(moves, m)
+	}
+	return moves
+}
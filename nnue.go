@@ -0,0 +1,257 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// NNUE Evaluation
+
+// An efficiently updatable neural network can be used in place of the classical evaluation:
+// https://chessprogramming.wikispaces.com/NNUE
+
+// The network has 768 inputs, one for each combination of side (friendly or enemy), piece type and
+// square, seen from each side's perspective. Black's perspective is flipped vertically, so that the
+// same weights apply to both sides. The inputs feed a single hidden layer of N neurons, computed
+// separately for each perspective. Because only a few inputs change with each move, the hidden layer
+// (the accumulator) is updated incrementally by addPiece, removePiece and relocatePiece rather than
+// being recalculated at each node.
+
+// To evaluate a position, the side to move's accumulator and then its opponent's are passed through
+// a clipped ReLU (0 to NNUE_QA), and combined by the output layer into a single score.
+
+// Network File Format
+
+// All values are little-endian.
+//   magic           4 bytes   "GCNN"
+//   version         uint32    NNUE_VERSION
+//   hidden size N   uint32    1 to NNUE_MAX_HIDDEN
+//   feature weights int16     768 x N, ordered by input. Input index = (side*6 + piece)*64 + square,
+//                             where side is 0 for friendly pieces and 1 for enemy pieces, piece is
+//                             PAWN (0) through KING (5), and square is a1 = 0 through h8 = 63.
+//   feature biases  int16     N
+//   output weights  int16     2N, for the side to move's accumulator followed by its opponent's.
+//   output bias     int32
+// Feature weights and biases are quantized by NNUE_QA, and output weights by NNUE_QB. The output
+// bias is quantized by NNUE_QA * NNUE_QB.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	NNUE_MAGIC      = "GCNN"
+	NNUE_VERSION    = 1
+	NNUE_INPUTS     = 768
+	NNUE_MAX_HIDDEN = 4096
+	NNUE_QA         = 255 // activation quantization (clipped ReLU ceiling).
+	NNUE_QB         = 64  // output weight quantization.
+	NNUE_SCALE      = 400 // converts the network output to centipawns.
+)
+
+const (
+	EVAL_CLASSICAL = iota // evaluation modes
+	EVAL_NNUE
+)
+
+var evalMode = EVAL_CLASSICAL
+var network *Network // the loaded network, or nil.
+
+func parseEvalMode(str string) (int, bool) {
+	switch str {
+	case "Classical":
+		return EVAL_CLASSICAL, true
+	case "NNUE":
+		return EVAL_NNUE, true
+	default:
+		return EVAL_CLASSICAL, false
+	}
+}
+
+type Network struct {
+	hidden         int
+	featureWeights []int16
+	featureBias    []int16
+	outputWeights  []int16
+	outputBias     int32
+}
+
+// Accumulator holds the hidden layer for each perspective, indexed by color.
+type Accumulator struct {
+	net    *Network
+	values [2][]int16
+}
+
+// setNetworkPath loads the network at path, and returns a message describing the result. If the
+// network can't be loaded, the classical evaluation is used.
+func setNetworkPath(path string) string {
+	if path == "" || path == "<empty>" {
+		network, evalMode = nil, EVAL_CLASSICAL
+		return "NNUE disabled\n"
+	}
+	net, err := LoadNetwork(path)
+	if err != nil {
+		network, evalMode = nil, EVAL_CLASSICAL
+		return err.Error() + "\n"
+	}
+	network = net
+	return fmt.Sprintf("loaded network with %d hidden neurons\n", net.hidden)
+}
+
+func LoadNetwork(path string) (*Network, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("network file could not be read: %s", path))
+	}
+	defer f.Close()
+	net, err := readNetwork(bufio.NewReader(f))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %s", path, err))
+	}
+	return net, nil
+}
+
+func readNetwork(r io.Reader) (*Network, error) {
+	var header struct {
+		Magic   [4]byte
+		Version uint32
+		Hidden  uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, errors.New("missing header")
+	}
+	if string(header.Magic[:]) != NNUE_MAGIC {
+		return nil, errors.New("not a network file")
+	}
+	if header.Version != NNUE_VERSION {
+		return nil, errors.New(fmt.Sprintf("unsupported version %d (expected %d)", header.Version,
+			NNUE_VERSION))
+	}
+	if header.Hidden < 1 || header.Hidden > NNUE_MAX_HIDDEN {
+		return nil, errors.New(fmt.Sprintf("hidden size must be between 1 and %d", NNUE_MAX_HIDDEN))
+	}
+	hidden := int(header.Hidden)
+	net := &Network{
+		hidden:         hidden,
+		featureWeights: make([]int16, NNUE_INPUTS*hidden),
+		featureBias:    make([]int16, hidden),
+		outputWeights:  make([]int16, 2*hidden),
+	}
+	for _, data := range []interface{}{net.featureWeights, net.featureBias, net.outputWeights,
+		&net.outputBias} {
+		if err := binary.Read(r, binary.LittleEndian, data); err != nil {
+			return nil, errors.New("file is too short for its hidden size")
+		}
+	}
+	if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+		return nil, errors.New("file is too long for its hidden size")
+	}
+	return net, nil
+}
+
+// nnueInput returns the input index of a piece of color c on sq, from perspective's point of view.
+func nnueInput(perspective, c uint8, piece Piece, sq int) int {
+	side := 0
+	if c != perspective {
+		side = 1
+	}
+	if perspective == BLACK {
+		sq ^= 56 // flip vertically.
+	}
+	return (side*6+int(piece))*64 + sq
+}
+
+// NewAccumulator calculates the hidden layer for brd from scratch.
+func (net *Network) NewAccumulator(brd *Board) *Accumulator {
+	acc := &Accumulator{net: net}
+	for perspective := range acc.values {
+		acc.values[perspective] = make([]int16, net.hidden)
+		copy(acc.values[perspective], net.featureBias)
+	}
+	var sq int
+	for c := uint8(BLACK); c <= WHITE; c++ {
+		for pc := Piece(PAWN); pc <= KING; pc++ {
+			for b := brd.pieces[c][pc]; b > 0; b.Clear(sq) {
+				sq = lsb(b)
+				acc.add(c, pc, sq)
+			}
+		}
+	}
+	return acc
+}
+
+func (acc *Accumulator) Copy() *Accumulator {
+	if acc == nil {
+		return nil
+	}
+	cp := &Accumulator{net: acc.net}
+	for perspective := range acc.values {
+		cp.values[perspective] = append([]int16(nil), acc.values[perspective]...)
+	}
+	return cp
+}
+
+// add activates the input for a piece of color c on sq.
+func (acc *Accumulator) add(c uint8, piece Piece, sq int) {
+	for perspective := range acc.values {
+		values := acc.values[perspective]
+		offset := nnueInput(uint8(perspective), c, piece, sq) * len(values)
+		weights := acc.net.featureWeights[offset : offset+len(values)]
+		for i := range values {
+			values[i] += weights[i]
+		}
+	}
+}
+
+// remove deactivates the input for a piece of color c on sq.
+func (acc *Accumulator) remove(c uint8, piece Piece, sq int) {
+	for perspective := range acc.values {
+		values := acc.values[perspective]
+		offset := nnueInput(uint8(perspective), c, piece, sq) * len(values)
+		weights := acc.net.featureWeights[offset : offset+len(values)]
+		for i := range values {
+			values[i] -= weights[i]
+		}
+	}
+}
+
+// move updates the accumulator for a piece of color c moving from one square to another.
+func (acc *Accumulator) move(c uint8, piece Piece, from, to int) {
+	for perspective := range acc.values {
+		values := acc.values[perspective]
+		fromOffset := nnueInput(uint8(perspective), c, piece, from) * len(values)
+		toOffset := nnueInput(uint8(perspective), c, piece, to) * len(values)
+		fromWeights := acc.net.featureWeights[fromOffset : fromOffset+len(values)]
+		toWeights := acc.net.featureWeights[toOffset : toOffset+len(values)]
+		for i := range values {
+			values[i] += toWeights[i] - fromWeights[i]
+		}
+	}
+}
+
+// Evaluate runs the output layer, and returns the score for the side to move c.
+func (acc *Accumulator) Evaluate(c uint8) int {
+	net, us, them := acc.net, acc.values[c], acc.values[c^1]
+	sum := 0
+	for i, v := range us {
+		sum += clippedReLU(v) * int(net.outputWeights[i])
+	}
+	for i, v := range them {
+		sum += clippedReLU(v) * int(net.outputWeights[net.hidden+i])
+	}
+	return (sum + int(net.outputBias)) * NNUE_SCALE / (NNUE_QA * NNUE_QB)
+}
+
+func clippedReLU(v int16) int {
+	if v < 0 {
+		return 0
+	} else if v > NNUE_QA {
+		return NNUE_QA
+	}
+	return int(v)
+}
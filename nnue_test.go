@@ -0,0 +1,136 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeNetwork saves net in the network file format.
+func writeNetwork(w io.Writer, net *Network) error {
+	header := struct {
+		Magic   [4]byte
+		Version uint32
+		Hidden  uint32
+	}{Version: NNUE_VERSION, Hidden: uint32(net.hidden)}
+	copy(header.Magic[:], NNUE_MAGIC)
+	for _, data := range []interface{}{&header, net.featureWeights, net.featureBias, net.outputWeights,
+		net.outputBias} {
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func randomNetwork(hidden int) *Network {
+	r := rand.New(rand.NewSource(1))
+	net := &Network{
+		hidden:         hidden,
+		featureWeights: make([]int16, NNUE_INPUTS*hidden),
+		featureBias:    make([]int16, hidden),
+		outputWeights:  make([]int16, 2*hidden),
+		outputBias:     int32(r.Intn(2000) - 1000),
+	}
+	for _, values := range [][]int16{net.featureWeights, net.featureBias, net.outputWeights} {
+		for i := range values {
+			values[i] = int16(r.Intn(129) - 64)
+		}
+	}
+	return net
+}
+
+func TestLoadNetwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopher_check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer setNetworkPath("")
+
+	net := randomNetwork(16)
+	var buf bytes.Buffer
+	if err = writeNetwork(&buf, net); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	path := filepath.Join(dir, "net.nnue")
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	setNetworkPath(path)
+	if network == nil {
+		t.Fatal("Expected the network to be loaded")
+	}
+	brd := ParseFENString("r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4")
+	if expected, score := net.NewAccumulator(brd).Evaluate(brd.c),
+		network.NewAccumulator(brd).Evaluate(brd.c); score != expected {
+		t.Errorf("Expected the loaded network to score %d, got %d", expected, score)
+	}
+
+	badMagic := append([]byte("XXXX"), data[4:]...)
+	badVersion := append([]byte(nil), data...)
+	badVersion[4] = NNUE_VERSION + 1
+	invalid := map[string][]byte{
+		"bad magic":   badMagic,
+		"bad version": badVersion,
+		"no header":   data[:6],
+		"truncated":   data[:len(data)-1],
+		"too long":    append(append([]byte(nil), data...), 0),
+	}
+	for desc, contents := range invalid {
+		if _, err = readNetwork(bytes.NewReader(contents)); err == nil {
+			t.Errorf("Expected an error reading a network file (%s)", desc)
+		}
+	}
+	setNetworkPath(filepath.Join(dir, "missing.nnue"))
+	if network != nil || evalMode != EVAL_CLASSICAL {
+		t.Errorf("Expected the classical evaluation to be used after failing to load a network")
+	}
+}
+
+// checkAccumulator verifies that the incrementally updated accumulator matches one calculated
+// from scratch after every move to the given depth.
+func checkAccumulator(t *testing.T, brd *Board, depth int) {
+	fresh := brd.nnue.net.NewAccumulator(brd)
+	for c := range fresh.values {
+		for i, v := range fresh.values[c] {
+			if brd.nnue.values[c][i] != v {
+				t.Fatalf("Accumulator doesn't match after incremental updates:\n%s", brd.FEN())
+			}
+		}
+	}
+	if depth == 0 {
+		return
+	}
+	memento := brd.NewMemento()
+	for _, m := range perftMoves(brd) {
+		makeMove(brd, m)
+		checkAccumulator(t, brd, depth-1)
+		unmakeMove(brd, m, memento)
+	}
+}
+
+func TestIncrementalAccumulator(t *testing.T) {
+	net := randomNetwork(8)
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", // castling
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",                            // en passant
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",                              // promotions
+	}
+	for _, fen := range fens {
+		brd := ParseFENString(fen)
+		brd.nnue = net.NewAccumulator(brd)
+		checkAccumulator(t, brd, 3)
+	}
+}
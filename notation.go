@@ -13,17 +13,37 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
+// EPD (Extended Position Description) records a position along with a list of operations, each
+// consisting of an opcode and its operands: https://www.chessprogramming.org/Extended_Position_Description
+// Supported opcodes: bm and am (best moves and moves to avoid, in SAN), id, ce (centipawn evaluation
+// for the side to move), acd and acn (analysis depth and node count), pv (in SAN), comments c0-c9,
+// hmvc and fmvn (halfmove clock and fullmove number), and perft node counts D1-D99.
 type EPD struct {
 	brd        *Board
 	bestMoves  []string
 	avoidMoves []string
+	pv         []string
 	nodeCount  map[int]int
+	comments   [10]string
 	id         string
 	fen        string
+	ce         int // NO_SCORE if the position hasn't been evaluated.
+	acd, acn   int // 0 if the position hasn't been analyzed.
+}
+
+func NewEPD(brd *Board) *EPD {
+	return &EPD{
+		brd:       brd,
+		fen:       brd.epdPosition(),
+		nodeCount: make(map[int]int),
+		ce:        NO_SCORE,
+	}
 }
 
 func (epd *EPD) Print() {
@@ -44,64 +64,199 @@ func loadEpdFile(dir string) ([]*EPD, error) {
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("The specified EPD file could not be loaded.:\n%s\n", dir))
 	}
+	defer epdFile.Close()
 	var testPositions []*EPD
 	scanner := bufio.NewScanner(epdFile)
-	for scanner.Scan() {
-		epd := ParseEPDString(scanner.Text())
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		epd, err := ParseEPDString(scanner.Text())
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s line %d: %s", dir, line, err))
+		}
 		testPositions = append(testPositions, epd)
 	}
 	return testPositions, err
 }
 
+// writeEpdFile writes one EPD record per line to the file at path, replacing any existing file.
+func writeEpdFile(path string, epds []*EPD) error {
+	epdFile, err := os.Create(path)
+	if err != nil {
+		return errors.New(fmt.Sprintf("The specified EPD file could not be created.:\n%s\n", path))
+	}
+	defer epdFile.Close()
+	writer := bufio.NewWriter(epdFile)
+	for _, epd := range epds {
+		if _, err = writer.WriteString(epd.String() + "\n"); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// String returns the EPD record for epd. Operations are written in a fixed order, and only if set.
+// Example: 2k4B/bpp1qp2/p1b5/7p/1PN1n1p1/2Pr4/P5PP/R3QR1K b - - bm Ng3+ g3; id "WAC.273";
+func (epd *EPD) String() string {
+	var ops []string
+	addOp := func(opcode string, operands ...string) {
+		ops = append(ops, strings.Join(append([]string{opcode}, operands...), " ")+";")
+	}
+	if len(epd.bestMoves) > 0 {
+		addOp("bm", epd.bestMoves...)
+	}
+	if len(epd.avoidMoves) > 0 {
+		addOp("am", epd.avoidMoves...)
+	}
+	if epd.id != "" {
+		addOp("id", strconv.Quote(epd.id))
+	}
+	if epd.ce != NO_SCORE {
+		addOp("ce", strconv.Itoa(epd.ce))
+	}
+	if epd.acd > 0 {
+		addOp("acd", strconv.Itoa(epd.acd))
+	}
+	if epd.acn > 0 {
+		addOp("acn", strconv.Itoa(epd.acn))
+	}
+	if len(epd.pv) > 0 {
+		addOp("pv", epd.pv...)
+	}
+	for i, comment := range epd.comments {
+		if comment != "" {
+			addOp(fmt.Sprintf("c%d", i), strconv.Quote(comment))
+		}
+	}
+	if epd.brd.halfmoveClock > 0 {
+		addOp("hmvc", strconv.Itoa(int(epd.brd.halfmoveClock)))
+	}
+	if epd.brd.fullmoveNumber > 1 {
+		addOp("fmvn", strconv.Itoa(int(epd.brd.fullmoveNumber)))
+	}
+	var depths []int
+	for d := range epd.nodeCount {
+		depths = append(depths, d)
+	}
+	sort.Ints(depths)
+	for _, d := range depths {
+		addOp(fmt.Sprintf("D%d", d), strconv.Itoa(epd.nodeCount[d]))
+	}
+	return strings.Join(append([]string{epd.brd.epdPosition()}, ops...), " ")
+}
+
+var perftOpcode = regexp.MustCompile("^D[1-9][0-9]?$")
+var commentOpcode = regexp.MustCompile("^c[0-9]$")
+var numericField = regexp.MustCompile("^[0-9]+$")
+
 // 2k4B/bpp1qp2/p1b5/7p/1PN1n1p1/2Pr4/P5PP/R3QR1K b - - bm Ng3+ g3; id "WAC.273";
-func ParseEPDString(str string) *EPD {
+// The halfmove clock and fullmove number may optionally follow the first four (position) fields.
+func ParseEPDString(str string) (*EPD, error) {
 	epd := &EPD{
 		nodeCount: make(map[int]int),
+		ce:        NO_SCORE,
 	}
-	epdFields := strings.Split(str, ";")
-	fenFields := strings.Split(epdFields[0], " ")
-
-	epd.brd = ParseFENSlice(fenFields[:4])
-	epd.fen = strings.Join(fenFields[:4], " ")
-
-	bm := regexp.MustCompile("bm")
-	am := regexp.MustCompile("am")
-	id := regexp.MustCompile("id")
-	depth := regexp.MustCompile("D[1-9][0-9]?")
-	var loc []int
-	var subFields []string
-	var d, nodeCount int64
-	for _, field := range epdFields {
-		loc = bm.FindStringIndex(field)
-		if loc != nil {
-			field = field[loc[1]:]
-			subFields = strings.Split(field, " ")
-			epd.bestMoves = append(epd.bestMoves, subFields...)
-			continue
-		}
-		loc = am.FindStringIndex(field)
-		if loc != nil {
-			field = field[:loc[1]+1]
-			subFields = strings.Split(field, " ")
-			epd.avoidMoves = append(epd.avoidMoves, subFields...)
+	ops := splitEpdOperations(str)
+	if len(ops) == 0 || len(ops[0]) < 4 {
+		return nil, errors.New(fmt.Sprintf("Invalid EPD: %s", str))
+	}
+	fenFields := append([]string(nil), ops[0][:4]...)
+	ops[0] = ops[0][4:]
+	for i := 0; i < 2 && len(ops[0]) > 0 && numericField.MatchString(ops[0][0]); i++ {
+		fenFields = append(fenFields, ops[0][0])
+		ops[0] = ops[0][1:]
+	}
+	for _, op := range ops {
+		if len(op) == 0 {
 			continue
 		}
-		loc = id.FindStringIndex(field)
-		if loc != nil {
-			subFields = strings.Split(field, " ")
-			epd.id = strings.Join(subFields[2:], "")
+		opcode, operands := op[0], op[1:]
+		switch {
+		case opcode == "bm":
+			epd.bestMoves = append(epd.bestMoves, operands...)
+		case opcode == "am":
+			epd.avoidMoves = append(epd.avoidMoves, operands...)
+		case opcode == "pv":
+			epd.pv = operands
+		case opcode == "id":
+			epd.id = strings.Join(operands, " ")
+		case opcode == "ce" && len(operands) > 0:
+			epd.ce, _ = strconv.Atoi(operands[0])
+		case opcode == "acd" && len(operands) > 0:
+			epd.acd, _ = strconv.Atoi(operands[0])
+		case opcode == "acn" && len(operands) > 0:
+			epd.acn, _ = strconv.Atoi(operands[0])
+		case opcode == "hmvc" && len(operands) > 0:
+			fenFields = setFenField(fenFields, 4, operands[0])
+		case opcode == "fmvn" && len(operands) > 0:
+			fenFields = setFenField(fenFields, 5, operands[0])
+		case commentOpcode.MatchString(opcode):
+			epd.comments[opcode[1]-'0'] = strings.Join(operands, " ")
+		case perftOpcode.MatchString(opcode) && len(operands) > 0: // map each depth to expected node count
+			d, _ := strconv.Atoi(opcode[1:])
+			epd.nodeCount[d], _ = strconv.Atoi(operands[0])
 		}
+	}
+	var err error
+	if epd.brd, err = ParseFENSlice(fenFields); err != nil {
+		return nil, err
+	}
+	epd.fen = strings.Join(fenFields[:4], " ")
+	return epd, nil
+}
 
-		loc = depth.FindStringIndex(field)
-		if loc != nil { // map each depth to expected node count
-			// fmt.Println(field)
-			subFields = strings.Split(field, " ")
-			d, _ = strconv.ParseInt(subFields[0][1:], 10, 64)
-			nodeCount, _ = strconv.ParseInt(subFields[1], 10, 64)
-			epd.nodeCount[int(d)] = int(nodeCount)
+// setFenField sets one of the optional FEN fields (4: halfmove clock, 5: fullmove number),
+// filling in defaults for any optional fields preceding it.
+func setFenField(fenFields []string, i int, value string) []string {
+	for len(fenFields) <= i {
+		fenFields = append(fenFields, [2]string{"0", "1"}[len(fenFields)-4])
+	}
+	fenFields[i] = value
+	return fenFields
+}
+
+// splitEpdOperations splits an EPD record into operations, each given as a list of fields.
+// Operations are terminated by semicolons. Quoted strings are returned as a single field with
+// the quotes removed. The position fields are included at the start of the first operation.
+func splitEpdOperations(str string) [][]string {
+	var ops [][]string
+	var op []string
+	var field []rune
+	inField, inQuote := false, false
+	endField := func() {
+		if inField {
+			op = append(op, string(field))
+		}
+		field, inField = field[:0], false
+	}
+	for _, r := range str {
+		switch {
+		case inQuote:
+			if r == '"' {
+				inQuote = false
+				endField()
+			} else {
+				field = append(field, r)
+			}
+		case r == '"':
+			endField()
+			inQuote, inField = true, true
+		case r == ';':
+			endField()
+			ops = append(ops, op)
+			op = nil
+		case r == ' ' || r == '\t':
+			endField()
+		default:
+			field, inField = append(field, r), true
 		}
 	}
-	return epd
+	endField()
+	if len(op) > 0 {
+		ops = append(ops, op)
+	}
+	return ops
 }
 
 var sanChars = [8]string{"P", "N", "B", "R", "Q", "K"}
@@ -114,12 +269,11 @@ func ToSAN(brd *Board, m Move) string { // convert move to Standard Algebraic No
 		return PawnSAN(brd, m, san)
 	}
 
-	if piece == KING {
-		if to-from == 2 { // kingside castling
-			return "O-O"
-		} else if to-from == -2 { // queenside castling
-			return "O-O-O"
+	if brd.IsCastle(m) {
+		if castleSide(from, to) == CASTLE_KINGSIDE {
+			return "O-O" + CheckSuffix(brd, m)
 		}
+		return "O-O-O" + CheckSuffix(brd, m)
 	}
 
 	if m.IsCapture() {
@@ -152,34 +306,31 @@ func ToSAN(brd *Board, m Move) string { // convert move to Standard Algebraic No
 		}
 	}
 
-	if GivesCheck(brd, m) {
-		san += "+"
-	}
-	san = sanChars[piece] + san
+	san = sanChars[piece] + san + CheckSuffix(brd, m)
 	return san
 }
 
 func PawnSAN(brd *Board, m Move, san string) string {
 	if m.IsPromotion() {
-		san += sanChars[m.PromotedTo()]
+		san += "=" + sanChars[m.PromotedTo()]
 	}
-	if m.IsCapture() {
-		from, to := m.From(), m.To()
-		san = "x" + san
-		// disambiguate capturing pawn
-		if brd.TypeAt(to) == EMPTY { // en passant
-			san = columnNames[column(from)] + san
-		} else {
-			t := pawnAttackMasks[brd.Enemy()][to] & brd.pieces[brd.c][PAWN]
-			if popCount(t) > 1 {
-				san = columnNames[column(from)] + san
-			}
-		}
+	if m.IsCapture() { // pawn captures always include the file of the capturing pawn.
+		san = columnNames[column(m.From())] + "x" + san
 	}
-	if GivesCheck(brd, m) {
-		san += "+"
+	return san + CheckSuffix(brd, m)
+}
+
+// CheckSuffix returns "#" if m checkmates the opponent, "+" if m gives check, and "" otherwise.
+func CheckSuffix(brd *Board, m Move) string {
+	memento := brd.NewMemento()
+	makeMove(brd, m)
+	defer unmakeMove(brd, m, memento)
+	if !brd.InCheck() {
+		return ""
+	} else if len(brd.LegalMoves()) == 0 {
+		return "#"
 	}
-	return san
+	return "+"
 }
 
 func GivesCheck(brd *Board, m Move) bool {
@@ -190,38 +341,180 @@ func GivesCheck(brd *Board, m Move) bool {
 	return inCheck
 }
 
-func ParseFENSlice(fenFields []string) *Board {
-	brd := EmptyBoard()
+// Groups: piece, origin file, origin rank, capture, destination square, promotion piece.
+var sanPattern = regexp.MustCompile("^([NBRQK])?([a-h])?([1-8])?(x)?([a-h][1-8])(?:=?([NBRQ]))?$")
 
-	ParsePlacement(brd, fenFields[0])
-	brd.c = ParseSide(fenFields[1])
-	brd.castle = ParseCastleRights(brd, fenFields[2])
-	brd.hashKey ^= castleZobrist(brd.castle)
-	if len(fenFields) > 3 {
-		brd.enpTarget = ParseEnpTarget(fenFields[3])
-		if len(fenFields) > 4 {
-			brd.halfmoveClock = ParseHalfmoveClock(fenFields[4])
+// ParseSAN converts a move given in Standard Algebraic Notation (SAN) to a legal move for brd.
+// Castling may be given as O-O or 0-0. Check, mate, and annotation suffixes (+, #, !, ?) are ignored.
+func ParseSAN(brd *Board, san string) (Move, error) {
+	str := strings.TrimRight(san, "+#!?")
+	if str == "0-0" || str == "0-0-0" {
+		str = strings.Replace(str, "0", "O", -1)
+	}
+	var candidates []Move
+	switch str {
+	case "O-O", "O-O-O":
+		side := CASTLE_KINGSIDE
+		if str == "O-O-O" {
+			side = CASTLE_QUEENSIDE
+		}
+		for _, m := range brd.LegalMoves() {
+			if brd.IsCastle(m) && castleSide(m.From(), m.To()) == side {
+				candidates = append(candidates, m)
+			}
+		}
+	default:
+		fields := sanPattern.FindStringSubmatch(str)
+		if fields == nil {
+			return NO_MOVE, errors.New(fmt.Sprintf("Invalid SAN move: %s", san))
+		}
+		piece, promotedTo := Piece(PAWN), Piece(EMPTY)
+		if fields[1] != "" {
+			piece = Piece(fenPieceChars[strings.ToLower(fields[1])])
+		}
+		if fields[6] != "" {
+			promotedTo = Piece(fenPieceChars[strings.ToLower(fields[6])])
+		}
+		to := ParseSquare(fields[5])
+		for _, m := range perftMoves(brd) { // include underpromotions.
+			if m.Piece() != piece || m.To() != to || m.PromotedTo() != promotedTo ||
+				(fields[2] != "" && columnNames[column(m.From())] != fields[2]) ||
+				(fields[3] != "" && strconv.Itoa(row(m.From())+1) != fields[3]) ||
+				(fields[4] != "" && !m.IsCapture()) {
+				continue
+			}
+			candidates = append(candidates, m)
 		}
 	}
-	brd.hashKey ^= enpZobrist(brd.enpTarget)
-	return brd
+	switch len(candidates) {
+	case 0:
+		return NO_MOVE, errors.New(fmt.Sprintf("Illegal SAN move: %s", san))
+	case 1:
+		return candidates[0], nil
+	default:
+		return NO_MOVE, errors.New(fmt.Sprintf("Ambiguous SAN move: %s (%d legal moves match)", san,
+			len(candidates)))
+	}
 }
 
-func ParseFENString(str string) *Board {
-	brd := EmptyBoard()
-	fenFields := strings.Split(str, " ")
+var fenChars = [2][6]string{
+	{"p", "n", "b", "r", "q", "k"},
+	{"P", "N", "B", "R", "Q", "K"},
+}
+
+// FEN returns the Forsyth-Edwards Notation string for brd.
+func (brd *Board) FEN() string {
+	return fmt.Sprintf("%s %d %d", brd.epdPosition(), brd.halfmoveClock, brd.fullmoveNumber)
+}
+
+// epdPosition returns the first four FEN fields: placement, side to move, castling rights, and the
+// en passant target square.
+func (brd *Board) epdPosition() string {
+	var placement string
+	for r := 7; r >= 0; r-- {
+		emptyCount := 0
+		for col := 0; col < 8; col++ {
+			sq := Square(r, col)
+			pc := brd.squares[sq]
+			if pc == EMPTY {
+				emptyCount += 1
+				continue
+			}
+			if emptyCount > 0 {
+				placement += strconv.Itoa(emptyCount)
+				emptyCount = 0
+			}
+			if brd.occupied[WHITE]&sqMaskOn[sq] > 0 {
+				placement += fenChars[WHITE][pc]
+			} else {
+				placement += fenChars[BLACK][pc]
+			}
+		}
+		if emptyCount > 0 {
+			placement += strconv.Itoa(emptyCount)
+		}
+		if r > 0 {
+			placement += "/"
+		}
+	}
+	side := "b"
+	if brd.c == WHITE {
+		side = "w"
+	}
+	castle := brd.castleString()
+	enpTarget := "-"
+	if brd.enpTarget != SQ_INVALID { // FEN gives the square passed over by the pawn.
+		if brd.c == WHITE {
+			enpTarget = SquareString(int(brd.enpTarget) + 8)
+		} else {
+			enpTarget = SquareString(int(brd.enpTarget) - 8)
+		}
+	}
+	return strings.Join([]string{placement, side, castle, enpTarget}, " ")
+}
 
-	ParsePlacement(brd, fenFields[0])
+var fenCastleRights = regexp.MustCompile("^(-|[KQkqA-Ha-h]+)$")
+var fenEnpTarget = regexp.MustCompile("^(-|[a-h][36])$")
+
+// ParseFENSlice parses the fields of a FEN string. The halfmove clock and fullmove number are
+// optional. An error is returned if the fields don't describe a legal position.
+func ParseFENSlice(fenFields []string) (*Board, error) {
+	if len(fenFields) < 4 {
+		return nil, errors.New(fmt.Sprintf("Invalid FEN: %s", strings.Join(fenFields, " ")))
+	}
+	fen := strings.Join(fenFields[:4], " ")
+	brd := EmptyBoard()
+	if err := ParsePlacement(brd, fenFields[0]); err != nil {
+		return nil, err
+	}
+	if popCount(brd.pieces[WHITE][KING]) != 1 || popCount(brd.pieces[BLACK][KING]) != 1 {
+		return nil, errors.New(fmt.Sprintf("Each side must have one king: %s", fen))
+	}
+	if (brd.pieces[WHITE][PAWN]|brd.pieces[BLACK][PAWN])&(rowMasks[0]|rowMasks[7]) > 0 {
+		return nil, errors.New(fmt.Sprintf("Pawns can't be placed on the first or last rank: %s", fen))
+	}
+	if fenFields[1] != "w" && fenFields[1] != "b" {
+		return nil, errors.New(fmt.Sprintf("Invalid side to move: %s", fen))
+	}
 	brd.c = ParseSide(fenFields[1])
+	if brd.c == BLACK { // makeMove toggles sideKey64, so positions with white to move don't include it.
+		brd.hashKey ^= sideKey64
+	}
+	if isAttackedBy(brd, brd.AllOccupied(), brd.KingSq(brd.Enemy()), brd.c, brd.Enemy()) {
+		return nil, errors.New(fmt.Sprintf("The side not to move is in check: %s", fen))
+	}
+	if !fenCastleRights.MatchString(fenFields[2]) {
+		return nil, errors.New(fmt.Sprintf("Invalid castling rights: %s", fen))
+	}
 	brd.castle = ParseCastleRights(brd, fenFields[2])
 	brd.hashKey ^= castleZobrist(brd.castle)
 
-	brd.enpTarget = ParseEnpTarget(fenFields[3])
+	if !fenEnpTarget.MatchString(fenFields[3]) {
+		return nil, errors.New(fmt.Sprintf("Invalid en passant target: %s", fen))
+	}
+	brd.enpTarget = ParseEnpTarget(fenFields[3], brd.c)
+	if brd.enpTarget != SQ_INVALID && (fenFields[3][1] != "36"[brd.c] ||
+		brd.pieces[brd.Enemy()][PAWN]&sqMaskOn[brd.enpTarget] == 0) {
+		return nil, errors.New(fmt.Sprintf("Invalid en passant target: %s", fen))
+	}
 	brd.hashKey ^= enpZobrist(brd.enpTarget)
 
 	if len(fenFields) > 4 {
 		brd.halfmoveClock = ParseHalfmoveClock(fenFields[4])
 	}
+	if len(fenFields) > 5 {
+		brd.fullmoveNumber = ParseFullmoveNumber(fenFields[5])
+	}
+	return brd, nil
+}
+
+// ParseFENString is intended for FEN strings known to be valid, and panics if str can't be parsed.
+// Input from the GUI or from files should be parsed using ParseFENSlice.
+func ParseFENString(str string) *Board {
+	brd, err := ParseFENSlice(strings.Fields(str))
+	if err != nil {
+		panic(err)
+	}
 	return brd
 }
 
@@ -240,29 +533,37 @@ var fenPieceChars = map[string]int{
 	"K": 13,
 }
 
-func ParsePlacement(brd *Board, str string) {
-	var rowStr string
+func ParsePlacement(brd *Board, str string) error {
 	rowFields := strings.Split(str, "/")
-	sq := 0
-	matchDigit, _ := regexp.Compile(`\d`)
-	for row := len(rowFields) - 1; row >= 0; row-- {
-		rowStr = rowFields[row]
-		for _, r := range rowStr {
+	if len(rowFields) != 8 {
+		return errors.New(fmt.Sprintf("Invalid piece placement: %s", str))
+	}
+	for row := 0; row < 8; row++ {
+		col := 0
+		for _, r := range rowFields[7-row] {
 			chr := string(r)
-			if matchDigit.MatchString(chr) {
-				digit, _ := strconv.ParseInt(chr, 10, 5)
-				sq += int(digit)
-			} else {
-				c := uint8(fenPieceChars[chr] >> 3)
-				pieceType := Piece(fenPieceChars[chr] & 7)
-				addPiece(brd, pieceType, sq, c) // place the piece on the board.
-				if pieceType == PAWN {
-					brd.pawnHashKey ^= pawnZobrist(sq, c)
-				}
-				sq += 1
+			if '1' <= r && r <= '8' {
+				col += int(r - '0')
+				continue
+			}
+			pc, ok := fenPieceChars[chr]
+			if !ok || col > 7 {
+				return errors.New(fmt.Sprintf("Invalid piece placement: %s", str))
+			}
+			c := uint8(pc >> 3)
+			pieceType := Piece(pc & 7)
+			sq := Square(row, col)
+			addPiece(brd, pieceType, sq, c) // place the piece on the board.
+			if pieceType == PAWN {
+				brd.pawnHashKey ^= pawnZobrist(sq, c)
 			}
+			col += 1
+		}
+		if col != 8 {
+			return errors.New(fmt.Sprintf("Invalid piece placement: %s", str))
 		}
 	}
+	return nil
 }
 
 func ParseSide(str string) uint8 {
@@ -276,34 +577,95 @@ func ParseSide(str string) uint8 {
 	}
 }
 
+// ParseCastleRights accepts standard, Shredder-FEN and X-FEN castling fields. Shredder-FEN gives the
+// file of each castling rook. In X-FEN, K and Q refer to the outermost rook on each side of the king,
+// and a file is given only when the castling rook isn't the outermost rook on its side. The
+// starting square of each castling rook is stored in brd. Rights without a matching king and rook
+// are ignored.
 func ParseCastleRights(brd *Board, str string) uint8 {
 	var castle uint8
-	if str != "-" {
-		match, _ := regexp.MatchString("K", str)
-		if match {
-			castle |= C_WK
+	if str == "-" {
+		return castle
+	}
+	for _, r := range str {
+		c, backRank := uint8(WHITE), 0
+		if unicode.IsLower(r) {
+			c, backRank = BLACK, 7
 		}
-		match, _ = regexp.MatchString("Q", str)
-		if match {
-			castle |= C_WQ
+		kings := brd.pieces[c][KING] & rowMasks[backRank]
+		if kings == 0 {
+			continue
 		}
-		match, _ = regexp.MatchString("k", str)
-		if match {
-			castle |= C_BK
+		kingSq := lsb(kings)
+		rooks := brd.pieces[c][ROOK] & rowMasks[backRank]
+		switch chr := unicode.ToLower(r); {
+		case chr == 'k':
+			rooks &= ^((sqMaskOn[kingSq] << 1) - 1) // rooks on the kingside of the king
+			if rooks == 0 {
+				continue
+			}
+			rooks = sqMaskOn[msb(rooks)]
+		case chr == 'q':
+			rooks &= sqMaskOn[kingSq] - 1
+			if rooks == 0 {
+				continue
+			}
+			rooks = sqMaskOn[lsb(rooks)]
+		case 'a' <= chr && chr <= 'h':
+			rooks &= columnMasks[chr-'a']
+			if rooks == 0 {
+				continue
+			}
+		default:
+			continue
 		}
-		match, _ = regexp.MatchString("q", str)
-		if match {
-			castle |= C_BQ
+		rookSq := lsb(rooks)
+		i := castleIndex(c, castleSide(kingSq, rookSq))
+		brd.castleRooks[i] = uint8(rookSq)
+		castle |= uint8(1) << i
+	}
+	return castle
+}
+
+// castleString returns the castling field in X-FEN, which is the same as standard FEN unless there's
+// another rook beyond a castling rook.
+func (brd *Board) castleString() string {
+	castle := ""
+	for _, c := range [2]uint8{WHITE, BLACK} {
+		for _, side := range [2]int{CASTLE_KINGSIDE, CASTLE_QUEENSIDE} {
+			i := castleIndex(c, side)
+			if brd.castle&(uint8(1)<<i) == 0 {
+				continue
+			}
+			rookSq := int(brd.castleRooks[i])
+			beyond := ^((sqMaskOn[rookSq] << 1) - 1)
+			if side == CASTLE_QUEENSIDE {
+				beyond = sqMaskOn[rookSq] - 1
+			}
+			chr := string("kq"[side])
+			if beyond&rowMasks[row(rookSq)]&brd.pieces[c][ROOK] > 0 {
+				chr = columnNames[column(rookSq)]
+			}
+			if c == WHITE {
+				chr = strings.ToUpper(chr)
+			}
+			castle += chr
 		}
 	}
+	if castle == "" {
+		castle = "-"
+	}
 	return castle
 }
 
-func ParseEnpTarget(str string) uint8 {
+// FEN gives the square passed over by the pawn, but enpTarget stores the square of the pawn itself.
+func ParseEnpTarget(str string, c uint8) uint8 {
 	if str == "-" {
 		return SQ_INVALID
+	} else if c == WHITE {
+		return uint8(ParseSquare(str) - 8)
 	} else {
-		return uint8(ParseSquare(str))
+		return uint8(ParseSquare(str) + 8)
 	}
 }
 
@@ -317,28 +679,47 @@ func ParseHalfmoveClock(str string) uint8 {
 	}
 }
 
-func ParseMove(brd *Board, str string) Move {
-	// make sure the move is valid.
-	if !IsMove(str) {
-		return NO_MOVE
+// ParseFullmoveNumber returns 1 if str isn't a valid fullmove number.
+func ParseFullmoveNumber(str string) uint16 {
+	fullmoveNumber, err := strconv.ParseUint(str, 10, 16)
+	if err != nil || fullmoveNumber == 0 {
+		return 1
 	}
+	return uint16(fullmoveNumber)
+}
 
+// ParseMove converts a move given in coordinate notation (e.g. e7e8q) to a legal move for brd.
+func ParseMove(brd *Board, str string) (Move, error) {
+	if !IsMove(str) {
+		return NO_MOVE, errors.New(fmt.Sprintf("Invalid move: %s", str))
+	}
 	from := ParseSquare(str[:2])
 	to := ParseSquare(str[2:4])
 	piece := brd.TypeAt(from)
-	capturedPiece := brd.TypeAt(to)
-	if piece == PAWN && capturedPiece == EMPTY { // check for en-passant capture
-		if abs(to-from) == 9 || abs(to-from) == 7 {
-			capturedPiece = PAWN // en-passant capture detected.
+	var m Move
+	if piece == KING && brd.occupied[brd.c]&sqMaskOn[to] > 0 { // king captures its own rook
+		m = NewRegularMove(from, to, KING)
+	} else if piece == KING && !chess960 && row(from) == row(to) && abs(to-from) == 2 { // castling
+		m = NewRegularMove(from, int(brd.castleRooks[castleIndex(brd.c, castleSide(from, to))]), KING)
+	} else {
+		capturedPiece := brd.TypeAt(to)
+		if piece == PAWN && capturedPiece == EMPTY { // check for en-passant capture
+			if abs(to-from) == 9 || abs(to-from) == 7 {
+				capturedPiece = PAWN // en-passant capture detected.
+			}
+		}
+		promotedTo := Piece(EMPTY)
+		if len(str) == 5 { // check for promotion.
+			promotedTo = Piece(fenPieceChars[string(str[4])]) // will always be lowercase.
 		}
+		m = NewMove(from, to, piece, capturedPiece, promotedTo)
 	}
-	var promotedTo Piece
-	if len(str) == 5 { // check for promotion.
-		promotedTo = Piece(fenPieceChars[string(str[4])]) // will always be lowercase.
-	} else {
-		promotedTo = Piece(EMPTY)
+	for _, legalMove := range perftMoves(brd) {
+		if m == legalMove {
+			return m, nil
+		}
 	}
-	return NewMove(from, to, piece, capturedPiece, promotedTo)
+	return NO_MOVE, errors.New(fmt.Sprintf("Illegal move: %s", str))
 }
 
 // A1 through H8.  test with Regexp.
@@ -358,7 +739,7 @@ var columnNames = [8]string{"a", "b", "c", "d", "e", "f", "g", "h"}
 
 // create regular expression to match valid move string.
 func IsMove(str string) bool {
-	match, _ := regexp.MatchString("[a-h][1-8][a-h][1-8][nbrq]?", str)
+	match, _ := regexp.MatchString("^[a-h][1-8][a-h][1-8][nbrq]?$", str)
 	return match
 }
 
@@ -7,6 +7,9 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
 	"testing"
 )
 
@@ -20,3 +23,173 @@ func TestEPDParsing(t *testing.T) {
 		epd.Print()
 	}
 }
+
+func TestFEN(t *testing.T) {
+	brd := StartPos()
+	for _, str := range []string{"e2e4", "c7c5", "g1f3"} {
+		makeMove(brd, mustParseMove(t, brd, str))
+	}
+	brd.halfmoveClock = 1
+	expected := "rnbqkbnr/pp1ppppp/8/2p5/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2"
+	if fen := brd.FEN(); fen != expected {
+		t.Errorf("Expected FEN %s, got %s", expected, fen)
+	}
+	move, memento := mustParseMove(t, brd, "d7d5"), brd.NewMemento()
+	makeMove(brd, move)
+	expected = "rnbqkbnr/pp2pppp/8/2pp4/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq d6 0 3"
+	if fen := brd.FEN(); fen != expected {
+		t.Errorf("Expected FEN %s, got %s", expected, fen)
+	}
+	if !CompareBoards(brd, ParseFENString(brd.FEN())) {
+		t.Errorf("Board parsed from %s does not match the original", brd.FEN())
+	}
+	unmakeMove(brd, move, memento)
+	expected = "rnbqkbnr/pp1ppppp/8/2p5/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2"
+	if fen := brd.FEN(); fen != expected {
+		t.Errorf("Expected FEN %s after unmaking d7d5, got %s", expected, fen)
+	}
+}
+
+func TestFullmoveNumber(t *testing.T) {
+	for _, fen := range []string{"4k3/8/8/8/8/8/4P3/4K3 b - - 0 40", "4k3/8/8/8/8/8/4P3/4K3 w - - 3 112"} {
+		if got := ParseFENString(fen).FEN(); got != fen {
+			t.Errorf("Expected FEN %s, got %s", fen, got)
+		}
+		epd, err := ParseEPDString(NewEPD(ParseFENString(fen)).String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := epd.brd.FEN(); got != fen {
+			t.Errorf("Expected EPD position %s, got %s", fen, got)
+		}
+	}
+	if got := ParseFENString("4k3/8/8/8/8/8/4P3/4K3 w - - 0 x").fullmoveNumber; got != 1 {
+		t.Errorf("Expected an invalid fullmove number to default to 1, got %d", got)
+	}
+}
+
+func TestEPDWriter(t *testing.T) {
+	var test []*EPD
+	for _, path := range []string{"test_suites/wac_300.epd", "test_suites/null_move.epd", PERFT_SUITE} {
+		epds, err := loadEpdFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test = append(test, epds...)
+	}
+	epd := NewEPD(StartPos())
+	epd.bestMoves, epd.pv, epd.id = []string{"e4"}, []string{"e4", "e5", "Nf3"}, "start position"
+	epd.ce, epd.acd, epd.acn, epd.comments[3] = -15, 12, 1234567, "comment; with a semicolon"
+	test = append(test, epd)
+
+	f, err := ioutil.TempFile("", "epd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	if err = writeEpdFile(f.Name(), test); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := loadEpdFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(test) {
+		t.Fatalf("Expected %d EPD records, got %d", len(test), len(parsed))
+	}
+	for i, epd := range test {
+		if !CompareBoards(epd.brd, parsed[i].brd) {
+			t.Errorf("Board parsed from %s does not match the original", epd.String())
+		}
+		if !reflect.DeepEqual(epd.bestMoves, parsed[i].bestMoves) || !reflect.DeepEqual(epd.pv, parsed[i].pv) ||
+			!reflect.DeepEqual(epd.nodeCount, parsed[i].nodeCount) || epd.id != parsed[i].id ||
+			epd.comments != parsed[i].comments || epd.ce != parsed[i].ce || epd.acd != parsed[i].acd ||
+			epd.acn != parsed[i].acn {
+			t.Errorf("Expected operations %s, got %s", epd.String(), parsed[i].String())
+		}
+	}
+}
+
+func TestParseSAN(t *testing.T) {
+	test, err := loadEpdFile("test_suites/all.epd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, epd := range test {
+		for _, san := range append(epd.bestMoves, epd.avoidMoves...) {
+			if _, err := ParseSAN(epd.brd, san); err != nil {
+				t.Errorf("%s: %s", epd.id, err)
+			}
+		}
+		for _, m := range epd.brd.LegalMoves() {
+			san := ToSAN(epd.brd, m)
+			if parsed, err := ParseSAN(epd.brd, san); err != nil || parsed != m {
+				t.Errorf("%s: expected %s to be parsed as %s, got %s (%v)", epd.id, san, m.ToUCI(),
+					parsed.ToUCI(), err)
+			}
+		}
+	}
+	brd := ParseFENString("r3k2r/1P4P1/8/3p4/2N1P1N1/8/8/R3K2R w KQkq - 0 1")
+	tests := []struct {
+		san, uci string
+	}{
+		{"O-O", "e1g1"}, {"0-0-0+", "e1c1"}, {"exd5!?", "e4d5"}, {"Nce5", "c4e5"}, {"Rab1", "a1b1"},
+		{"b8=Q", "b7b8q"}, {"bxa8=N+", "b7a8n"}, {"gxh8R", "g7h8r"}, {"g8=B", "g7g8b"}, {"Kd1", "e1d1"},
+	}
+	for _, test := range tests {
+		if m, err := ParseSAN(brd, test.san); err != nil || m.ToUCI() != test.uci {
+			t.Errorf("Expected %s to be parsed as %s, got %s (%v)", test.san, test.uci, m.ToUCI(), err)
+		}
+	}
+	for _, san := range []string{"Ne5", "e6", "Nxe5", "Qd4", "b8", "Ke3", "O-O-O-O", "exd5xx"} {
+		if m, err := ParseSAN(brd, san); err == nil {
+			t.Errorf("Expected an error for %s, got %s", san, m.ToUCI())
+		}
+	}
+}
+
+func TestChess960Castling(t *testing.T) {
+	defer func(enabled bool) { chess960 = enabled }(chess960)
+	tests := []struct {
+		fen, xfen string
+	}{
+		{"qnr1bkrb/pppp2pp/3np3/5p2/8/P2P2P1/NPP1PP1P/QN1RBKRB w GDg - 3 9",
+			"qnr1bkrb/pppp2pp/3np3/5p2/8/P2P2P1/NPP1PP1P/QN1RBKRB w KQk - 3 9"},
+		{"1r2k2r/8/8/8/8/8/8/RR2K2R w HBhb - 0 1", "1r2k2r/8/8/8/8/8/8/RR2K2R w KBkq - 0 1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w AHah - 0 1", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1"},
+	}
+	for _, test := range tests {
+		brd := ParseFENString(test.fen)
+		if brd.FEN() != test.xfen {
+			t.Errorf("Expected %s to be written as %s, got %s", test.fen, test.xfen, brd.FEN())
+		}
+		if other := ParseFENString(brd.FEN()); other.castle != brd.castle ||
+			other.castleRooks != brd.castleRooks {
+			t.Errorf("Castling rights for %s don't match after parsing %s", test.fen, brd.FEN())
+		}
+	}
+
+	brd := ParseFENString("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	for _, test := range []struct {
+		uci, uci960 string
+	}{{"e1g1", "e1h1"}, {"e1c1", "e1a1"}} {
+		chess960 = false
+		m := mustParseMove(t, brd, test.uci)
+		if !brd.IsCastle(m) || m.ToUCI() != test.uci {
+			t.Errorf("Expected %s to be parsed as a castling move, got %s", test.uci, m.ToString())
+		}
+		chess960 = true
+		if m.ToUCI() != test.uci960 || mustParseMove(t, brd, test.uci960) != m {
+			t.Errorf("Expected %s to be sent as %s, got %s", test.uci, test.uci960, m.ToUCI())
+		}
+	}
+}
+
+func mustParseMove(t *testing.T, brd *Board, str string) Move {
+	m, err := ParseMove(brd, str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
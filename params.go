@@ -0,0 +1,121 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Tuning Parameters
+
+// Search and evaluation parameters are exposed to the GUI as UCI spin options, so that they can be
+// tuned by external tools such as SPSA.  Parameters may only be changed between searches.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	minSplit         = 2              // Do not begin parallel search below this depth.
+	fPruneMax        = 2              // Do not use futility pruning when above this depth.
+	lmrMin           = 2              // Do not use late move reductions below this depth.
+	iidMin           = 4              // Do not use internal iterative deepening below this depth.
+	nullMoveMin      = 3              // Do not use null-move pruning below this depth.
+	minCheckDepth    = -2             // During Q-Search, consider all evasions when in check at or above this depth.
+	aspirationMin    = 4              // Do not use aspiration windows below this depth.
+	aspirationWindow = PAWN_VALUE / 4 // Initial half-width of the aspiration window.
+	contempt         = 0              // The value of a draw to the opponent of the side to move at the root.
+
+	lazyEvalMargin = BISHOP_VALUE
+
+	// Midgame and endgame values.
+	tempoBonus      = [2]int{5, 5}
+	doubledPenalty  = [2]int{20, 20}
+	isolatedPenalty = [2]int{12, 12}
+	backwardPenalty = [2]int{4, 4}
+)
+
+type TuningParam struct {
+	name     string
+	value    *int
+	linked   *int // set along with value, or nil.
+	min, max int
+	onChange func() // called after the value changes, or nil.
+	def      int    // the built-in value, reported as the option's default.
+}
+
+var tuningParams = []TuningParam{
+	{"MinSplitDepth", &minSplit, nil, 1, MAX_DEPTH, nil, minSplit},
+	{"FutilityMaxDepth", &fPruneMax, nil, 0, 8, nil, fPruneMax},
+	{"LMRMinDepth", &lmrMin, nil, 1, MAX_DEPTH, nil, lmrMin},
+	{"IIDMinDepth", &iidMin, nil, 2, MAX_DEPTH, nil, iidMin},
+	{"NullMoveMinDepth", &nullMoveMin, nil, 1, MAX_DEPTH, nil, nullMoveMin},
+	{"QSearchCheckDepth", &minCheckDepth, nil, -8, 0, nil, minCheckDepth},
+	{"AspirationMinDepth", &aspirationMin, nil, 1, MAX_DEPTH, nil, aspirationMin},
+	{"AspirationWindow", &aspirationWindow, nil, 1, QUEEN_VALUE, nil, aspirationWindow},
+	{"Contempt", &contempt, nil, -QUEEN_VALUE, QUEEN_VALUE, nil, contempt},
+	{"LazyEvalMargin", &lazyEvalMargin, nil, 0, QUEEN_VALUE, nil, lazyEvalMargin},
+	{"TempoBonusMidgame", &tempoBonus[MIDGAME], nil, 0, 100, nil, tempoBonus[MIDGAME]},
+	{"TempoBonusEndgame", &tempoBonus[ENDGAME], nil, 0, 100, nil, tempoBonus[ENDGAME]},
+	{"DoubledPawnPenaltyMidgame", &doubledPenalty[MIDGAME], nil,
+		0, 100, clearPawnTables, doubledPenalty[MIDGAME]},
+	{"DoubledPawnPenaltyEndgame", &doubledPenalty[ENDGAME], nil,
+		0, 100, clearPawnTables, doubledPenalty[ENDGAME]},
+	{"IsolatedPawnPenaltyMidgame", &isolatedPenalty[MIDGAME], nil,
+		0, 100, clearPawnTables, isolatedPenalty[MIDGAME]},
+	{"IsolatedPawnPenaltyEndgame", &isolatedPenalty[ENDGAME], nil,
+		0, 100, clearPawnTables, isolatedPenalty[ENDGAME]},
+	{"BackwardPawnPenaltyMidgame", &backwardPenalty[MIDGAME], nil,
+		0, 100, clearPawnTables, backwardPenalty[MIDGAME]},
+	{"BackwardPawnPenaltyEndgame", &backwardPenalty[ENDGAME], nil,
+		0, 100, clearPawnTables, backwardPenalty[ENDGAME]},
+
+	// Options named before the midgame/endgame split set both phases.
+	{"TempoBonus", &tempoBonus[MIDGAME], &tempoBonus[ENDGAME], 0, 100, nil, tempoBonus[MIDGAME]},
+	{"DoubledPawnPenalty", &doubledPenalty[MIDGAME], &doubledPenalty[ENDGAME],
+		0, 100, clearPawnTables, doubledPenalty[MIDGAME]},
+	{"IsolatedPawnPenalty", &isolatedPenalty[MIDGAME], &isolatedPenalty[ENDGAME],
+		0, 100, clearPawnTables, isolatedPenalty[MIDGAME]},
+	{"BackwardPawnPenalty", &backwardPenalty[MIDGAME], &backwardPenalty[ENDGAME],
+		0, 100, clearPawnTables, backwardPenalty[MIDGAME]},
+}
+
+func findTuningParam(name string) *TuningParam {
+	for i := range tuningParams {
+		if tuningParams[i].name == name {
+			return &tuningParams[i]
+		}
+	}
+	return nil
+}
+
+// Example: option name TempoBonus type spin default 5 min 0 max 100
+func (p *TuningParam) Option() string {
+	return fmt.Sprintf("option name %s type spin default %d min %d max %d\n", p.name, p.def, p.min,
+		p.max)
+}
+
+// Set updates the parameter. The caller must make sure no search is in progress.
+func (p *TuningParam) Set(value int) error {
+	if value < p.min || value > p.max {
+		return errors.New(fmt.Sprintf("value for option %s must be between %d and %d", p.name, p.min,
+			p.max))
+	}
+	if *p.value != value || (p.linked != nil && *p.linked != value) {
+		*p.value = value
+		if p.linked != nil {
+			*p.linked = value
+		}
+		if p.onChange != nil {
+			p.onChange()
+		}
+	}
+	return nil
+}
+
+// Pawn structure scores cached by each worker are no longer valid once a pawn penalty changes.
+func clearPawnTables() {
+	for _, w := range loadBalancer.workers {
+		*w.ptt = PawnTT{}
+	}
+}
@@ -17,7 +17,7 @@ type PawnEntry struct {
 	rightAttacks [2]BB
 	allAttacks   [2]BB
 	passedPawns  [2]BB
-	value        [2]int
+	value        [2][2]int // net midgame and endgame value of the pawn structure for each side.
 	key          uint32
 	count        [2]uint8
 }
@@ -0,0 +1,244 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Perft counts the leaf nodes of the legal move tree to a fixed depth. Comparing the counts with
+// known values verifies the move generator: https://chessprogramming.wikispaces.com/Perft
+
+// Divide reports the node count below each root move, making it possible to find the move
+// responsible for an incorrect total by comparing with another engine.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+const (
+	PERFT_SUITE          = "test_suites/perftsuite.epd" // http://www.rocechess.ch/perft.html
+	CHESS960_PERFT_SUITE = "test_suites/chess960.epd"   // https://chessprogramming.wikispaces.com/Chess960+Perft+Results
+)
+
+// PerftTT caches the node count below each position. Entries are stored using the same lockless
+// scheme as the main TT, so a single table can be shared by all perft goroutines.
+type PerftTT struct {
+	buckets []Bucket
+	mask    uint64
+}
+
+func NewPerftTT(mb int) *PerftTT {
+	maxBuckets := (uint64(mb) << 20) / uint64(unsafe.Sizeof(Bucket{}))
+	bucketCount := uint64(1)
+	for bucketCount<<1 <= maxBuckets {
+		bucketCount <<= 1
+	}
+	return &PerftTT{
+		buckets: make([]Bucket, bucketCount),
+		mask:    bucketCount - 1,
+	}
+}
+
+// The remaining depth is stored in the low 6 bits of each entry, and the node count in the rest.
+func (tt *PerftTT) probe(hashKey uint64, depth int) (int, bool) {
+	data, key := tt.buckets[hashKey&tt.mask].Load()
+	if hashKey == uint64(data^key) && int(data&63) == depth {
+		return int(data >> 6), true
+	}
+	return 0, false
+}
+
+func (tt *PerftTT) store(hashKey uint64, depth, count int) {
+	tt.buckets[hashKey&tt.mask].Store(BucketData(count<<6|depth), hashKey)
+}
+
+// Each perft goroutine uses its own PerftCounter, so no move generation state is shared.
+type PerftCounter struct {
+	htable   HistoryTable
+	stk      Stack
+	recycler *Recycler
+	tt       *PerftTT  // nil if hashing is disabled.
+	cancel   chan bool // closed to abort the count. nil if the count can't be aborted.
+	aborted  bool
+}
+
+func NewPerftCounter(tt *PerftTT, cancel chan bool) *PerftCounter {
+	return &PerftCounter{
+		stk:      NewStack(),
+		recycler: NewRecycler(512),
+		tt:       tt,
+		cancel:   cancel,
+	}
+}
+
+func (p *PerftCounter) count(brd *Board, depth, ply int) int {
+	if depth == 0 {
+		return 1
+	}
+	select {
+	case <-p.cancel:
+		p.aborted = true
+	default:
+	}
+	if p.aborted {
+		return 0
+	}
+	if p.tt != nil {
+		if sum, found := p.tt.probe(brd.hashKey, depth); found {
+			return sum
+		}
+	}
+	sum := 0
+	memento := brd.NewMemento()
+	generator := NewMoveSelector(brd, &p.stk[ply], &p.htable, brd.InCheck(), NO_MOVE)
+	for m, _ := generator.Next(p.recycler, SP_NONE); m != NO_MOVE; m, _ = generator.Next(p.recycler, SP_NONE) {
+		sum += p.countMove(brd, m, depth, ply, memento)
+		if m.PromotedTo() == QUEEN {
+			for _, pc := range underPromotions {
+				sum += p.countMove(brd, underPromotion(m, pc), depth, ply, memento)
+			}
+		}
+	}
+	if p.tt != nil && !p.aborted { // the sum of an aborted count is incomplete.
+		p.tt.store(brd.hashKey, depth, sum)
+	}
+	return sum
+}
+
+func (p *PerftCounter) countMove(brd *Board, m Move, depth, ply int, memento *BoardMemento) int {
+	if depth == 1 {
+		return 1 // bulk-count moves at the last ply.
+	}
+	makeMove(brd, m)
+	sum := p.count(brd, depth-1, ply+1)
+	unmakeMove(brd, m, memento)
+	return sum
+}
+
+// The move generator only produces queen and knight promotions, since the search gains nothing
+// from the others. Perft adds promotions to rook and bishop wherever a queen promotion is legal.
+var underPromotions = [2]Piece{ROOK, BISHOP}
+
+func underPromotion(m Move, pc Piece) Move {
+	return NewMove(m.From(), m.To(), PAWN, m.CapturedPiece(), pc)
+}
+
+// perftMoves returns all legal moves for brd, including underpromotions to rook and bishop.
+func perftMoves(brd *Board) []Move {
+	var moves []Move
+	for _, m := range brd.LegalMoves() {
+		moves = append(moves, m)
+		if m.PromotedTo() == QUEEN {
+			for _, pc := range underPromotions {
+				moves = append(moves, underPromotion(m, pc))
+			}
+		}
+	}
+	return moves
+}
+
+type DivideResult struct {
+	move  Move
+	count int
+}
+
+type DivideResults []DivideResult
+
+func (r DivideResults) Len() int { return len(r) }
+
+func (r DivideResults) Less(i, j int) bool { return r[i].move.ToUCI() < r[j].move.ToUCI() }
+
+func (r DivideResults) Swap(i, j int) {
+	r[i], r[j] = r[j], r[i]
+}
+
+func (r DivideResults) Total() int {
+	sum := 0
+	for _, result := range r {
+		sum += result.count
+	}
+	return sum
+}
+
+// Divide counts the nodes below each legal root move to the given depth. Root moves are spread
+// across numCPU goroutines.  Results are sorted by the UCI string of each move. Closing cancel
+// aborts the count, leaving the results incomplete.
+func Divide(brd *Board, depth, numCPU int, tt *PerftTT, cancel chan bool) DivideResults {
+	moves := perftMoves(brd)
+	results := make(DivideResults, len(moves))
+	jobs := make(chan int, len(moves))
+	for i := range moves {
+		jobs <- i
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	for n := 0; n < max(1, numCPU); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := NewPerftCounter(tt, cancel)
+			rootBrd := brd.Copy()
+			memento := rootBrd.NewMemento()
+			for i := range jobs {
+				makeMove(rootBrd, moves[i])
+				results[i] = DivideResult{moves[i], p.count(rootBrd, depth-1, 1)}
+				unmakeMove(rootBrd, moves[i], memento)
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Sort(results)
+	return results
+}
+
+// RunPerftSuite verifies the node count of each position in the suite having a known count at the
+// given depth. A hashed perft is used if hashMB > 0.  For each mismatch, the FEN and the node count
+// below each root move are printed. Returns the number of mismatches found.
+func RunPerftSuite(perftSuite string, depth, hashMB int) int {
+	test, err := loadEpdFile(perftSuite)
+	if err != nil {
+		fmt.Println(err)
+		return 0
+	}
+	var tt *PerftTT
+	if hashMB > 0 {
+		tt = NewPerftTT(hashMB)
+	}
+	numCPU := runtime.NumCPU()
+	sum, tested, mismatches := 0, 0, 0
+
+	start := time.Now()
+	for i, epd := range test {
+		expected, ok := epd.nodeCount[depth]
+		if !ok {
+			continue
+		}
+		results := Divide(epd.brd, depth, numCPU, tt, nil)
+		total := results.Total()
+		if total == expected {
+			fmt.Printf("-")
+		} else {
+			mismatches += 1
+			fmt.Printf("\n%d. %s\nExpected %d nodes at depth %d, got %d\n", i+1, epd.fen, expected,
+				depth, total)
+			for _, result := range results {
+				fmt.Printf("%s: %d\n", result.move.ToUCI(), result.count)
+			}
+		}
+		sum += total
+		tested += 1
+	}
+	secondsElapsed := time.Since(start).Seconds()
+	mNodes := float64(sum) / 1000000.0
+	fmt.Printf("\n%.4fm nodes counted in %.4fs (%.4fm NPS)\n", mNodes, secondsElapsed,
+		mNodes/secondsElapsed)
+	fmt.Printf("Total score: %d/%d\n", tested-mismatches, tested)
+	fmt.Printf("Depth: %d, CPU: %d, Hash: %d MB\n", depth, numCPU, hashMB)
+	return mismatches
+}
@@ -0,0 +1,42 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import "testing"
+
+func TestPerftSuite(t *testing.T) {
+	depth := 4
+	if mismatches := RunPerftSuite(PERFT_SUITE, depth, 0); mismatches > 0 {
+		t.Errorf("%d perft mismatches found at depth %d", mismatches, depth)
+	}
+}
+
+func TestChess960Perft(t *testing.T) {
+	defer func(enabled bool) { chess960 = enabled }(chess960)
+	chess960 = true
+	depth := 4
+	if mismatches := RunPerftSuite(CHESS960_PERFT_SUITE, depth, 16); mismatches > 0 {
+		t.Errorf("%d Chess960 perft mismatches found at depth %d", mismatches, depth)
+	}
+}
+
+func TestHashedPerft(t *testing.T) {
+	brd := ParseFENString("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	tt := NewPerftTT(16)
+	expected := Divide(brd, 3, 2, nil, nil)
+	for i := 0; i < 2; i++ { // the second pass is answered mostly from the hash table.
+		results := Divide(brd, 3, 2, tt, nil)
+		if results.Total() != 97862 {
+			t.Errorf("Expected 97862 nodes, got %d", results.Total())
+		}
+		for j, result := range results {
+			if result != expected[j] {
+				t.Errorf("Expected %s: %d, got %s: %d", expected[j].move.ToUCI(), expected[j].count,
+					result.move.ToUCI(), result.count)
+			}
+		}
+	}
+}
@@ -0,0 +1,469 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Implements reading and writing of games in Portable Game Notation (PGN):
+// http://www.saremba.de/chessgml/standards/pgn/pgn-complete.htm
+
+// Each game is stored as a tree of moves. The first child of each node continues the main line,
+// and any other children are variations (alternatives to the main line move).
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const PGN_LINE_LENGTH = 79 // maximum line length used when writing PGN.
+
+const (
+	PGN_SYMBOL = iota // PGN token types
+	PGN_STRING
+	PGN_COMMENT
+	PGN_NAG
+	PGN_OPEN_TAG
+	PGN_CLOSE_TAG
+	PGN_OPEN_VARIATION
+	PGN_CLOSE_VARIATION
+)
+
+// Suffix annotations are converted to the equivalent numeric annotation glyph (NAG).
+var pgnSuffixNags = map[string]int{"!": 1, "?": 2, "!!": 3, "??": 4, "!?": 5, "?!": 6}
+
+var pgnResults = map[string]bool{"1-0": true, "0-1": true, "1/2-1/2": true, "*": true}
+
+// The seven tag roster, with the values used when a tag is unknown.
+var pgnRequiredTags = []PGNTag{{"Event", "?"}, {"Site", "?"}, {"Date", "????.??.??"}, {"Round", "?"},
+	{"White", "?"}, {"Black", "?"}, {"Result", "*"}}
+
+type PGNTag struct {
+	name, value string
+}
+
+type Game struct {
+	tags      []PGNTag
+	start     *Board
+	startMove int       // fullmove number of the initial position.
+	root      *GameNode // the initial position. The root node has no move.
+	result    string
+}
+
+type GameNode struct {
+	move       Move
+	parent     *GameNode
+	children   []*GameNode // the first child continues the main line. The rest are variations.
+	nags       []int
+	preComment string // comment preceding the first move of a variation.
+	comment    string // comment following the move.
+}
+
+// NewGame returns a game with no moves, starting from brd.
+func NewGame(brd *Board) *Game {
+	g := &Game{
+		start:     brd.Copy(),
+		startMove: 1,
+		root:      &GameNode{move: NO_MOVE},
+		result:    "*",
+	}
+	for _, tag := range pgnRequiredTags {
+		g.SetTag(tag.name, tag.value)
+	}
+	if brd.FEN() != StartPos().FEN() {
+		g.SetTag("SetUp", "1")
+		g.SetTag("FEN", brd.FEN())
+	}
+	return g
+}
+
+func (g *Game) Tag(name string) string {
+	for _, tag := range g.tags {
+		if tag.name == name {
+			return tag.value
+		}
+	}
+	return ""
+}
+
+func (g *Game) SetTag(name, value string) {
+	for i, tag := range g.tags {
+		if tag.name == name {
+			g.tags[i].value = value
+			return
+		}
+	}
+	g.tags = append(g.tags, PGNTag{name, value})
+}
+
+func (g *Game) SetResult(result string) {
+	g.result = result
+	g.SetTag("Result", result)
+}
+
+// MainLine returns the moves of the main line, starting from the initial position.
+func (g *Game) MainLine() []Move {
+	var moves []Move
+	for node := g.root; len(node.children) > 0; node = node.children[0] {
+		moves = append(moves, node.children[0].move)
+	}
+	return moves
+}
+
+// Board returns the position reached after the move at node.
+func (g *Game) Board(node *GameNode) *Board {
+	var path []Move
+	for ; node.parent != nil; node = node.parent {
+		path = append(path, node.move)
+	}
+	brd := g.start.Copy()
+	for i := len(path) - 1; i >= 0; i-- {
+		makeMove(brd, path[i])
+	}
+	return brd
+}
+
+// AddMove adds m as a continuation of node. If node already has a main line move, m is added as a
+// variation.
+func (node *GameNode) AddMove(m Move) *GameNode {
+	child := &GameNode{move: m, parent: node}
+	node.children = append(node.children, child)
+	return child
+}
+
+func loadPgnFile(path string) ([]*Game, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("The specified PGN file could not be loaded: %s", path))
+	}
+	return ParsePGN(string(data))
+}
+
+func writePgnFile(path string, games []*Game) error {
+	pgnFile, err := os.Create(path)
+	if err != nil {
+		return errors.New(fmt.Sprintf("The specified PGN file could not be created: %s", path))
+	}
+	defer pgnFile.Close()
+	writer := bufio.NewWriter(pgnFile)
+	for i, g := range games {
+		if i > 0 {
+			writer.WriteString("\n")
+		}
+		if _, err = writer.WriteString(g.String()); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+type pgnToken struct {
+	kind, line int
+	text       string
+}
+
+func pgnError(line int, format string, a ...interface{}) error {
+	return errors.New(fmt.Sprintf("PGN line %d: ", line) + fmt.Sprintf(format, a...))
+}
+
+func isPGNSymbolChar(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		strings.ContainsRune("_+#=:-/", r)
+}
+
+func tokenizePGN(str string) ([]pgnToken, error) {
+	var tokens []pgnToken
+	runes := []rune(str)
+	line := 1
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		start := i
+		switch {
+		case r == '\n':
+			line++
+		case r == ' ' || r == '\t' || r == '\r' || r == '.':
+			// move number indications are ignored.
+		case r == '%' && (i == 0 || runes[i-1] == '\n'): // escaped line
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case r == ';': // rest-of-line comment
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+			comment := strings.TrimSpace(string(runes[start+1 : i+1]))
+			tokens = append(tokens, pgnToken{PGN_COMMENT, line, comment})
+		case r == '{':
+			commentLine := line
+			for i++; i < len(runes) && runes[i] != '}'; i++ {
+				if runes[i] == '\n' {
+					line++
+				}
+			}
+			if i == len(runes) {
+				return nil, pgnError(commentLine, "unterminated comment")
+			}
+			tokens = append(tokens, pgnToken{PGN_COMMENT, commentLine,
+				strings.Join(strings.Fields(string(runes[start+1:i])), " ")})
+		case r == '"':
+			var value []rune
+			for i++; i < len(runes) && runes[i] != '"' && runes[i] != '\n'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				value = append(value, runes[i])
+			}
+			if i == len(runes) || runes[i] != '"' {
+				return nil, pgnError(line, "unterminated string")
+			}
+			tokens = append(tokens, pgnToken{PGN_STRING, line, string(value)})
+		case r == '[':
+			tokens = append(tokens, pgnToken{PGN_OPEN_TAG, line, "["})
+		case r == ']':
+			tokens = append(tokens, pgnToken{PGN_CLOSE_TAG, line, "]"})
+		case r == '(':
+			tokens = append(tokens, pgnToken{PGN_OPEN_VARIATION, line, "("})
+		case r == ')':
+			tokens = append(tokens, pgnToken{PGN_CLOSE_VARIATION, line, ")"})
+		case r == '*':
+			tokens = append(tokens, pgnToken{PGN_SYMBOL, line, "*"})
+		case r == '$':
+			for i+1 < len(runes) && runes[i+1] >= '0' && runes[i+1] <= '9' {
+				i++
+			}
+			if i == start {
+				return nil, pgnError(line, "missing NAG number")
+			}
+			tokens = append(tokens, pgnToken{PGN_NAG, line, string(runes[start+1 : i+1])})
+		case r == '!' || r == '?':
+			for i+1 < len(runes) && (runes[i+1] == '!' || runes[i+1] == '?') {
+				i++
+			}
+			nag, ok := pgnSuffixNags[string(runes[start:i+1])]
+			if !ok {
+				return nil, pgnError(line, "invalid move suffix %s", string(runes[start:i+1]))
+			}
+			tokens = append(tokens, pgnToken{PGN_NAG, line, strconv.Itoa(nag)})
+		case isPGNSymbolChar(r):
+			for i+1 < len(runes) && isPGNSymbolChar(runes[i+1]) {
+				i++
+			}
+			tokens = append(tokens, pgnToken{PGN_SYMBOL, line, string(runes[start : i+1])})
+		default:
+			return nil, pgnError(line, "unexpected character %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+// ParsePGN parses each game in str. Errors give the line number of the malformed input.
+func ParsePGN(str string) ([]*Game, error) {
+	tokens, err := tokenizePGN(str)
+	if err != nil {
+		return nil, err
+	}
+	var games []*Game
+	var g *Game
+	for len(tokens) > 0 {
+		if g, tokens, err = parsePGNGame(tokens); err != nil {
+			return games, err
+		}
+		games = append(games, g)
+	}
+	return games, nil
+}
+
+func parsePGNGame(tokens []pgnToken) (*Game, []pgnToken, error) {
+	g := &Game{
+		startMove: 1,
+		root:      &GameNode{move: NO_MOVE},
+	}
+	// tag pair section
+	line := tokens[0].line
+	for len(tokens) > 0 && tokens[0].kind == PGN_OPEN_TAG {
+		line = tokens[0].line
+		if len(tokens) < 4 || tokens[1].kind != PGN_SYMBOL || tokens[2].kind != PGN_STRING ||
+			tokens[3].kind != PGN_CLOSE_TAG {
+			return nil, nil, pgnError(tokens[0].line, "malformed tag pair")
+		}
+		g.SetTag(tokens[1].text, tokens[2].text)
+		tokens = tokens[4:]
+	}
+	g.start = StartPos()
+	if fen := g.Tag("FEN"); fen != "" {
+		fenFields := strings.Fields(fen)
+		if len(fenFields) < 4 {
+			return nil, nil, pgnError(line, "invalid FEN tag: %s", fen)
+		}
+		var err error
+		if g.start, err = ParseFENSlice(fenFields); err != nil {
+			return nil, nil, pgnError(line, "%s", err)
+		}
+		if len(fenFields) > 5 {
+			g.startMove, _ = strconv.Atoi(fenFields[5])
+			g.startMove = max(1, g.startMove)
+		}
+	}
+
+	// movetext section
+	type variation struct {
+		node *GameNode
+		brd  *Board
+	}
+	var stack []variation
+	node, brd := g.root, g.start.Copy()
+	var preComment string
+	for len(tokens) > 0 {
+		tok := tokens[0]
+		tokens = tokens[1:]
+		switch tok.kind {
+		case PGN_COMMENT:
+			if node == g.root || (len(stack) > 0 && node == stack[len(stack)-1].node.parent) {
+				preComment = joinComments(preComment, tok.text)
+			} else {
+				node.comment = joinComments(node.comment, tok.text)
+			}
+		case PGN_NAG:
+			if node == g.root {
+				return nil, nil, pgnError(tok.line, "annotation before the first move")
+			}
+			nag, _ := strconv.Atoi(tok.text)
+			node.nags = append(node.nags, nag)
+		case PGN_OPEN_VARIATION:
+			if node == g.root || (len(stack) > 0 && node == stack[len(stack)-1].node.parent) {
+				return nil, nil, pgnError(tok.line, "variation without a preceding move")
+			}
+			stack = append(stack, variation{node, brd})
+			node = node.parent
+			brd = g.Board(node)
+		case PGN_CLOSE_VARIATION:
+			if len(stack) == 0 {
+				return nil, nil, pgnError(tok.line, "unmatched ')'")
+			}
+			node, brd = stack[len(stack)-1].node, stack[len(stack)-1].brd
+			stack = stack[:len(stack)-1]
+		case PGN_SYMBOL:
+			if pgnResults[tok.text] {
+				if len(stack) > 0 {
+					return nil, nil, pgnError(tok.line, "unterminated variation")
+				}
+				if preComment != "" {
+					g.root.comment = preComment
+				}
+				g.result = tok.text
+				return g, tokens, nil
+			}
+			if _, err := strconv.Atoi(tok.text); err == nil {
+				continue // move number
+			}
+			m, err := ParseSAN(brd, tok.text)
+			if err != nil {
+				return nil, nil, pgnError(tok.line, "%s", err.Error())
+			}
+			node = node.AddMove(m)
+			node.preComment, preComment = preComment, ""
+			makeMove(brd, m)
+		default:
+			return nil, nil, pgnError(tok.line, "missing game termination marker")
+		}
+	}
+	return nil, nil, errors.New("PGN: unexpected end of input (missing game termination marker)")
+}
+
+func joinComments(comment, other string) string {
+	if comment == "" {
+		return other
+	}
+	return comment + " " + other
+}
+
+// String returns the game in PGN export format, with movetext wrapped to PGN_LINE_LENGTH.
+func (g *Game) String() string {
+	var str string
+	for _, tag := range g.tags {
+		value := strings.Replace(strings.Replace(tag.value, "\\", "\\\\", -1), "\"", "\\\"", -1)
+		str += fmt.Sprintf("[%s \"%s\"]\n", tag.name, value)
+	}
+	tokens := commentTokens(nil, g.root.comment)
+	tokens = g.writeLine(tokens, g.root, g.start.Copy(), true)
+	tokens = append(tokens, g.result)
+
+	line := ""
+	for _, token := range tokens {
+		if line != "" && len(line)+1+len(token) > PGN_LINE_LENGTH {
+			str += "\n" + line
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += token
+	}
+	return str + "\n" + line + "\n"
+}
+
+// writeLine appends the tokens for the moves following node, including any variations. brd is the
+// position at node, and is updated as moves are written.
+func (g *Game) writeLine(tokens []string, node *GameNode, brd *Board, forceNumber bool) []string {
+	for len(node.children) > 0 {
+		main := node.children[0]
+		tokens = g.writeMove(tokens, main, brd, forceNumber)
+		forceNumber = main.comment != "" || len(node.children) > 1
+		for _, v := range node.children[1:] {
+			variationBrd := brd.Copy()
+			variation := g.writeMove(nil, v, variationBrd, true)
+			makeMove(variationBrd, v.move)
+			variation = g.writeLine(variation, v, variationBrd, v.comment != "")
+			variation[0] = "(" + variation[0]
+			variation[len(variation)-1] += ")"
+			tokens = append(tokens, variation...)
+		}
+		makeMove(brd, main.move)
+		node = main
+	}
+	return tokens
+}
+
+func (g *Game) writeMove(tokens []string, node *GameNode, brd *Board, forceNumber bool) []string {
+	tokens = commentTokens(tokens, node.preComment)
+	ply := len(g.pathTo(node)) - 2 // the path includes node and the root.
+	if g.start.c == BLACK {
+		ply++
+	}
+	number, san := g.startMove+ply/2, ToSAN(brd, node.move)
+	if brd.c == WHITE { // move numbers are kept on the same line as the move.
+		san = fmt.Sprintf("%d. %s", number, san)
+	} else if forceNumber || node.preComment != "" {
+		san = fmt.Sprintf("%d... %s", number, san)
+	}
+	tokens = append(tokens, san)
+	for _, nag := range node.nags {
+		tokens = append(tokens, fmt.Sprintf("$%d", nag))
+	}
+	return commentTokens(tokens, node.comment)
+}
+
+// Comments are split into words so that long comments can be wrapped.
+func commentTokens(tokens []string, comment string) []string {
+	if comment == "" {
+		return tokens
+	}
+	words := strings.Fields(comment)
+	words[0] = "{" + words[0]
+	words[len(words)-1] += "}"
+	return append(tokens, words...)
+}
+
+// pathTo returns the nodes from node back to the root.
+func (g *Game) pathTo(node *GameNode) []*GameNode {
+	var path []*GameNode
+	for ; node != nil; node = node.parent {
+		path = append(path, node)
+	}
+	return path
+}
@@ -0,0 +1,144 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testPGN = `[Event "Casual Game"]
+[Site "London \"Simpson's\""]
+[Date "1851.??.??"]
+[Round "?"]
+[White "Anderssen, Adolf"]
+[Black "Kieseritzky, Lionel"]
+[Result "1-0"]
+
+{The Immortal Game.} 1.e4 e5 2.f4 exf4 3.Bc4 Qh4+ 4.Kf1 b5 5.Bxb5 Nf6 6.Nf3 Qh6
+7.d3 Nh5 8.Nh4 Qg5 9.Nf5 c6 10.g4 Nf6 11.Rg1! cxb5 12.h4 Qg6 13.h5 Qg5 14.Qf3
+Ng8 15.Bxf4 Qf6 16.Nc3 Bc5 17.Nd5 Qxb2 18.Bd6 Bxg1 {Black could have won with
+18...Qxa1+ 19.Ke2 Qb2.} (18...Qxa1+ 19.Ke2 Qb2 $1 (19...Bxg1 20.e5) 20.Kd2
+Bxg1) 19.e5 Qxa1+ 20.Ke2 Na6 21.Nxg7+ Kd8 22.Qf6+!! Nxf6 23.Be7# 1-0
+
+[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "?"]
+[Black "?"]
+[Result "*"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 b - - 0 40"]
+
+40...Kd7 ; rest of line comment
+41.e4 (41.Kd2 {or} 41...Ke6) *
+`
+
+func TestParsePGN(t *testing.T) {
+	games, err := ParsePGN(testPGN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("Expected 2 games, got %d", len(games))
+	}
+	g := games[0]
+	if g.Tag("Site") != `London "Simpson's"` || g.Tag("White") != "Anderssen, Adolf" || g.result != "1-0" {
+		t.Errorf("Tags parsed incorrectly: %v", g.tags)
+	}
+	mainLine := g.MainLine()
+	if len(mainLine) != 45 || mainLine[44].ToUCI() != "d6e7" {
+		t.Errorf("Expected 45 main line moves ending with d6e7, got %d", len(mainLine))
+	}
+	node := g.root
+	for i := 0; i < 35; i++ {
+		node = node.children[0]
+	}
+	if len(node.children) != 2 || node.children[1].move.ToUCI() != "b2a1" {
+		t.Fatalf("Expected variation 18...Qxa1+ after 18.Bd6")
+	}
+	variation := node.children[1].children[0].children[0] // 19...Qb2
+	if len(variation.nags) != 1 || variation.nags[0] != 1 || len(node.children[1].children[0].children) != 2 {
+		t.Errorf("Expected nested variation 19...Bxg1 and NAG $1 on 19...Qb2")
+	}
+	if !strings.HasPrefix(node.children[0].comment, "Black could have won") {
+		t.Errorf("Expected comment after 18...Bxg1, got %q", node.children[0].comment)
+	}
+
+	g = games[1]
+	if g.startMove != 40 || g.start.c != BLACK || len(g.MainLine()) != 2 {
+		t.Errorf("Expected game starting at move 40 with black to move")
+	}
+	if g.root.children[0].comment != "rest of line comment" || len(g.root.children[0].children) != 2 {
+		t.Errorf("Expected comment and variation after 40...Kd7")
+	}
+}
+
+func TestWritePGN(t *testing.T) {
+	games, err := ParsePGN(testPGN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var str string
+	for _, g := range games {
+		str += g.String() + "\n"
+	}
+	for _, line := range strings.Split(str, "\n") {
+		if len(line) > PGN_LINE_LENGTH {
+			t.Errorf("Line exceeds %d characters: %s", PGN_LINE_LENGTH, line)
+		}
+	}
+	movetext := strings.Join(strings.Fields(str), " ")
+	if !strings.Contains(movetext, "18. Bd6 Bxg1 {Black could have won with 18...Qxa1+ 19.Ke2 Qb2.} (18... Qxa1+") ||
+		!strings.Contains(movetext, "19. Ke2 Qb2 $1 (19... Bxg1 20. e5) 20. Kd2 Bxg1) 19. e5") ||
+		!strings.Contains(movetext, "40... Kd7 {rest of line comment} 41. e4 (41. Kd2 {or} 41... Ke6) *") {
+		t.Errorf("Unexpected PGN output:\n%s", str)
+	}
+	reparsed, err := ParsePGN(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restr string
+	for _, g := range reparsed {
+		restr += g.String() + "\n"
+	}
+	if restr != str {
+		t.Errorf("Expected written PGN to be unchanged after parsing:\n%s\ngot:\n%s", str, restr)
+	}
+
+	g := NewGame(StartPos())
+	node := g.root
+	for _, san := range []string{"e4", "e5", "Nf3"} {
+		m, _ := ParseSAN(g.Board(node), san)
+		node = node.AddMove(m)
+	}
+	g.SetResult("1/2-1/2")
+	expected := "[Event \"?\"]\n[Site \"?\"]\n[Date \"????.??.??\"]\n[Round \"?\"]\n[White \"?\"]\n" +
+		"[Black \"?\"]\n[Result \"1/2-1/2\"]\n\n1. e4 e5 2. Nf3 1/2-1/2\n"
+	if g.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, g.String())
+	}
+}
+
+func TestPGNErrors(t *testing.T) {
+	tests := []struct {
+		pgn, err string
+	}{
+		{"[Event \"?\"]\n\n1. e4 e5 2. Ke3 *", "PGN line 3: Illegal SAN move: Ke3"},
+		{"1. e4 {unterminated\ncomment", "PGN line 1: unterminated comment"},
+		{"1. e4 e5\n2. Nf3 (2. Nc3\n*", "PGN line 3: unterminated variation"},
+		{"1. e4 e5\n2. Nf3 )", "PGN line 2: unmatched ')'"},
+		{"[Event \"?]\n1. e4 *", "PGN line 1: unterminated string"},
+		{"1. e4 *\n\n[Event \"?\"]\n\n1. d4 d5\n\n[Event \"?\"]", "PGN line 7: missing game termination marker"},
+		{"1. ( e4 ) *", "PGN line 1: variation without a preceding move"},
+	}
+	for _, test := range tests {
+		if _, err := ParsePGN(test.pgn); err == nil || err.Error() != test.err {
+			t.Errorf("Expected error %q, got %v", test.err, err)
+		}
+	}
+}
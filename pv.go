@@ -14,6 +14,23 @@ type PV struct {
 	next  *PV
 }
 
+// PVLine pairs a principal variation found at the root with its score.
+type PVLine struct {
+	pv    *PV
+	score int
+}
+
+// PVLines are sorted by descending score when reporting multiple PVs.
+type PVLines []PVLine
+
+func (l PVLines) Len() int { return len(l) }
+
+func (l PVLines) Less(i, j int) bool { return l[i].score > l[j].score }
+
+func (l PVLines) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
 func (pv *PV) ToUCI() string {
 	if pv == nil || !pv.m.IsMove() {
 		return ""
@@ -7,13 +7,45 @@ package main
 
 // "fmt"
 
-func (stk Stack) IsRepetition(ply int, halfmoveClock uint8) bool {
+// GameHistory holds the hash keys of positions reached during the game prior to the root of the
+// current search, oldest first.  Only positions since the last irreversible move are kept, since
+// earlier positions can never be repeated.
+type GameHistory []uint64
+
+// MakeMove records the current position of brd in the game history, then plays m.
+func (h *GameHistory) MakeMove(brd *Board, m Move) {
+	*h = append(*h, brd.hashKey)
+	makeMove(brd, m)
+	if brd.halfmoveClock == 0 { // m was irreversible.
+		*h = (*h)[:0]
+	}
+}
+
+func (h *GameHistory) Clear() {
+	*h = (*h)[:0]
+}
+
+// IsRepetition checks for a draw by threefold repetition. Positions searched above the current ply
+// are checked first, followed by positions reached during the game prior to the root of the search.
+func (stk Stack) IsRepetition(ply int, halfmoveClock uint8, history GameHistory) bool {
 	hashKey := stk[ply].hashKey
 	if halfmoveClock < 4 {
 		return false
 	}
-	for repetitionCount := 0; ply >= 2; ply -= 2 {
-		if stk[ply-2].hashKey == hashKey {
+	repetitionCount := 0
+	// Positions more than halfmoveClock plies back precede the last irreversible move.
+	oldest := ply - int(halfmoveClock)
+	prev := ply - 2
+	for ; prev >= 0 && prev >= oldest; prev -= 2 {
+		if stk[prev].hashKey == hashKey {
+			repetitionCount += 1
+			if repetitionCount == 2 {
+				return true
+			}
+		}
+	}
+	for ; len(history)+prev >= 0 && prev >= oldest; prev -= 2 {
+		if history[len(history)+prev] == hashKey {
 			repetitionCount += 1
 			if repetitionCount == 2 {
 				return true
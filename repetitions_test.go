@@ -0,0 +1,74 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// repetitionAfter sets up the position given to the UCI adapter, plays m from the root at ply 1 of
+// the search stack, and checks the resulting position for repetition.
+func repetitionAfter(t *testing.T, position, m string) bool {
+	uci := NewUCIAdapter()
+	uci.out = ioutil.Discard
+	if err := uci.position(strings.Fields(position)); err != nil {
+		t.Fatal(err)
+	}
+	brd := uci.brd.Copy()
+	stk := NewStack()
+	stk[0].hashKey = brd.hashKey
+	makeMove(brd, mustParseMove(t, brd, m))
+	stk[1].hashKey = brd.hashKey
+	return stk.IsRepetition(1, brd.halfmoveClock, uci.history)
+}
+
+// The first two occurrences of the start position were played before the root of the search.
+func TestRepetitionInGameHistory(t *testing.T) {
+	moves := "startpos moves g1f3 g8f6 f3g1 f6g8 g1f3 g8f6 f3g1"
+	if !repetitionAfter(t, moves, "f6g8") {
+		t.Errorf("Expected the third occurrence of the start position to be a repetition")
+	}
+	if repetitionAfter(t, "startpos moves g1f3 g8f6 f3g1", "f6g8") {
+		t.Errorf("Expected the second occurrence of the start position not to be a repetition")
+	}
+}
+
+// After a pawn move, earlier positions can't be repeated. Their keys are dropped from the game
+// history, and aren't searched for on the stack.
+func TestRepetitionAfterPawnMove(t *testing.T) {
+	if repetitionAfter(t, "startpos moves g1f3 g8f6 f3g1 f6g8 g1f3 e7e6 f3g1", "f8e7") {
+		t.Errorf("Expected no repetition across a pawn move")
+	}
+
+	uci := NewUCIAdapter()
+	uci.out = ioutil.Discard
+	readUCI(t, uci, "position startpos moves g1f3 g8f6 f3g1 f6g8 e2e4\n")
+	if len(uci.history) != 0 {
+		t.Errorf("Expected the game history to be cleared by a pawn move, got %d positions",
+			len(uci.history))
+	}
+
+	// Even if a key from before the last irreversible move matches, it isn't counted.
+	stk := NewStack()
+	stk[0].hashKey, stk[2].hashKey = 1, 7
+	if stk.IsRepetition(2, 4, GameHistory{7, 2, 7, 3}) {
+		t.Errorf("Expected positions before the last irreversible move to be ignored")
+	}
+	if !stk.IsRepetition(2, 6, GameHistory{7, 2, 7, 3}) {
+		t.Errorf("Expected positions since the last irreversible move to be counted")
+	}
+}
+
+func TestRepetitionNewGame(t *testing.T) {
+	uci := NewUCIAdapter()
+	uci.out = ioutil.Discard
+	readUCI(t, uci, "position startpos moves g1f3 g8f6 f3g1 f6g8\nucinewgame\n")
+	if len(uci.history) != 0 {
+		t.Errorf("Expected ucinewgame to clear the game history, got %d positions", len(uci.history))
+	}
+}
@@ -7,18 +7,10 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"sync"
-)
-
-const ( // TODO: expose these as options via UCI interface.
-	MIN_SPLIT       = 2  // Do not begin parallel search below this depth.
-	F_PRUNE_MAX     = 2  // Do not use futility pruning when above this depth.
-	LMR_MIN         = 2  // Do not use late move reductions below this depth.
-	IID_MIN         = 4  // Do not use internal iterative deepening below this depth.
-	NULL_MOVE_MIN   = 3  // Do not use null-move pruning below this depth.
-	MIN_CHECK_DEPTH = -2 // During Q-Search, consider all evasions when in check at or above this depth.
-
-	DRAW_VALUE = KNIGHT_VALUE // The value to assign to a draw
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -26,11 +18,15 @@ const (
 	NO_SCORE = INF - 1          // sentinal value indicating a meaningless score.
 	MATE     = NO_SCORE - 1     // maximum checkmate score (i.e. mate in 0)
 	MIN_MATE = MATE - MAX_STACK // minimum possible checkmate score (mate in MAX_STACK)
+	TB_WIN   = MIN_MATE - 1     // score of a tablebase win (less the distance from the root)
 )
 
 const (
-	MAX_DEPTH = 32 // default maximum search depth
-	COMMS_MIN = 1  // minimum depth at which to send info to GUI.
+	MAX_DEPTH    = 32 // default maximum search depth
+	COMMS_MIN    = 1  // minimum depth at which to send info to GUI.
+	MAX_MULTI_PV = 64 // maximum number of principal variations reported in multi-PV mode.
+
+	CURRMOVE_MIN = 3 * time.Second // minimum search time before the current root move is reported.
 )
 
 const (
@@ -42,21 +38,27 @@ const (
 var searchId int
 
 type Search struct {
-	htable HistoryTable // must be listed first to ensure cache alignment for atomic w/r
+	htable    HistoryTable // must be listed first to ensure cache alignment for atomic w/r
+	nodeCount int64        // nodes visited by all workers. Only maintained when a node limit is set.
+	tbHits    int64        // successful tablebase probes by all workers.
+	moveFound int32        // set to 1 once an iteration has completed, so that a move is available.
 	SearchParams
 	sideToMove           uint8 // SearchParams would otherwise create padding
-	once                 sync.Once
+	once, abortOnce      sync.Once
 	allowedMoves         []Move
+	history              GameHistory // positions reached during the game prior to the root.
+	excludedMoves        []Move      // root moves already reported in the current iteration (multi-PV).
 	bestScore            [2]int
 	cancel               chan bool
 	bestMove, ponderMove Move
 	gt                   *GameTimer
-	uci                  *UCIAdapter
+	adapter              Adapter
 	alpha, beta, nodes   int
 }
 
 type SearchParams struct {
-	maxDepth                        int
+	maxDepth, multiPV               int
+	nodeLimit, mateLimit            int // 0 indicates no limit.
 	verbose, ponder, restrictSearch bool
 }
 
@@ -64,11 +66,22 @@ type SearchResult struct {
 	bestMove, ponderMove Move
 }
 
-func NewSearch(params SearchParams, gt *GameTimer, uci *UCIAdapter, allowedMoves []Move) *Search {
+// Adapter is implemented by each supported GUI protocol (UCI, XBoard) to receive search output.
+type Adapter interface {
+	Info(info Info)                            // report the result of an iterative deepening pass.
+	CurrentMove(depth int, m Move, number int) // report the root move being searched.
+	InfoString(str string)                     // report diagnostic info.
+	BestMove(result SearchResult)              // report the final result of the search.
+	QueueResult(result SearchResult)
+	SearchFinished()
+}
+
+func NewSearch(params SearchParams, gt *GameTimer, adapter Adapter, allowedMoves []Move,
+	history GameHistory) *Search {
 	s := &Search{
 		bestScore:    [2]int{-INF, -INF},
 		cancel:       make(chan bool),
-		uci:          uci,
+		adapter:      adapter,
 		bestMove:     NO_MOVE,
 		ponderMove:   NO_MOVE,
 		alpha:        -INF,
@@ -76,6 +89,7 @@ func NewSearch(params SearchParams, gt *GameTimer, uci *UCIAdapter, allowedMoves
 		gt:           gt,
 		SearchParams: params,
 		allowedMoves: allowedMoves,
+		history:      history,
 	}
 	gt.s = s
 	if !s.ponder {
@@ -86,11 +100,11 @@ func NewSearch(params SearchParams, gt *GameTimer, uci *UCIAdapter, allowedMoves
 
 func (s *Search) sendResult() {
 	s.once.Do(func() {
-		if s.uci != nil {
+		if s.adapter != nil {
 			if s.ponder {
-				s.uci.result <- s.Result() // queue result to be sent when requested by GUI.
+				s.adapter.QueueResult(s.Result()) // queue result to be sent when requested by GUI.
 			} else {
-				s.uci.BestMove(s.Result()) // send result immediately
+				s.adapter.BestMove(s.Result()) // send result immediately
 			}
 		}
 	})
@@ -100,12 +114,30 @@ func (s *Search) Result() SearchResult {
 	return SearchResult{s.bestMove, s.ponderMove}
 }
 
+// Abort may be called concurrently by the game timer, the UCI adapter, and any worker that exhausts
+// the node limit.
 func (s *Search) Abort() {
-	select {
-	case <-s.cancel:
-	default:
+	s.abortOnce.Do(func() {
 		close(s.cancel)
+	})
+}
+
+// countNode adds a node to the total shared by all workers, and aborts the search once the node
+// limit is exhausted.  The search is allowed to finish its first iteration so that a move is
+// always available. Each worker records the deepest ply it has reached as its selective depth.
+func (s *Search) countNode(brd *Board, ply int) {
+	if w := brd.worker; int32(ply) > atomic.LoadInt32(&w.selDepth) {
+		atomic.StoreInt32(&w.selDepth, int32(ply)) // only written by w, so no CAS is needed.
 	}
+	if s.nodeLimit > 0 && atomic.AddInt64(&s.nodeCount, 1) >= int64(s.nodeLimit) &&
+		atomic.LoadInt32(&s.moveFound) == 1 {
+		s.Abort()
+	}
+}
+
+// mateFound returns true if the search has proven a mate within the requested number of moves.
+func (s *Search) mateFound(score int) bool {
+	return s.mateLimit > 0 && score >= MATE-((2*s.mateLimit)-1)
 }
 
 func (s *Search) moveAllowed(m Move) bool {
@@ -117,9 +149,43 @@ func (s *Search) moveAllowed(m Move) bool {
 	return false
 }
 
+func (s *Search) moveExcluded(m Move) bool {
+	for _, excludedMove := range s.excludedMoves {
+		if m == excludedMove {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the number of legal root moves the search is permitted to consider.
+func (s *Search) rootMoveCount(brd *Board) int {
+	count := 0
+	for _, m := range brd.LegalMoves() {
+		if !s.restrictSearch || s.moveAllowed(m) {
+			count++
+		}
+	}
+	return count
+}
+
+// newInfo collects the search statistics reported along with each PV.
+func (s *Search) newInfo(score, depth, nodeCount int, pv *PV) Info {
+	return Info{
+		score:     score,
+		depth:     depth,
+		selDepth:  max(depth, maxSelDepth()),
+		nodeCount: nodeCount,
+		hashFull:  mainTt.HashFull(),
+		tbHits:    int(atomic.LoadInt64(&s.tbHits)),
+		t:         s.gt.Elapsed(),
+		pv:        pv,
+	}
+}
+
 func (s *Search) sendInfo(str string) {
-	if s.uci != nil {
-		s.uci.InfoString(str)
+	if s.adapter != nil {
+		s.adapter.InfoString(str)
 	} else if s.verbose {
 		fmt.Print(str)
 	}
@@ -127,9 +193,28 @@ func (s *Search) sendInfo(str string) {
 
 func (s *Search) Start(brd *Board) {
 	s.sideToMove = brd.c
+	syncMainTtDraws(s.drawScore(brd))
+	for _, w := range loadBalancer.workers {
+		atomic.StoreInt32(&w.selDepth, 0)
+	}
 	brd.worker = loadBalancer.RootWorker() // Send SPs generated by root goroutine to root worker.
+	brd.nnue = nil
+	if evalMode == EVAL_NNUE && network != nil {
+		brd.nnue = network.NewAccumulator(brd) // copied along with brd to each helper and split point.
+	}
 
-	s.nodes = s.iterativeDeepening(brd)
+	if s.multiPV > 1 || !s.probeRoot(brd) {
+		if searchMode == SEARCH_LAZY_SMP {
+			var helpers Helpers
+			s.startHelpers(brd, &helpers)
+			s.nodes = s.iterativeDeepening(brd)
+			s.Abort() // stop any helpers still searching, and wait for them to finish.
+			helpers.Wait()
+			s.nodes += int(helpers.nodes)
+		} else {
+			s.nodes = s.iterativeDeepening(brd)
+		}
+	}
 
 	if searchId >= 512 { // only 9 bits are available to store the id in each TT entry.
 		searchId = 0
@@ -139,43 +224,168 @@ func (s *Search) Start(brd *Board) {
 	s.gt.Stop() // s.cancel the timer to prevent it from interfering with the next search if it's not
 	// garbage collected before then.
 	s.sendResult()
-	if s.uci != nil {
-		s.uci.wg.Done()
+	if s.adapter != nil {
+		s.adapter.SearchFinished()
+	}
+}
+
+// If the root position is in the tablebases, the search is restricted to the moves that preserve the
+// tablebase result. If the position is won, the move that makes the fastest progress toward zeroing
+// the 50-move counter is played without searching, and probeRoot returns true. The same is done if
+// only rook or bishop promotions keep the result, since the search doesn't generate them.
+func (s *Search) probeRoot(brd *Board) bool {
+	if !tbAvailable(brd) {
+		return false
+	}
+	var moves []Move
+	for _, m := range perftMoves(brd) { // an underpromotion may be the only move to keep the result.
+		if !s.restrictSearch || s.moveAllowed(m) {
+			moves = append(moves, m)
+		}
+	}
+	if len(moves) == 0 {
+		return false
+	}
+	ranks, dtzs, ok := rankRootMoves(brd, moves)
+	if !ok {
+		return false
 	}
+	s.tbHits += int64(len(moves))
+	best := bestRootRank(ranks, dtzs)
+	var allowedMoves []Move
+	searchable := false
+	for i, m := range moves {
+		if ranks[i] == ranks[best] {
+			allowedMoves = append(allowedMoves, m)
+			// the search only generates promotions to queen and knight.
+			searchable = searchable || (m.PromotedTo() != ROOK && m.PromotedTo() != BISHOP)
+		}
+	}
+	if ranks[best] == 1000 || !searchable {
+		score := sign(ranks[best]) * (TB_WIN - 1)
+		s.bestMove, s.ponderMove, s.bestScore[brd.c] = moves[best], NO_MOVE, score
+		if s.adapter != nil {
+			pv := &PV{m: moves[best], value: score, depth: 1}
+			s.adapter.Info(s.newInfo(score, 1, 0, pv))
+		}
+		return true
+	}
+	s.allowedMoves, s.restrictSearch = allowedMoves, true
+	return false
 }
 
+// In multi-PV mode, the root is searched once per requested PV at each iteration. Moves found by
+// earlier passes are excluded from later ones, so each pass finds the best of the remaining moves.
+// Exclusion only happens at ply 0, which is never a split point, so servant workers are unaffected.
 func (s *Search) iterativeDeepening(brd *Board) int {
 	var guess, total, sum int
 	c := brd.c
 	stk := brd.worker.stk
-	s.alpha, s.beta = -INF, INF // first iteration is always full-width.
 	inCheck := brd.InCheck()
 
+	rootMoves := s.rootMoveCount(brd)
+	multiPV := max(1, min(s.multiPV, rootMoves))
+	lines := make(PVLines, 0, multiPV)
+	prevScores := make([]int, multiPV) // score of each PV line found by the previous iteration.
+	prevCount := 0
+	stable, scoreDrop := 0, 0 // iterations since the best move changed, and the fall in its score.
+
 	for d := 1; d <= s.maxDepth; d++ {
 
-		stk[0].inCheck = inCheck
-		guess, total = s.ybw(brd, stk, s.alpha, s.beta, d, 0, Y_PV, SP_NONE, false)
-		sum += total
+		lines = lines[:0]
+		s.excludedMoves = s.excludedMoves[:0]
+		for i := 0; i < multiPV; i++ {
+			delta := aspirationWindow
+			s.alpha, s.beta = -INF, INF // early iterations are always full-width.
+			if d >= aspirationMin && i < prevCount && abs(prevScores[i]) < TB_WIN-MAX_STACK {
+				s.alpha, s.beta = prevScores[i]-delta, prevScores[i]+delta
+			}
+			for {
+				stk[0].inCheck = inCheck
+				guess, total = s.ybw(brd, stk, s.alpha, s.beta, d, 0, Y_PV, SP_NONE, false)
+				sum += total
+
+				select { // if the cancel signal was received mid-search, the current guess is not useful.
+				case <-s.cancel:
+					return sum
+				default:
+				}
 
-		select { // if the cancel signal was received mid-search, the current guess is not useful.
-		case <-s.cancel:
-			return sum
-		default:
+				if guess > s.alpha && guess < s.beta {
+					break
+				}
+				// The score is outside the aspiration window. Report the bound, then widen the window
+				// on the side that failed and re-search.
+				if d >= COMMS_MIN && s.adapter != nil && stk[0].pv != nil {
+					info := s.newInfo(guess, d, sum, stk[0].pv)
+					info.lowerBound, info.upperBound = guess >= s.beta, guess <= s.alpha
+					if multiPV > 1 {
+						info.multiPV = i + 1
+					}
+					s.adapter.Info(info)
+				}
+				delta *= 2
+				if guess <= s.alpha {
+					s.alpha = guess - delta
+					if delta > QUEEN_VALUE {
+						s.alpha = -INF
+					}
+				} else {
+					s.beta = guess + delta
+					if delta > QUEEN_VALUE {
+						s.beta = INF
+					}
+				}
+			}
+
+			if !stk[0].pv.m.IsMove() {
+				s.sendInfo("Nil PV returned to ID\n")
+				break
+			}
+			lines = append(lines, PVLine{stk[0].pv, guess})
+			s.excludedMoves = append(s.excludedMoves, stk[0].pv.m)
 		}
 
-		if stk[0].pv.m.IsMove() {
-			s.bestMove, s.bestScore[c] = stk[0].pv.m, guess
-			if stk[0].pv.next != nil {
-				s.ponderMove = stk[0].pv.next.m
+		if len(lines) > 0 {
+			sort.Stable(lines) // rank the PVs found during this iteration by score.
+			best := lines[0]
+			if best.pv.m == s.bestMove {
+				stable++
+			} else {
+				stable = 0
 			}
+			if prevCount > 0 {
+				scoreDrop = prevScores[0] - best.score
+			}
+			s.bestMove, s.bestScore[c] = best.pv.m, best.score
+			if best.pv.next != nil {
+				s.ponderMove = best.pv.next.m
+			}
+			atomic.StoreInt32(&s.moveFound, 1)
 
-			stk[0].pv.SavePV(brd, d, guess) // install PV to transposition table prior to next iteration.
+			best.pv.SavePV(brd, d, best.score) // install PV to transposition table prior to next iteration.
+			for i, line := range lines {
+				prevScores[i] = line.score
+			}
+			prevCount = len(lines)
+		}
 
-		} else {
-			s.sendInfo("Nil PV returned to ID\n")
+		if d >= COMMS_MIN && s.adapter != nil { // don't print info for first few plies to reduce communication traffic.
+			for i, line := range lines {
+				info := s.newInfo(line.score, d, sum, line.pv)
+				if multiPV > 1 {
+					info.multiPV = i + 1
+				}
+				s.adapter.Info(info)
+			}
 		}
-		if d >= COMMS_MIN && (s.verbose || s.uci != nil) { // don't print info for first few plies to reduce communication traffic.
-			s.uci.Info(Info{guess, d, sum, s.gt.Elapsed(), stk})
+
+		if s.mateFound(s.bestScore[c]) { // stop searching once the requested mate has been found.
+			break
+		}
+
+		if s.gt.SoftLimitReached(stable, scoreDrop, rootMoves) {
+			break
 		}
 	}
 
@@ -197,6 +407,11 @@ func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 		return s.quiescence(brd, stk, alpha, beta, 0, ply) // q-search is always sequential.
 	}
 
+	// horizon nodes are counted by quiescence, and split points by the SP master.
+	if spType != SP_SERVANT {
+		s.countNode(brd, ply)
+	}
+
 	var thisStk *StackItem
 	var inCheck bool
 	var sp *SplitPoint
@@ -235,8 +450,10 @@ func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 	}
 
 	thisStk.hashKey = brd.hashKey
-	if stk.IsRepetition(ply, brd.halfmoveClock) { // check for draw by threefold repetition
-		return ply - DRAW_VALUE, 1
+	// check for draw by threefold repetition or insufficient material. The root is always searched so
+	// that a move is available.
+	if ply > 0 && (stk.IsRepetition(ply, brd.halfmoveClock, s.history) || brd.InsufficientMaterial()) {
+		return s.drawScore(brd), 1
 	}
 
 	inCheck = thisStk.inCheck
@@ -246,7 +463,18 @@ func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 		if isCheckmate(brd, inCheck) {
 			return ply - MATE, 1
 		} else {
-			return ply - DRAW_VALUE, 1
+			return s.drawScore(brd), 1
+		}
+	}
+
+	// probe the tablebases once a capture or pawn move brings the position into range.
+	if ply > 0 && brd.halfmoveClock == 0 && tbAvailable(brd) {
+		if wdl, ok := probeWDL(brd); ok {
+			atomic.AddInt64(&s.tbHits, 1)
+			if nodeType == Y_PV {
+				stk[ply].pv = nil
+			}
+			return s.tbScore(brd, wdl, ply), sum
 		}
 	}
 
@@ -260,7 +488,7 @@ func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 	if nodeType != Y_PV {
 		if (hashResult & CUTOFF_FOUND) > 0 { // Hash hit valid for current bounds.
 			return score, sum
-		} else if !inCheck && thisStk.canNull && hashResult != AVOID_NULL && depth >= NULL_MOVE_MIN &&
+		} else if !inCheck && thisStk.canNull && hashResult != AVOID_NULL && depth >= nullMoveMin &&
 			!brd.PawnsOnly() && eval >= beta { // Null-move pruning
 
 			score, subtotal = s.nullMake(brd, stk, beta, nullDepth, ply, checked)
@@ -282,7 +510,7 @@ func (s *Search) ybw(brd *Board, stk Stack, alpha, beta, depth, ply, nodeType,
 	}
 
 	// skip IID when in check?
-	if !inCheck && nodeType == Y_PV && hashResult == NO_MATCH && depth >= IID_MIN {
+	if !inCheck && nodeType == Y_PV && hashResult == NO_MATCH && depth >= iidMin {
 		// No hash move available. Use IID to get a decent first move to try.
 		score, subtotal = s.ybw(brd, stk, alpha, beta, depth-2, ply, Y_PV, SP_NONE, checked)
 		sum += subtotal
@@ -302,13 +530,13 @@ searchMoves:
 	if inCheck {
 		checked = true // Don't extend on the first check in the current variation.
 	} else if ply > 0 && alpha > -MIN_MATE {
-		if depth <= F_PRUNE_MAX && !brd.PawnsOnly() {
+		if depth <= fPruneMax && !brd.PawnsOnly() {
 			canPrune = true
 			if eval+BISHOP_VALUE < alpha {
 				fPrune = true
 			}
 		}
-		if depth >= LMR_MIN {
+		if depth >= lmrMin {
 			canReduce = true
 		}
 	}
@@ -331,6 +559,14 @@ searchMoves:
 			}
 		}
 
+		if ply == 0 && s.moveExcluded(m) { // skip root moves already found during this iteration.
+			continue
+		}
+
+		if ply == 0 && s.adapter != nil && s.gt.Elapsed() >= CURRMOVE_MIN {
+			s.adapter.CurrentMove(depth, m, legalSearched+1)
+		}
+
 		if m == thisStk.singularMove {
 			continue
 		}
@@ -546,8 +782,8 @@ searchMoves:
 			mainTt.store(brd, NO_MOVE, depth, EXACT, ply-MATE)
 			return ply - MATE, sum
 		} else { // Draw.
-			mainTt.store(brd, NO_MOVE, depth, EXACT, 0)
-			return ply - DRAW_VALUE, sum
+			mainTt.store(brd, NO_MOVE, depth, EXACT, s.drawScore(brd))
+			return s.drawScore(brd), sum
 		}
 	}
 }
@@ -556,11 +792,14 @@ searchMoves:
 // making benefit of parallelism smaller and raising communication and synchronization overhead.
 func (s *Search) quiescence(brd *Board, stk Stack, alpha, beta, depth, ply int) (int, int) {
 
+	s.countNode(brd, ply)
+
 	thisStk := &stk[ply]
 
 	thisStk.hashKey = brd.hashKey
-	if stk.IsRepetition(ply, brd.halfmoveClock) { // check for draw by threefold repetition
-		return ply - DRAW_VALUE, 1
+	// check for draw by threefold repetition or insufficient material.
+	if stk.IsRepetition(ply, brd.halfmoveClock, s.history) || brd.InsufficientMaterial() {
+		return s.drawScore(brd), 1
 	}
 
 	inCheck := thisStk.inCheck
@@ -568,7 +807,7 @@ func (s *Search) quiescence(brd *Board, stk Stack, alpha, beta, depth, ply int)
 		if isCheckmate(brd, inCheck) {
 			return ply - MATE, 1
 		} else {
-			return ply - DRAW_VALUE, 1
+			return s.drawScore(brd), 1
 		}
 	}
 
@@ -591,7 +830,7 @@ func (s *Search) quiescence(brd *Board, stk Stack, alpha, beta, depth, ply int)
 
 	legalMoves := false
 	memento := brd.NewMemento()
-	selector := NewQMoveSelector(brd, thisStk, &s.htable, brd.worker.recycler, inCheck, depth >= MIN_CHECK_DEPTH)
+	selector := NewQMoveSelector(brd, thisStk, &s.htable, brd.worker.recycler, inCheck, depth >= minCheckDepth)
 
 	var mayPromote, givesCheck bool
 	for m := selector.Next(); m != NO_MOVE; m = selector.Next() {
@@ -635,6 +874,28 @@ func (s *Search) quiescence(brd *Board, stk Stack, alpha, beta, depth, ply int)
 	return best, sum
 }
 
+// Wins and losses that will be frustrated by the 50-move rule are scored as draws.
+func (s *Search) tbScore(brd *Board, wdl, ply int) int {
+	switch wdl {
+	case WDL_WIN:
+		return TB_WIN - ply
+	case WDL_LOSS:
+		return ply - TB_WIN
+	default:
+		return s.drawScore(brd)
+	}
+}
+
+// Draws by stalemate, repetition, the 50-move rule and the tablebases are scored relative to the
+// side to move at the root. With positive contempt, the root side treats a draw as a small loss and
+// avoids it; with negative contempt, it seeks draws.
+func (s *Search) drawScore(brd *Board) int {
+	if brd.c == s.sideToMove {
+		return -contempt
+	}
+	return contempt
+}
+
 func (s *Search) nullMake(brd *Board, stk Stack, beta, nullDepth, ply int, checked bool) (int, int) {
 	hashKey, enpTarget := brd.hashKey, brd.enpTarget
 	brd.c ^= 1
@@ -675,7 +936,7 @@ func (s *Search) determineChildType(nodeType, legalSearched int) int {
 
 // Determine if the current node is a good place to start searching in parallel.
 func canSplit(brd *Board, ply, depth, nodeType, legalSearched, stage int) bool {
-	if depth >= MIN_SPLIT {
+	if depth >= minSplit && searchMode == SEARCH_YBWC {
 		switch nodeType {
 		case Y_PV:
 			return ply > 0 && legalSearched > 0
@@ -5,10 +5,201 @@
 
 package main
 
-import "testing"
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 func TestPlayingStrength(t *testing.T) {
 	printName()
+	if *lazySMPFlag { // go test -run TestPlayingStrength -args -lazysmp
+		searchMode = SEARCH_LAZY_SMP
+	}
 	timeout := 2000
 	RunTestSuite("test_suites/wac_300.epd", MAX_DEPTH, timeout)
 }
+
+// A stalemate scored with contempt should give the same score when it's found again in the TT.
+func TestStalemateContempt(t *testing.T) {
+	defer func(value int) { contempt = value }(contempt)
+	contempt = 50
+	resetMainTt()
+	brd := ParseFENString("k7/2Q5/1K6/8/8/8/8/8 b - - 0 1")
+	brd.worker = loadBalancer.RootWorker()
+	s := NewSearch(SearchParams{maxDepth: 1}, NewGameTimer(0, WHITE), nil, nil, nil)
+	defer s.gt.Stop()
+	s.sideToMove = WHITE
+	for i := 0; i < 2; i++ {
+		if score, _ := s.ybw(brd, brd.worker.stk, -INF, INF, 4, 1, Y_CUT, SP_NONE, false); score != contempt {
+			t.Errorf("Expected the stalemate to score %d on visit %d, got %d", contempt, i+1, score)
+		}
+	}
+}
+
+func isLegalMove(brd *Board, m Move) bool {
+	for _, legal := range brd.LegalMoves() {
+		if m == legal {
+			return true
+		}
+	}
+	return false
+}
+
+// infoRecorder is an Adapter that keeps the info sent by a search.
+type infoRecorder struct {
+	infos []Info
+}
+
+func (r *infoRecorder) Info(info Info)                            { r.infos = append(r.infos, info) }
+func (r *infoRecorder) CurrentMove(depth int, m Move, number int) {}
+func (r *infoRecorder) InfoString(str string)                     {}
+func (r *infoRecorder) BestMove(result SearchResult)              {}
+func (r *infoRecorder) QueueResult(result SearchResult)           {}
+func (r *infoRecorder) SearchFinished()                           {}
+
+// The search should stop close to the node limit, and still return a legal move.
+func TestNodeLimit(t *testing.T) {
+	brd := ParseFENString("r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4")
+	limit := 50000
+	s := NewSearch(SearchParams{maxDepth: MAX_DEPTH, multiPV: 1, nodeLimit: limit}, NewGameTimer(0, brd.c),
+		nil, nil, nil)
+	s.Start(brd.Copy())
+	if nodes := int(atomic.LoadInt64(&s.nodeCount)); nodes < limit || nodes > limit+limit/10 {
+		t.Errorf("Expected the search to stop near %d nodes, got %d", limit, nodes)
+	}
+	if !isLegalMove(brd, s.bestMove) {
+		t.Errorf("Expected a legal best move, got %s", s.bestMove.ToUCI())
+	}
+}
+
+// With a mate limit, the search should stop as soon as the mate is found, rather than continuing to
+// the maximum depth.  1. Ra6 bxa6 2. b7#
+func TestMateLimit(t *testing.T) {
+	brd := ParseFENString("kbK5/pp6/1P6/8/8/8/8/R7 w - - 0 1")
+	var recorder infoRecorder
+	s := NewSearch(SearchParams{maxDepth: MAX_DEPTH, multiPV: 1, mateLimit: 2}, NewGameTimer(0, brd.c),
+		&recorder, nil, nil)
+	s.Start(brd.Copy())
+	if depth := recorder.infos[len(recorder.infos)-1].depth; depth > 3 {
+		t.Errorf("Expected the search to stop once the mate in 2 was found, searched to depth %d", depth)
+	}
+	if s.bestMove.ToUCI() != "a1a6" || s.bestScore[WHITE] != MATE-3 {
+		t.Errorf("Expected a1a6 to mate in 2, got %s with score %d", s.bestMove.ToUCI(), s.bestScore[WHITE])
+	}
+}
+
+// searchInfo runs a fixed-depth search of fen, and returns the search and the info it sent.
+func searchInfo(fen string, params SearchParams, allowedMoves []string) (*Search, []Info) {
+	brd := ParseFENString(fen)
+	var moves []Move
+	for _, str := range allowedMoves {
+		m, _ := ParseMove(brd, str)
+		moves = append(moves, m)
+	}
+	params.restrictSearch = len(moves) > 0
+	var recorder infoRecorder
+	s := NewSearch(params, NewGameTimer(0, brd.c), &recorder, moves, nil)
+	s.Start(brd)
+	return s, recorder.infos
+}
+
+// lastMultiPV returns the lines reported by the final iteration, in order of rank.
+func lastMultiPV(infos []Info) []Info {
+	var lines []Info
+	for _, info := range infos {
+		if info.multiPV > 0 && !info.lowerBound && !info.upperBound {
+			if info.multiPV == 1 {
+				lines = lines[:0]
+			}
+			lines = append(lines, info)
+		}
+	}
+	return lines
+}
+
+func TestMultiPV(t *testing.T) {
+	fen := "r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4"
+	for _, allowed := range [][]string{nil, {"d2d3", "b1c3", "e1g1", "f3g5"}} {
+		_, infos := searchInfo(fen, SearchParams{maxDepth: 6, multiPV: 3}, allowed)
+		lines := lastMultiPV(infos)
+		if len(lines) != 3 || lines[0].depth != 6 {
+			t.Fatalf("Expected 3 lines from the last iteration, got %d", len(lines))
+		}
+		seen := make(map[Move]bool)
+		for i, line := range lines {
+			m := line.pv.m
+			if seen[m] {
+				t.Errorf("Expected distinct root moves, got %s twice", m.ToUCI())
+			}
+			seen[m] = true
+			if i > 0 && line.score > lines[i-1].score {
+				t.Errorf("Expected non-increasing scores, got %d after %d", line.score, lines[i-1].score)
+			}
+			if allowed != nil && !strings.Contains(strings.Join(allowed, " "), m.ToUCI()) {
+				t.Errorf("Expected only the searchmoves to be reported, got %s", m.ToUCI())
+			}
+		}
+	}
+}
+
+// With a one-centipawn aspiration window, the search fails in both directions before settling on
+// the same score as a full-width search. Splitting is disabled to make both searches repeatable.
+func TestAspirationResearch(t *testing.T) {
+	defer func(w, m, s int) { aspirationWindow, aspirationMin, minSplit = w, m, s }(aspirationWindow,
+		aspirationMin, minSplit)
+	defer resetMainTt()
+	fen := "r1b1kb1r/3q1ppp/pBp1pn2/8/Np3P2/5B2/PPP3PP/R2Q1RK1 w kq - 0 1" // WAC.011
+	minSplit = MAX_DEPTH + 1
+
+	aspirationWindow, aspirationMin = 1, 2
+	resetMainTt()
+	s, infos := searchInfo(fen, SearchParams{maxDepth: 6, multiPV: 1}, nil)
+	var out bytes.Buffer
+	uci := NewUCIAdapter()
+	uci.out = &out
+	for _, info := range infos {
+		uci.Info(info)
+	}
+	for _, bound := range []string{"lowerbound", "upperbound"} {
+		if !strings.Contains(out.String(), " "+bound+" depth ") {
+			t.Errorf("Expected an info line reporting a %s", bound)
+		}
+	}
+
+	aspirationMin = MAX_DEPTH + 1 // full-width search at every depth.
+	resetMainTt()
+	full, _ := searchInfo(fen, SearchParams{maxDepth: 6, multiPV: 1}, nil)
+	if s.bestScore[WHITE] != full.bestScore[WHITE] {
+		t.Errorf("Expected the aspiration search to score %d, got %d", full.bestScore[WHITE],
+			s.bestScore[WHITE])
+	}
+}
+
+// Lazy SMP helpers are run on a balancer with several workers, even on a single CPU. Helpers have no
+// limits of their own. With only one legal move, the main search stops after its first iteration,
+// and the helpers should be stopped before the move is returned.
+func TestLazySMP(t *testing.T) {
+	defer func(mode int, b *Balancer) { searchMode, loadBalancer = mode, b }(searchMode, loadBalancer)
+	searchMode = SEARCH_LAZY_SMP
+	loadBalancer = NewLoadBalancer(4)
+	before := runtime.NumGoroutine()
+	brd := ParseFENString("1nb1kbnr/r2p2p1/p1p4p/1p3P2/1P2P1p1/N2P2P1/P1PqK2P/R4BNR w - - 5 15")
+	gt := NewGameTimer(0, brd.c)
+	gt.remaining = [2]time.Duration{time.Minute, time.Minute}
+	s := NewSearch(SearchParams{maxDepth: MAX_DEPTH, multiPV: 1}, gt, nil, nil, nil)
+	s.Start(brd.Copy())
+	if s.bestMove.ToUCI() != "e2d2" {
+		t.Errorf("Expected the only legal move e2d2, got %s", s.bestMove.ToUCI())
+	}
+	for i := 0; runtime.NumGoroutine() > before; i++ { // a helper may still be returning after Done.
+		if i == 100 {
+			t.Fatalf("Expected the helpers to exit, %d goroutines still running",
+				runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
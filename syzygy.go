@@ -0,0 +1,1048 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Implements probing of Syzygy endgame tablebases (WDL and DTZ), based on the probing code
+// by Ronald de Man: https://github.com/syzygy1/tb
+
+// Each table file covers one material configuration, e.g. KRvKN.rtbw, and is named with the
+// stronger side first. WDL tables (.rtbw) store the win/draw/loss result of each position
+// taking the 50-move rule into account. DTZ tables (.rtbz) store the distance to the next
+// zeroing move (capture or pawn move) for the side to move, and are only probed at the root.
+
+// Positions are mapped to an index by placing the pieces in groups (e.g. the kings and one
+// other piece, then any identical pieces), and each group is encoded as a combination of the
+// squares it occupies. Symmetry is used to map the leading piece or pawn onto a subset of
+// the board. Table values are compressed in blocks using recursive pairing, with each block
+// encoded as a sequence of canonical Huffman symbols.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	TB_PIECES = 7 // maximum number of pieces in any table.
+
+	WDL_LOSS         = -2
+	WDL_BLESSED_LOSS = -1 // a loss that can be saved by the 50-move rule.
+	WDL_DRAW         = 0
+	WDL_CURSED_WIN   = 1 // a win that will be frustrated by the 50-move rule.
+	WDL_WIN          = 2
+)
+
+const ( // table flags
+	TB_STM          = 1
+	TB_MAPPED       = 2
+	TB_WIN_PLIES    = 4
+	TB_LOSS_PLIES   = 8
+	TB_WIDE         = 16
+	TB_SINGLE_VALUE = 128
+)
+
+const ( // probe states
+	PROBE_FAIL = iota
+	PROBE_OK
+	PROBE_CHANGE_STM        // DTZ table stores the other side to move.
+	PROBE_ZEROING_BEST_MOVE // best move is a capture or pawn move. DTZ table can't be probed.
+)
+
+var wdlMagic = [4]byte{0x71, 0xE8, 0x23, 0x5D}
+var dtzMagic = [4]byte{0xD7, 0x66, 0x0C, 0xA5}
+
+var tablebases *Tablebases // nil unless a path to the tablebase files has been set.
+
+var (
+	tbBinomial      [6][64]uint64
+	tbLeadPawnIdx   [6][64]uint64
+	tbLeadPawnsSize [6][4]uint64
+	tbMapPawns      [64]int
+	tbMapB1H1H7     [64]int
+	tbMapA1D1D4     [64]int
+	tbMapKK         [10][64]int
+)
+
+type Tablebases struct {
+	wdl, dtz    map[uint64]*tbTable // tables are registered under the material key for each color.
+	cardinality int                 // largest number of pieces in any available WDL table.
+	count       int
+}
+
+// PairsData describes the compressed values stored for one side to move and (for tables
+// with pawns) one file of the leading pawn. Fields ending in Off are offsets into the file.
+type pairsData struct {
+	flags           uint8
+	sizeofBlock     int
+	span            uint64
+	numBlocks       int
+	maxSymLen       int
+	minSymLen       int // stores the value itself if the TB_SINGLE_VALUE flag is set.
+	lowestSymOff    int
+	btreeOff        int
+	blockLengthOff  int
+	blockLengthSize int
+	sparseIndexOff  int
+	sparseIndexSize int
+	dataOff         int
+	base64          []uint64
+	symlen          []uint8
+	pieces          [TB_PIECES]uint8
+	groupIdx        [TB_PIECES + 1]uint64
+	groupLen        [TB_PIECES + 1]int
+	mapIdx          [4]int // used only in DTZ tables.
+}
+
+type tbTable struct {
+	path            string
+	dtz             bool
+	key, key2       uint64
+	pieceCount      int
+	hasPawns        bool
+	hasUniquePieces bool
+	pawnCount       [2]int // pawns of the leading color, then the other color.
+	items           [2][4]pairsData
+	mapOff          int
+	data            []byte
+	once            sync.Once
+	ready           bool
+}
+
+func setupSyzygy() {
+	// tbMapB1H1H7 encodes a square below the a1-h8 diagonal to 0..27
+	code := 0
+	for sq := 0; sq < 64; sq++ {
+		if offA1H8(sq) < 0 {
+			tbMapB1H1H7[sq] = code
+			code++
+		}
+	}
+	// tbMapA1D1D4 encodes a square in the a1-d1-d4 triangle to 0..9, with diagonal squares last.
+	var diagonal []int
+	code = 0
+	for sq := 0; sq <= D4; sq++ {
+		if offA1H8(sq) < 0 && column(sq) <= 3 {
+			tbMapA1D1D4[sq] = code
+			code++
+		} else if offA1H8(sq) == 0 && column(sq) <= 3 {
+			diagonal = append(diagonal, sq)
+		}
+	}
+	for _, sq := range diagonal {
+		tbMapA1D1D4[sq] = code
+		code++
+	}
+	// tbMapKK encodes the 462 legal placements of two kings where the first is in the a1-d1-d4
+	// triangle. If the first king is on the diagonal, the second is not above it.
+	var bothOnDiagonal [][2]int
+	code = 0
+	for idx := 0; idx < 10; idx++ {
+		for sq1 := 0; sq1 <= D4; sq1++ {
+			if tbMapA1D1D4[sq1] != idx || (idx == 0 && sq1 != B1) { // b1 is mapped to 0
+				continue
+			}
+			for sq2 := 0; sq2 < 64; sq2++ {
+				if (kingMasks[sq1]|sqMaskOn[sq1])&sqMaskOn[sq2] > 0 {
+					continue // illegal position
+				} else if offA1H8(sq1) == 0 && offA1H8(sq2) > 0 {
+					continue // first on diagonal, second above
+				} else if offA1H8(sq1) == 0 && offA1H8(sq2) == 0 {
+					bothOnDiagonal = append(bothOnDiagonal, [2]int{idx, sq2})
+				} else {
+					tbMapKK[idx][sq2] = code
+					code++
+				}
+			}
+		}
+	}
+	for _, pair := range bothOnDiagonal {
+		tbMapKK[pair[0]][pair[1]] = code
+		code++
+	}
+	// tbBinomial[k][n] is the number of ways to choose k elements from a set of n elements.
+	tbBinomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < 6 && k <= n; k++ {
+			if k > 0 {
+				tbBinomial[k][n] += tbBinomial[k-1][n-1]
+			}
+			if k < n {
+				tbBinomial[k][n] += tbBinomial[k][n-1]
+			}
+		}
+	}
+	// tbMapPawns maps squares a2-h7 to 0..47: the number of squares available to the other pawns
+	// when the leading pawn is on the given square. The leading pawn has the highest value.
+	available := 47
+	for leadPawnsCnt := 1; leadPawnsCnt <= 5; leadPawnsCnt++ {
+		for f := 0; f < 4; f++ {
+			idx := uint64(0) // the index restarts for each file, since each file has its own table.
+			for r := 1; r <= 6; r++ {
+				sq := Square(r, f)
+				if leadPawnsCnt == 1 {
+					tbMapPawns[sq] = available
+					available--
+					tbMapPawns[sq^7] = available
+					available--
+				}
+				tbLeadPawnIdx[leadPawnsCnt][sq] = idx
+				idx += tbBinomial[leadPawnsCnt-1][tbMapPawns[sq]]
+			}
+			tbLeadPawnsSize[leadPawnsCnt][f] = idx
+		}
+	}
+}
+
+func offA1H8(sq int) int { return row(sq) - column(sq) }
+
+// LoadTablebases registers each table found in the given list of directories. Tables are
+// loaded into memory the first time they are probed.
+func LoadTablebases(paths string) (*Tablebases, error) {
+	tb := &Tablebases{
+		wdl: make(map[uint64]*tbTable),
+		dtz: make(map[uint64]*tbTable),
+	}
+	validName := regexp.MustCompile("^K[QRBNP]*vK[QRBNP]*$")
+	for _, dir := range filepath.SplitList(paths) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("The specified tablebase path could not be read: %s", dir))
+		}
+		for _, file := range files {
+			ext := filepath.Ext(file.Name())
+			name := strings.TrimSuffix(file.Name(), ext)
+			if (ext != ".rtbw" && ext != ".rtbz") || !validName.MatchString(name) ||
+				len(name)-1 > TB_PIECES {
+				continue
+			}
+			t := newTbTable(name, filepath.Join(dir, file.Name()), ext == ".rtbz")
+			if ext == ".rtbw" {
+				tb.wdl[t.key], tb.wdl[t.key2] = t, t
+				tb.cardinality = max(tb.cardinality, t.pieceCount)
+			} else {
+				tb.dtz[t.key], tb.dtz[t.key2] = t, t
+			}
+			tb.count++
+		}
+	}
+	return tb, nil
+}
+
+// Replaces the available tablebases with those found in paths, and returns a message describing
+// the result.
+func setTablebasePath(paths string) string {
+	if paths == "" || paths == "<empty>" {
+		tablebases = nil
+		return "tablebases disabled\n"
+	}
+	tb, err := LoadTablebases(paths)
+	if err != nil {
+		tablebases = nil
+		return err.Error() + "\n"
+	}
+	tablebases = tb
+	return fmt.Sprintf("found %d tablebases\n", tb.count)
+}
+
+var tbPieceChars = map[rune]Piece{'P': PAWN, 'N': KNIGHT, 'B': BISHOP, 'R': ROOK, 'Q': QUEEN, 'K': KING}
+
+// Creates a table for the material configuration given by name, e.g. KRvKN.
+func newTbTable(name, path string, dtz bool) *tbTable {
+	var counts [2][6]int
+	sides := strings.Split(name, "v")
+	for i, side := range sides { // the first side is treated as white.
+		for _, r := range side {
+			counts[i][tbPieceChars[r]]++
+		}
+	}
+	t := &tbTable{
+		path:       path,
+		dtz:        dtz,
+		key:        tbMaterialKey(counts[0], counts[1]),
+		key2:       tbMaterialKey(counts[1], counts[0]),
+		pieceCount: len(name) - 1,
+		hasPawns:   counts[0][PAWN]+counts[1][PAWN] > 0,
+	}
+	for c := 0; c < 2; c++ {
+		for pc := PAWN; pc < KING; pc++ {
+			if counts[c][pc] == 1 {
+				t.hasUniquePieces = true
+			}
+		}
+	}
+	// The leading color is the side with fewer pawns, if both sides have pawns.
+	if counts[1][PAWN] == 0 || (counts[0][PAWN] > 0 && counts[1][PAWN] >= counts[0][PAWN]) {
+		t.pawnCount = [2]int{counts[0][PAWN], counts[1][PAWN]}
+	} else {
+		t.pawnCount = [2]int{counts[1][PAWN], counts[0][PAWN]}
+	}
+	return t
+}
+
+// Identifies the material on the board, using 4 bits per piece type for each side.
+func tbMaterialKey(white, black [6]int) uint64 {
+	var key uint64
+	for pc := 0; pc < 6; pc++ {
+		key |= uint64(white[pc])<<uint(4*pc) | uint64(black[pc])<<uint(4*(pc+6))
+	}
+	return key
+}
+
+func boardMaterialKey(brd *Board) uint64 {
+	var white, black [6]int
+	for pc := PAWN; pc <= KING; pc++ {
+		white[pc] = popCount(brd.pieces[WHITE][pc])
+		black[pc] = popCount(brd.pieces[BLACK][pc])
+	}
+	return tbMaterialKey(white, black)
+}
+
+// Tables use their own piece codes: 1..6 for white pawn to king, and 9..14 for black.
+func tbPieceCode(brd *Board, sq int) uint8 {
+	code := uint8(brd.TypeAt(sq)) + 1
+	if brd.occupied[BLACK]&sqMaskOn[sq] > 0 {
+		code |= 8
+	}
+	return code
+}
+
+func (t *tbTable) get(stm, f int) *pairsData {
+	if t.dtz {
+		stm = 0 // DTZ tables store only one side to move.
+	}
+	if !t.hasPawns {
+		f = 0
+	}
+	return &t.items[stm][f]
+}
+
+// Load reads the table file into memory the first time the table is needed.
+func (t *tbTable) load() bool {
+	t.once.Do(func() {
+		data, err := ioutil.ReadFile(t.path)
+		if err != nil || len(data)%64 != 16 {
+			return
+		}
+		magic := wdlMagic
+		if t.dtz {
+			magic = dtzMagic
+		}
+		for i := range magic {
+			if data[i] != magic[i] {
+				return
+			}
+		}
+		t.ready = t.setup(data)
+		t.data = data
+	})
+	return t.ready
+}
+
+func (t *tbTable) setup(data []byte) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil { // truncated or corrupted file.
+			ok = false
+		}
+	}()
+	off := 4 // skip the magic number.
+	if (data[off]&2 > 0) != t.hasPawns {
+		// the table doesn't match its file name.
+		return false
+	}
+	off++
+	sides, maxFile := 1, 0
+	if !t.dtz && t.key != t.key2 {
+		sides = 2
+	}
+	if t.hasPawns {
+		maxFile = 3
+	}
+	pp := t.hasPawns && t.pawnCount[1] > 0 // pawns on both sides
+	for f := 0; f <= maxFile; f++ {
+		order := [2][2]int{{int(data[off] & 0xF), 0xF}, {int(data[off] >> 4), 0xF}}
+		if pp {
+			order[0][1], order[1][1] = int(data[off+1]&0xF), int(data[off+1]>>4)
+			off++
+		}
+		off++
+		for k := 0; k < t.pieceCount; k, off = k+1, off+1 {
+			for i := 0; i < sides; i++ {
+				if i > 0 {
+					t.get(i, f).pieces[k] = data[off] >> 4
+				} else {
+					t.get(i, f).pieces[k] = data[off] & 0xF
+				}
+			}
+		}
+		for i := 0; i < sides; i++ {
+			t.setGroups(t.get(i, f), order[i], f)
+		}
+	}
+	off += off & 1 // word alignment
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			off = t.get(i, f).setSizes(data, off)
+		}
+	}
+	if t.dtz {
+		off = t.setDTZMap(data, off, maxFile)
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.get(i, f)
+			d.sparseIndexOff = off
+			off += d.sparseIndexSize * 6
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.get(i, f)
+			d.blockLengthOff = off
+			off += d.blockLengthSize * 2
+		}
+	}
+	for f := 0; f <= maxFile; f++ {
+		for i := 0; i < sides; i++ {
+			d := t.get(i, f)
+			off = (off + 0x3F) &^ 0x3F // 64 byte alignment
+			d.dataOff = off
+			off += d.numBlocks * d.sizeofBlock
+		}
+	}
+	return off <= len(data)
+}
+
+// The order in which pieces are listed defines the groups, e.g. in KRvKN the first three pieces
+// form the leading group and the knight is on its own. The order in which the groups are
+// encoded is given separately for each table.
+func (t *tbTable) setGroups(d *pairsData, order [2]int, f int) {
+	n, firstLen := 0, 0
+	if !t.hasPawns {
+		if t.hasUniquePieces {
+			firstLen = 3
+		} else {
+			firstLen = 2
+		}
+	}
+	d.groupLen[n] = 1
+	for i := 1; i < t.pieceCount; i++ {
+		firstLen--
+		if firstLen > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLen[n]++
+		} else {
+			n++
+			d.groupLen[n] = 1
+		}
+	}
+	n++
+	d.groupLen[n] = 0 // zero-terminated
+
+	pp := t.hasPawns && t.pawnCount[1] > 0
+	next, freeSquares := 1, 64-d.groupLen[0]
+	if pp {
+		next, freeSquares = 2, freeSquares-d.groupLen[1]
+	}
+	idx := uint64(1)
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		if k == order[0] { // leading pawns or pieces
+			d.groupIdx[0] = idx
+			if t.hasPawns {
+				idx *= tbLeadPawnsSize[d.groupLen[0]][f]
+			} else if t.hasUniquePieces {
+				idx *= 31332
+			} else {
+				idx *= 462
+			}
+		} else if k == order[1] { // remaining pawns
+			d.groupIdx[1] = idx
+			idx *= tbBinomial[d.groupLen[1]][48-d.groupLen[0]]
+		} else { // remaining pieces
+			d.groupIdx[next] = idx
+			idx *= tbBinomial[d.groupLen[next]][freeSquares]
+			freeSquares -= d.groupLen[next]
+			next++
+		}
+	}
+	d.groupIdx[n] = idx // the last entry stores the size of the table.
+}
+
+func (d *pairsData) setSizes(data []byte, off int) int {
+	d.flags = data[off]
+	off++
+	if d.flags&TB_SINGLE_VALUE > 0 {
+		d.minSymLen = int(data[off])
+		return off + 1
+	}
+	n := 0
+	for d.groupLen[n] != 0 {
+		n++
+	}
+	tbSize := d.groupIdx[n]
+
+	d.sizeofBlock = 1 << data[off]
+	d.span = 1 << data[off+1]
+	d.sparseIndexSize = int((tbSize + d.span - 1) / d.span)
+	padding := int(data[off+2])
+	d.numBlocks = int(binary.LittleEndian.Uint32(data[off+3:]))
+	d.blockLengthSize = d.numBlocks + padding
+	d.maxSymLen, d.minSymLen = int(data[off+7]), int(data[off+8])
+	off += 9
+	d.lowestSymOff = off
+	d.base64 = make([]uint64, d.maxSymLen-d.minSymLen+1)
+
+	// The canonical code is ordered so that longer symbols have lower numeric values. base64[l]
+	// is the lowest symbol of length l + minSymLen, padded to 64 bits.
+	for i := len(d.base64) - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + uint64(d.lowestSym(data, i)) - uint64(d.lowestSym(data, i+1))) / 2
+	}
+	for i := range d.base64 {
+		d.base64[i] <<= uint(64 - i - d.minSymLen)
+	}
+	off += len(d.base64) * 2
+	d.symlen = make([]uint8, binary.LittleEndian.Uint16(data[off:]))
+	off += 2
+	d.btreeOff = off
+
+	visited := make([]bool, len(d.symlen))
+	for sym := range d.symlen {
+		if !visited[sym] {
+			d.symlen[sym] = d.setSymlen(data, sym, visited)
+		}
+	}
+	return off + len(d.symlen)*3 + (len(d.symlen) & 1)
+}
+
+// Each symbol expands into a pair of symbols, recursively. symlen stores the number of values
+// (minus one) represented by each symbol.
+func (d *pairsData) setSymlen(data []byte, sym int, visited []bool) uint8 {
+	visited[sym] = true
+	right := d.right(data, sym)
+	if right == 0xFFF {
+		return 0
+	}
+	left := d.left(data, sym)
+	if !visited[left] {
+		d.symlen[left] = d.setSymlen(data, left, visited)
+	}
+	if !visited[right] {
+		d.symlen[right] = d.setSymlen(data, right, visited)
+	}
+	return d.symlen[left] + d.symlen[right] + 1
+}
+
+func (d *pairsData) lowestSym(data []byte, i int) uint16 {
+	return binary.LittleEndian.Uint16(data[d.lowestSymOff+2*i:])
+}
+
+func (d *pairsData) blockLength(data []byte, block int) int {
+	return int(binary.LittleEndian.Uint16(data[d.blockLengthOff+2*block:]))
+}
+
+func (d *pairsData) left(data []byte, sym int) int {
+	lr := data[d.btreeOff+3*sym:]
+	return int(lr[1]&0xF)<<8 | int(lr[0])
+}
+
+func (d *pairsData) right(data []byte, sym int) int {
+	lr := data[d.btreeOff+3*sym:]
+	return int(lr[2])<<4 | int(lr[1]>>4)
+}
+
+// DTZ values may be remapped to save space. The map for each WDL result is stored after the
+// table sizes.
+func (t *tbTable) setDTZMap(data []byte, off, maxFile int) int {
+	t.mapOff = off
+	for f := 0; f <= maxFile; f++ {
+		d := t.get(0, f)
+		if d.flags&TB_MAPPED == 0 {
+			continue
+		}
+		if d.flags&TB_WIDE > 0 {
+			off += off & 1
+			for i := 0; i < 4; i++ {
+				d.mapIdx[i] = (off-t.mapOff)/2 + 1
+				off += 2*int(binary.LittleEndian.Uint16(data[off:])) + 2
+			}
+		} else {
+			for i := 0; i < 4; i++ {
+				d.mapIdx[i] = off - t.mapOff + 1
+				off += int(data[off]) + 1
+			}
+		}
+	}
+	return off + off&1
+}
+
+// Returns the value stored at index idx.
+func (d *pairsData) decompressPairs(data []byte, idx uint64) int {
+	if d.flags&TB_SINGLE_VALUE > 0 {
+		return d.minSymLen
+	}
+	// Every span values, the sparse index stores the block containing the value and its offset
+	// within that block. Find the nearest entry and walk forward or back to the right block.
+	k := int(idx / d.span)
+	entry := data[d.sparseIndexOff+6*k:]
+	block := int(binary.LittleEndian.Uint32(entry))
+	offset := int(binary.LittleEndian.Uint16(entry[4:]))
+	offset += int(idx%d.span) - int(d.span/2)
+
+	for offset < 0 {
+		block--
+		offset += d.blockLength(data, block) + 1
+	}
+	for offset > d.blockLength(data, block) {
+		offset -= d.blockLength(data, block) + 1
+		block++
+	}
+
+	// Decode the Huffman symbols in the block until reaching the symbol containing our value.
+	ptr := d.dataOff + block*d.sizeofBlock
+	buf64 := binary.BigEndian.Uint64(data[ptr:])
+	ptr += 8
+	buf64Size := 64
+	var sym int
+	for {
+		l := 0
+		for buf64 < d.base64[l] {
+			l++
+		}
+		sym = int((buf64 - d.base64[l]) >> uint(64-l-d.minSymLen))
+		sym = (sym + int(d.lowestSym(data, l))) & 0xFFFF
+		if offset < int(d.symlen[sym])+1 {
+			break
+		}
+		offset -= int(d.symlen[sym]) + 1
+		l += d.minSymLen
+		buf64 <<= uint(l)
+		buf64Size -= l
+		if buf64Size <= 32 { // refill the buffer
+			buf64Size += 32
+			if ptr+4 <= len(data) {
+				buf64 |= uint64(binary.BigEndian.Uint32(data[ptr:])) << uint(64-buf64Size)
+			}
+			ptr += 4
+		}
+	}
+	// Expand the symbol until reaching the leaf that stores our value.
+	for d.symlen[sym] != 0 {
+		left := d.left(data, sym)
+		if offset < int(d.symlen[left])+1 {
+			sym = left
+		} else {
+			offset -= int(d.symlen[left]) + 1
+			sym = d.right(data, sym)
+		}
+	}
+	return d.left(data, sym)
+}
+
+// Returns the value stored for the position.
+func (t *tbTable) probe(brd *Board, wdl int, state *int) int {
+	stm, tbFile, idx := t.index(brd)
+	if t.dtz && !t.dtzStm(stm, tbFile) { // DTZ tables store only one side to move.
+		*state = PROBE_CHANGE_STM
+		return 0
+	}
+	return t.mapScore(tbFile, t.get(stm, tbFile).decompressPairs(t.data, idx), wdl)
+}
+
+// Computes the index of the position within the table, along with the side to move and file of
+// the leading pawn used to select the stored values.
+func (t *tbTable) index(brd *Board) (int, int, uint64) {
+	var squares [TB_PIECES]int
+	var pieces [TB_PIECES]uint8
+	var idx uint64
+	var leadPawns BB
+	var sq int
+	size, leadPawnsCnt, tbFile := 0, 0, 0
+
+	// Tables are stored with the stronger side as white. If black is the stronger side, or if
+	// the material is symmetric and black is to move, swap the colors and flip the board.
+	stm := int(brd.Enemy()) // tables use 0 for white and 1 for black.
+	flipColor, flipSquares := uint8(0), 0
+	if (t.key == t.key2 && brd.c == BLACK) || boardMaterialKey(brd) != t.key {
+		flipColor, flipSquares = 8, 56
+		stm ^= 1
+	}
+
+	// Tables with pawns are split by the file of the leading pawn: the pawn of the leading
+	// color nearest the edge and, of those, the one with the lowest rank.
+	if t.hasPawns {
+		leadColor := WHITE
+		if t.get(0, 0).pieces[0]^flipColor > 8 {
+			leadColor = BLACK
+		}
+		leadPawns = brd.pieces[leadColor][PAWN]
+		for b := leadPawns; b > 0; b.Clear(sq) {
+			sq = lsb(b)
+			squares[size] = sq ^ flipSquares
+			size++
+		}
+		leadPawnsCnt = size
+		lead := 0
+		for i := 1; i < leadPawnsCnt; i++ {
+			if tbMapPawns[squares[i]] > tbMapPawns[squares[lead]] {
+				lead = i
+			}
+		}
+		squares[0], squares[lead] = squares[lead], squares[0]
+		tbFile = min(column(squares[0]), 7-column(squares[0]))
+	}
+
+	for b := brd.AllOccupied() &^ leadPawns; b > 0; b.Clear(sq) {
+		sq = lsb(b)
+		squares[size] = sq ^ flipSquares
+		pieces[size] = tbPieceCode(brd, sq) ^ flipColor
+		size++
+	}
+
+	// Reorder the pieces to match the sequence stored in the table.
+	d := t.get(stm, tbFile)
+	for i := leadPawnsCnt; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	// Mirror the board so that the leading piece or pawn is on files a-d.
+	if column(squares[0]) > 3 {
+		for i := 0; i < size; i++ {
+			squares[i] ^= 7
+		}
+	}
+
+	if t.hasPawns {
+		idx = tbLeadPawnIdx[leadPawnsCnt][squares[0]]
+		sortSquares(squares[1:leadPawnsCnt], func(a, b int) bool { return tbMapPawns[a] < tbMapPawns[b] })
+		for i := 1; i < leadPawnsCnt; i++ {
+			idx += tbBinomial[i][tbMapPawns[squares[i]]]
+		}
+	} else {
+		// Without pawns, also mirror the board so that the leading piece is on ranks 1-4, and
+		// below the a1-h8 diagonal.
+		if row(squares[0]) > 3 {
+			for i := 0; i < size; i++ {
+				squares[i] ^= 56
+			}
+		}
+		for i := 0; i < d.groupLen[0]; i++ {
+			if offA1H8(squares[i]) == 0 {
+				continue
+			}
+			if offA1H8(squares[i]) > 0 { // flip along the a1-h8 diagonal.
+				for j := i; j < size; j++ {
+					squares[j] = ((squares[j] >> 3) | (squares[j] << 3)) & 63
+				}
+			}
+			break
+		}
+		if t.hasUniquePieces { // the kings and one other piece are encoded together.
+			adjust1 := boolToInt(squares[1] > squares[0])
+			adjust2 := boolToInt(squares[2] > squares[0]) + boolToInt(squares[2] > squares[1])
+			if offA1H8(squares[0]) != 0 {
+				idx = uint64((tbMapA1D1D4[squares[0]]*63+(squares[1]-adjust1))*62 + squares[2] - adjust2)
+			} else if offA1H8(squares[1]) != 0 {
+				idx = uint64((6*63+row(squares[0])*28+tbMapB1H1H7[squares[1]])*62 + squares[2] - adjust2)
+			} else if offA1H8(squares[2]) != 0 {
+				idx = uint64(6*63*62 + 4*28*62 + row(squares[0])*7*28 + (row(squares[1])-adjust1)*28 +
+					tbMapB1H1H7[squares[2]])
+			} else {
+				idx = uint64(6*63*62 + 4*28*62 + 4*7*28 + row(squares[0])*7*6 + (row(squares[1])-adjust1)*6 +
+					(row(squares[2]) - adjust2))
+			}
+		} else {
+			idx = uint64(tbMapKK[tbMapA1D1D4[squares[0]]][squares[1]])
+		}
+	}
+
+	// Encode the remaining groups. Squares occupied by earlier groups are skipped.
+	idx *= d.groupIdx[0]
+	start := d.groupLen[0]
+	remainingPawns := t.hasPawns && t.pawnCount[1] > 0
+	for next := 1; d.groupLen[next] != 0; next++ {
+		group := squares[start : start+d.groupLen[next]]
+		sortSquares(group, func(a, b int) bool { return a < b })
+		var n uint64
+		for i, sq := range group {
+			adjust := 0
+			for _, prev := range squares[:start] {
+				if sq > prev {
+					adjust++
+				}
+			}
+			if remainingPawns {
+				adjust += 8
+			}
+			n += tbBinomial[i+1][sq-adjust]
+		}
+		remainingPawns = false
+		idx += n * d.groupIdx[next]
+		start += d.groupLen[next]
+	}
+	return stm, tbFile, idx
+}
+
+func (t *tbTable) dtzStm(stm, f int) bool {
+	return int(t.get(stm, f).flags&TB_STM) == stm || (t.key == t.key2 && !t.hasPawns)
+}
+
+// Converts the stored value to a WDL result, or to a DTZ value in plies.
+func (t *tbTable) mapScore(f, value, wdl int) int {
+	if !t.dtz {
+		return value - 2
+	}
+	wdlMap := [5]int{1, 3, 0, 2, 0}
+	d := t.get(0, f)
+	if d.flags&TB_MAPPED > 0 {
+		if d.flags&TB_WIDE > 0 {
+			value = int(binary.LittleEndian.Uint16(t.data[t.mapOff+2*(d.mapIdx[wdlMap[wdl+2]]+value):]))
+		} else {
+			value = int(t.data[t.mapOff+d.mapIdx[wdlMap[wdl+2]]+value])
+		}
+	}
+	if (wdl == WDL_WIN && d.flags&TB_WIN_PLIES == 0) || (wdl == WDL_LOSS && d.flags&TB_LOSS_PLIES == 0) ||
+		wdl == WDL_CURSED_WIN || wdl == WDL_BLESSED_LOSS {
+		value *= 2 // value is stored in moves.
+	}
+	return value + 1
+}
+
+func sortSquares(squares []int, less func(a, b int) bool) { // stable insertion sort.
+	for i := 1; i < len(squares); i++ {
+		for j := i; j > 0 && less(squares[j], squares[j-1]); j-- {
+			squares[j], squares[j-1] = squares[j-1], squares[j]
+		}
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func probeTable(brd *Board, dtz bool, wdl int, state *int) int {
+	if popCount(brd.AllOccupied()) == 2 { // KvK
+		return WDL_DRAW
+	}
+	key := boardMaterialKey(brd)
+	t := tablebases.wdl[key]
+	if dtz {
+		t = tablebases.dtz[key]
+	}
+	if t == nil || !t.load() {
+		*state = PROBE_FAIL
+		return 0
+	}
+	return t.probe(brd, wdl, state)
+}
+
+// Tables don't store reliable values for positions where the best move is a capture (or, for DTZ
+// tables, a pawn move), or for positions with an en passant capture available. The captures are
+// searched here, and the best of the results is used.
+func tbSearch(brd *Board, checkZeroing bool, state *int) int {
+	bestValue := WDL_LOSS
+	moves := perftMoves(brd)
+	moveCount := 0
+	memento := brd.NewMemento()
+	for _, m := range moves {
+		if !m.IsCapture() && (!checkZeroing || m.Piece() != PAWN) {
+			continue
+		}
+		moveCount++
+		makeMove(brd, m)
+		value := -tbSearch(brd, false, state)
+		unmakeMove(brd, m, memento)
+		if *state == PROBE_FAIL {
+			return WDL_DRAW
+		}
+		if value > bestValue {
+			bestValue = value
+			if value >= WDL_WIN {
+				*state = PROBE_ZEROING_BEST_MOVE // winning capture or pawn move
+				return value
+			}
+		}
+	}
+	// If all legal moves were searched, the stored value may be wrong and isn't needed.
+	noMoreMoves := moveCount > 0 && moveCount == len(moves)
+	value := bestValue
+	if !noMoreMoves {
+		value = probeTable(brd, false, WDL_DRAW, state)
+		if *state == PROBE_FAIL {
+			return WDL_DRAW
+		}
+	}
+	if bestValue >= value {
+		if bestValue > WDL_DRAW || noMoreMoves {
+			*state = PROBE_ZEROING_BEST_MOVE
+		} else {
+			*state = PROBE_OK
+		}
+		return bestValue
+	}
+	*state = PROBE_OK
+	return value
+}
+
+// Returns true if the position may be found in the available tables.
+func tbAvailable(brd *Board) bool {
+	return tablebases != nil && brd.castle == 0 && popCount(brd.AllOccupied()) <= tablebases.cardinality
+}
+
+// ProbeWDL returns the WDL result for the side to move. Only safe to call when tbAvailable(brd).
+func probeWDL(brd *Board) (int, bool) {
+	state := PROBE_OK
+	wdl := tbSearch(brd, false, &state)
+	return wdl, state != PROBE_FAIL
+}
+
+// ProbeDTZ returns the number of plies to the next zeroing move for the side to move: positive
+// if winning, negative if losing, and 0 if drawn. A value of 100 or more (in absolute terms)
+// indicates a win or loss that will be frustrated by the 50-move rule.
+func probeDTZ(brd *Board, state *int) int {
+	*state = PROBE_OK
+	wdl := tbSearch(brd, true, state)
+	if *state == PROBE_FAIL || wdl == WDL_DRAW { // DTZ tables don't store draws.
+		return 0
+	}
+	if *state == PROBE_ZEROING_BEST_MOVE {
+		return dtzBeforeZeroing(wdl)
+	}
+	dtz := probeTable(brd, true, wdl, state)
+	if *state == PROBE_FAIL {
+		return 0
+	}
+	if *state != PROBE_CHANGE_STM {
+		if wdl == WDL_BLESSED_LOSS || wdl == WDL_CURSED_WIN {
+			dtz += 100
+		}
+		return dtz * sign(wdl)
+	}
+	// The table stores the other side to move, so do a 1-ply search and find the winning move
+	// that minimizes DTZ.
+	minDTZ := 0xFFFF
+	memento := brd.NewMemento()
+	for _, m := range perftMoves(brd) {
+		zeroing := m.IsCapture() || m.Piece() == PAWN
+		makeMove(brd, m)
+		// For zeroing moves we want the DTZ before making the move.
+		if zeroing {
+			dtz = -dtzBeforeZeroing(tbSearch(brd, false, state))
+		} else {
+			dtz = -probeDTZ(brd, state)
+		}
+		if dtz == 1 && brd.InCheck() && len(perftMoves(brd)) == 0 {
+			minDTZ = 1 // the move mates.
+		}
+		if !zeroing {
+			dtz += sign(dtz)
+		}
+		if dtz < minDTZ && sign(dtz) == sign(wdl) {
+			minDTZ = dtz
+		}
+		unmakeMove(brd, m, memento)
+		if *state == PROBE_FAIL {
+			return 0
+		}
+	}
+	if minDTZ == 0xFFFF { // no legal moves: the position is mate.
+		return -1
+	}
+	return minDTZ
+}
+
+func dtzBeforeZeroing(wdl int) int {
+	switch wdl {
+	case WDL_WIN:
+		return 1
+	case WDL_CURSED_WIN:
+		return 101
+	case WDL_BLESSED_LOSS:
+		return -101
+	case WDL_LOSS:
+		return -1
+	default:
+		return 0
+	}
+}
+
+func sign(x int) int {
+	if x > 0 {
+		return 1
+	} else if x < 0 {
+		return -1
+	}
+	return 0
+}
+
+// Ranks each root move using the DTZ tables. Wins within reach of the 50-move rule are ranked
+// highest, losses that can't be saved by the 50-move rule are ranked lowest. The dtz of each move,
+// as seen from the root, is also returned so that winning moves can be compared.
+func rankRootMoves(brd *Board, moves []Move) ([]int, []int, bool) {
+	state := PROBE_OK
+	ranks, dtzs := make([]int, len(moves)), make([]int, len(moves))
+	halfmoveClock := int(brd.halfmoveClock)
+	memento := brd.NewMemento()
+	var dtz int
+	for i, m := range moves {
+		makeMove(brd, m)
+		if brd.halfmoveClock == 0 { // zeroing move
+			wdl, ok := probeWDL(brd)
+			if !ok {
+				state = PROBE_FAIL
+			}
+			dtz = dtzBeforeZeroing(-wdl)
+		} else {
+			dtz = -probeDTZ(brd, &state)
+			dtz += sign(dtz) // correct by 1 ply for the move made at the root.
+		}
+		if dtz == 2 && brd.InCheck() && len(perftMoves(brd)) == 0 {
+			dtz = 1 // the move mates.
+		}
+		unmakeMove(brd, m, memento)
+		if state == PROBE_FAIL {
+			return nil, nil, false
+		}
+		dtzs[i] = dtz
+		if dtz > 0 {
+			if dtz+halfmoveClock <= 99 {
+				ranks[i] = 1000
+			} else {
+				ranks[i] = 1000 - (dtz + halfmoveClock)
+			}
+		} else if dtz < 0 {
+			if -dtz*2+halfmoveClock < 100 {
+				ranks[i] = -1000
+			} else {
+				ranks[i] = -1000 + (-dtz + halfmoveClock)
+			}
+		}
+	}
+	return ranks, dtzs, true
+}
+
+// Returns the index of the best ranked root move. Of equally ranked winning moves, the one with the
+// lowest dtz is preferred.
+func bestRootRank(ranks, dtzs []int) int {
+	best := 0
+	for i := range ranks {
+		if ranks[i] > ranks[best] || (ranks[i] == ranks[best] && dtzs[i] > 0 && dtzs[i] < dtzs[best]) {
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,1468 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Generates the Syzygy tables in test_suites/syzygy used by the probing tests. Each ending is
+// solved by retrograde analysis with a move generator independent of the engine's, and the
+// results are written in the Syzygy file format: values are compressed by recursive pairing
+// and canonical Huffman codes.
+
+// Positions are indexed as in the original Syzygy code (encode_piece and encode_pawn in
+// tbcore.c), which is formulated differently from the index calculation in syzygy.go, so the
+// probing code isn't checked against itself. The tables vary the piece order, group order and
+// DTZ format between sides and files so that each path through the probing code is used.
+
+// To regenerate the tables: go test -run 'TestSyzygyFixtures|TestProbeAllPositions' -args -gensyzygy
+// Endings of 4 pieces take several minutes to solve, so otherwise only the 3-piece tables are
+// compared with the generator.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var genSyzygyFlag = flag.Bool("gensyzygy", false, "Rewrites the Syzygy tables used by the probing tests.")
+
+// Endings are solved in this order, so that captures and promotions can be looked up in earlier
+// solutions. KRvKP promotes to each of the KRvK* endings.
+var syzygyFixtures = []string{"KQvK", "KRvK", "KBvK", "KNvK", "KPvK", "KQvKR", "KRvKR", "KRvKB", "KRvKN",
+	"KNNvK", "KRRvK", "KRvKP"}
+
+// tbGenFormat varies the way DTZ values are stored.
+type tbGenFormat struct {
+	blackToMove [4]bool // values are stored with black to move, by file of the leading pawn.
+	mapped      bool    // values are remapped for each WDL result.
+}
+
+var tbGenFormats = map[string]tbGenFormat{
+	"KPvK":  {blackToMove: [4]bool{true, true, true, true}},
+	"KQvKR": {mapped: true},
+	"KRvKP": {blackToMove: [4]bool{false, true, false, true}, mapped: true},
+}
+
+const (
+	TB_GEN_UNKNOWN    = 100 // wdl of a position not yet solved.
+	TB_GEN_INF        = 1 << 14
+	TB_GEN_MAX_SYM    = 32 // longest Huffman code the probing code can decode.
+	TB_GEN_MAX_SOLVED = 3  // largest ending solved when not regenerating the tables.
+)
+
+type tbGenPiece struct {
+	c  uint8
+	pc Piece
+}
+
+// tbSolution holds the WDL and DTZ value of every position of an ending, with white as the
+// stronger side. Positions are indexed by the square of each piece, then the side to move.
+type tbSolution struct {
+	name    string
+	pieces  []tbGenPiece
+	legal   []bool
+	wdl     []int8
+	dtz     []int16
+	zeroing []bool // a capture or pawn move wins, or every move is one, so DTZ isn't probed.
+}
+
+var tbSolutions map[string]*tbSolution
+var tbSolveOnce sync.Once
+
+func solvedFixtures() map[string]*tbSolution {
+	tbSolveOnce.Do(func() {
+		tbSolutions = make(map[string]*tbSolution)
+		for _, name := range syzygyFixtures {
+			if len(name)-1 <= TB_GEN_MAX_SOLVED || *genSyzygyFlag {
+				tbSolutions[name] = solveEnding(name, tbSolutions)
+			}
+		}
+	})
+	return tbSolutions
+}
+
+func tbGenPieces(name string) []tbGenPiece {
+	var pieces []tbGenPiece
+	for i, side := range strings.Split(name, "v") {
+		c := uint8(WHITE)
+		if i > 0 {
+			c = BLACK
+		}
+		for _, r := range side {
+			pieces = append(pieces, tbGenPiece{c, tbPieceChars[r]})
+		}
+	}
+	return pieces
+}
+
+// tbGenName names the material of pieces, white first.
+func tbGenName(pieces []tbGenPiece) string {
+	var sides [2]string
+	for _, pc := range []Piece{KING, QUEEN, ROOK, BISHOP, KNIGHT, PAWN} {
+		for _, p := range pieces {
+			if p.pc == pc {
+				sides[p.c] += string("PNBRQK"[pc])
+			}
+		}
+	}
+	return sides[WHITE] + "v" + sides[BLACK]
+}
+
+func tbGenFlipColors(pieces []tbGenPiece) []tbGenPiece {
+	flipped := make([]tbGenPiece, len(pieces))
+	for i, p := range pieces {
+		flipped[i] = tbGenPiece{p.c ^ 1, p.pc}
+	}
+	return flipped
+}
+
+func tbGenIndex(squares []int, c uint8) int {
+	idx := 0
+	for _, sq := range squares {
+		idx = idx*64 + sq
+	}
+	return idx*2 + int(c)
+}
+
+func tbGenSquares(idx, n int) ([]int, uint8) {
+	squares := make([]int, n)
+	return squares, tbGenDecode(idx, squares)
+}
+
+// tbGenDecode fills in the square of each piece, and returns the side to move.
+func tbGenDecode(idx int, squares []int) uint8 {
+	c := uint8(idx & 1)
+	idx >>= 1
+	for i := len(squares) - 1; i >= 0; i-- {
+		squares[i] = idx & 63
+		idx >>= 6
+	}
+	return c
+}
+
+var tbGenSteps = map[Piece][][2]int{
+	KNIGHT: {{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}},
+	BISHOP: {{1, 1}, {1, -1}, {-1, 1}, {-1, -1}},
+	ROOK:   {{1, 0}, {-1, 0}, {0, 1}, {0, -1}},
+	QUEEN:  {{1, 1}, {1, -1}, {-1, 1}, {-1, -1}, {1, 0}, {-1, 0}, {0, 1}, {0, -1}},
+	KING:   {{1, 1}, {1, -1}, {-1, 1}, {-1, -1}, {1, 0}, {-1, 0}, {0, 1}, {0, -1}},
+}
+
+var (
+	tbGenLines       [6][64]uint64 // squares attacked by each piece on an empty board.
+	tbGenPawnAttacks [2][64]uint64
+	tbGenBetween     [64][64]uint64 // squares strictly between two squares on a line.
+)
+
+// Tables from the original Syzygy probing code, with a1 first. They're written out rather than
+// derived like the maps in syzygy.go.
+var tbGenOffDiag = [64]int{
+	0, -1, -1, -1, -1, -1, -1, -1,
+	1, 0, -1, -1, -1, -1, -1, -1,
+	1, 1, 0, -1, -1, -1, -1, -1,
+	1, 1, 1, 0, -1, -1, -1, -1,
+	1, 1, 1, 1, 0, -1, -1, -1,
+	1, 1, 1, 1, 1, 0, -1, -1,
+	1, 1, 1, 1, 1, 1, 0, -1,
+	1, 1, 1, 1, 1, 1, 1, 0,
+}
+
+var tbGenTriangle = [64]int{
+	6, 0, 1, 2, 2, 1, 0, 6,
+	0, 7, 3, 4, 4, 3, 7, 0,
+	1, 3, 8, 5, 5, 8, 3, 1,
+	2, 4, 5, 9, 9, 5, 4, 2,
+	2, 4, 5, 9, 9, 5, 4, 2,
+	1, 3, 8, 5, 5, 8, 3, 1,
+	0, 7, 3, 4, 4, 3, 7, 0,
+	6, 0, 1, 2, 2, 1, 0, 6,
+}
+
+var tbGenInvTriangle = [10]int{1, 2, 3, 10, 11, 19, 0, 9, 18, 27}
+
+var tbGenLower = [64]int{
+	28, 0, 1, 2, 3, 4, 5, 6,
+	0, 29, 7, 8, 9, 10, 11, 12,
+	1, 7, 30, 13, 14, 15, 16, 17,
+	2, 8, 13, 31, 18, 19, 20, 21,
+	3, 9, 14, 18, 32, 22, 23, 24,
+	4, 10, 15, 19, 22, 33, 25, 26,
+	5, 11, 16, 20, 23, 25, 34, 27,
+	6, 12, 17, 21, 24, 26, 27, 35,
+}
+
+var tbGenDiag = [64]int{
+	0, 0, 0, 0, 0, 0, 0, 8,
+	0, 1, 0, 0, 0, 0, 9, 0,
+	0, 0, 2, 0, 0, 10, 0, 0,
+	0, 0, 0, 3, 11, 0, 0, 0,
+	0, 0, 0, 12, 4, 0, 0, 0,
+	0, 0, 13, 0, 0, 5, 0, 0,
+	0, 14, 0, 0, 0, 0, 6, 0,
+	15, 0, 0, 0, 0, 0, 0, 7,
+}
+
+var tbGenFlap = [64]int{
+	0, 0, 0, 0, 0, 0, 0, 0,
+	0, 6, 12, 18, 18, 12, 6, 0,
+	1, 7, 13, 19, 19, 13, 7, 1,
+	2, 8, 14, 20, 20, 14, 8, 2,
+	3, 9, 15, 21, 21, 15, 9, 3,
+	4, 10, 16, 22, 22, 16, 10, 4,
+	5, 11, 17, 23, 23, 17, 11, 5,
+	0, 0, 0, 0, 0, 0, 0, 0,
+}
+
+var tbGenPawnTwist = [64]int{
+	0, 0, 0, 0, 0, 0, 0, 0,
+	47, 35, 23, 11, 10, 22, 34, 46,
+	45, 33, 21, 9, 8, 20, 32, 44,
+	43, 31, 19, 7, 6, 18, 30, 42,
+	41, 29, 17, 5, 4, 16, 28, 40,
+	39, 27, 15, 3, 2, 14, 26, 38,
+	37, 25, 13, 1, 0, 12, 24, 36,
+	0, 0, 0, 0, 0, 0, 0, 0,
+}
+
+var tbGenFileToFile = [8]int{0, 1, 2, 3, 3, 2, 1, 0}
+
+var (
+	tbGenKKIdx      [10][64]int
+	tbGenPawnIdx    [5][24]uint64 // by number of leading pawns - 1, then flap value.
+	tbGenPawnFactor [5][4]uint64
+)
+
+func init() {
+	for sq := 0; sq < 64; sq++ {
+		for pc, steps := range tbGenSteps {
+			for _, step := range steps {
+				var between uint64
+				for r, f := row(sq)+step[0], column(sq)+step[1]; r >= 0 && r < 8 && f >= 0 && f < 8; r, f = r+step[0],
+					f+step[1] {
+					to := Square(r, f)
+					tbGenLines[pc][sq] |= 1 << uint(to)
+					tbGenBetween[sq][to] = between
+					between |= 1 << uint(to)
+					if pc == KNIGHT || pc == KING {
+						break
+					}
+				}
+			}
+		}
+		for c, forward := range []int{-1, 1} { // black, then white
+			for _, df := range []int{-1, 1} {
+				if r, f := row(sq)+forward, column(sq)+df; r >= 0 && r < 8 && f >= 0 && f < 8 {
+					tbGenPawnAttacks[c][sq] |= 1 << uint(Square(r, f))
+				}
+			}
+		}
+	}
+	// The kings are numbered in the order of the KK_idx table: placements with both kings on the
+	// a1-h8 diagonal come last.
+	var bothOnDiagonal [][2]int
+	code := 0
+	for t, sq1 := range tbGenInvTriangle {
+		for sq2 := 0; sq2 < 64; sq2++ {
+			tbGenKKIdx[t][sq2] = -1
+			if abs(row(sq1)-row(sq2)) <= 1 && abs(column(sq1)-column(sq2)) <= 1 {
+				continue
+			} else if tbGenOffDiag[sq1] == 0 && tbGenOffDiag[sq2] > 0 {
+				continue
+			} else if tbGenOffDiag[sq1] == 0 && tbGenOffDiag[sq2] == 0 {
+				bothOnDiagonal = append(bothOnDiagonal, [2]int{t, sq2})
+			} else {
+				tbGenKKIdx[t][sq2] = code
+				code++
+			}
+		}
+	}
+	for _, pair := range bothOnDiagonal {
+		tbGenKKIdx[pair[0]][pair[1]] = code
+		code++
+	}
+	for n := 1; n <= 5; n++ {
+		for f := 0; f < 4; f++ {
+			var s uint64
+			for r := 1; r <= 6; r++ {
+				sq := Square(r, f)
+				tbGenPawnIdx[n-1][tbGenFlap[sq]] = s
+				if n == 1 {
+					s++
+				} else {
+					s += tbGenChoose(tbGenPawnTwist[sq], n-1)
+				}
+			}
+			tbGenPawnFactor[n-1][f] = s
+		}
+	}
+}
+
+func tbGenChoose(n, k int) uint64 {
+	if k > n || n < 0 {
+		return 0
+	}
+	result := uint64(1)
+	for i := 0; i < k; i++ {
+		result = result * uint64(n-i) / uint64(i+1)
+	}
+	return result
+}
+
+func tbGenAttacks(p tbGenPiece, from, to int, occupied uint64) bool {
+	if p.pc == PAWN {
+		return tbGenPawnAttacks[p.c][from]&(1<<uint(to)) > 0
+	}
+	return tbGenLines[p.pc][from]&(1<<uint(to)) > 0 && tbGenBetween[from][to]&occupied == 0
+}
+
+// tbGenInCheck returns true if the king of side c is attacked. The piece at index skip, if any,
+// has been captured.
+func tbGenInCheck(pieces []tbGenPiece, squares []int, c uint8, skip int) bool {
+	var occupied uint64
+	king := -1
+	for i, sq := range squares {
+		if i == skip {
+			continue
+		}
+		occupied |= 1 << uint(sq)
+		if pieces[i].c == c && pieces[i].pc == KING {
+			king = sq
+		}
+	}
+	for i, p := range pieces {
+		if i != skip && p.c != c && tbGenAttacks(p, squares[i], king, occupied) {
+			return true
+		}
+	}
+	return false
+}
+
+// tbGenLegal returns true if no two pieces share a square, no pawn is on the first or last row,
+// and the side that just moved isn't in check.
+func tbGenLegal(pieces []tbGenPiece, squares []int, c uint8) bool {
+	var occupied uint64
+	for i, sq := range squares {
+		if occupied&(1<<uint(sq)) > 0 || (pieces[i].pc == PAWN && (row(sq) == 0 || row(sq) == 7)) {
+			return false
+		}
+		occupied |= 1 << uint(sq)
+	}
+	return !tbGenInCheck(pieces, squares, c^1, -1)
+}
+
+// tbGenTransition maps the positions reached by a capture or promotion onto an ending that has
+// already been solved, reversing the colors if needed.
+type tbGenTransition struct {
+	sol   *tbSolution // nil for KvK.
+	slots []int       // the piece of the new position placed in each slot of sol.
+	flip  bool
+}
+
+func (tr *tbGenTransition) wdl(squares []int, c uint8) int8 {
+	if tr.sol == nil {
+		return WDL_DRAW
+	}
+	idx := 0
+	for _, slot := range tr.slots {
+		sq := squares[slot]
+		if tr.flip {
+			sq ^= 56
+		}
+		idx = idx*64 + sq
+	}
+	if tr.flip {
+		c ^= 1
+	}
+	return tr.sol.wdl[idx*2+int(c)]
+}
+
+type tbGen struct {
+	sol         *tbSolution
+	solved      map[string]*tbSolution
+	transitions map[[3]int]*tbGenTransition
+	place       []int // place[i] is 64^(n-1-i), to update the index when piece i moves.
+}
+
+// transition describes the ending reached when piece captured is removed and the piece promoted
+// (or -1) becomes pc.
+func (g *tbGen) transition(captured, promoted int, pc Piece) *tbGenTransition {
+	key := [3]int{captured, promoted, int(pc)}
+	if tr, ok := g.transitions[key]; ok {
+		return tr
+	}
+	var pieces []tbGenPiece
+	for i, p := range g.sol.pieces {
+		if i == promoted {
+			p.pc = pc
+		}
+		if i != captured {
+			pieces = append(pieces, p)
+		}
+	}
+	tr := &tbGenTransition{}
+	if name := tbGenName(pieces); name != "KvK" {
+		var ok bool
+		if tr.sol, ok = g.solved[name]; !ok {
+			pieces, tr.flip = tbGenFlipColors(pieces), true
+			if tr.sol, ok = g.solved[tbGenName(pieces)]; !ok {
+				panic(fmt.Sprintf("%s must be solved first", name))
+			}
+		}
+		used := make([]bool, len(pieces))
+		for _, p := range tr.sol.pieces {
+			for j := range pieces {
+				if !used[j] && pieces[j] == p {
+					tr.slots, used[j] = append(tr.slots, j), true
+					break
+				}
+			}
+		}
+	}
+	g.transitions[key] = tr
+	return tr
+}
+
+// forEachMove calls fn with the result of each legal move for the side to move c: the index of
+// the position reached in the same ending, or -1 and the WDL value of a position in another
+// ending.
+func (g *tbGen) forEachMove(idx int, squares []int, c uint8, fn func(child int, wdl int8, zeroing bool)) {
+	pieces := g.sol.pieces
+	var occupied, own uint64
+	for i, sq := range squares {
+		occupied |= 1 << uint(sq)
+		if pieces[i].c == c {
+			own |= 1 << uint(sq)
+		}
+	}
+	var childSquares [TB_PIECES]int
+	for i, p := range pieces {
+		if p.c != c {
+			continue
+		}
+		from := squares[i]
+		var targets uint64
+		switch p.pc {
+		case PAWN:
+			targets = tbGenPawnAttacks[c][from] & occupied &^ own
+			forward, start := 8, 1
+			if c == BLACK {
+				forward, start = -8, 6
+			}
+			if to := from + forward; occupied&(1<<uint(to)) == 0 {
+				targets |= 1 << uint(to)
+				if to += forward; row(from) == start && occupied&(1<<uint(to)) == 0 {
+					targets |= 1 << uint(to)
+				}
+			}
+		case KNIGHT, KING:
+			targets = tbGenLines[p.pc][from] &^ own
+		default:
+			for b := BB(tbGenLines[p.pc][from] &^ own); b > 0; b.Clear(lsb(b)) {
+				if to := lsb(b); tbGenBetween[from][to]&occupied == 0 {
+					targets |= 1 << uint(to)
+				}
+			}
+		}
+		for b := BB(targets); b > 0; b.Clear(lsb(b)) {
+			to := lsb(b)
+			captured := -1
+			for j, sq := range squares {
+				if sq == to {
+					captured = j
+				}
+			}
+			copy(childSquares[:], squares)
+			childSquares[i] = to
+			if tbGenInCheck(pieces, childSquares[:len(squares)], c, captured) {
+				continue
+			}
+			zeroing := captured >= 0 || p.pc == PAWN
+			promotion := p.pc == PAWN && (row(to) == 0 || row(to) == 7)
+			if captured < 0 && !promotion {
+				fn(((idx>>1)+(to-from)*g.place[i])<<1|int(c^1), 0, zeroing)
+				continue
+			}
+			if captured >= 0 {
+				copy(childSquares[captured:], childSquares[captured+1:len(squares)])
+			}
+			child := childSquares[:len(squares)-boolToInt(captured >= 0)]
+			if !promotion {
+				fn(-1, g.transition(captured, -1, EMPTY).wdl(child, c^1), zeroing)
+				continue
+			}
+			for _, pc := range []Piece{QUEEN, ROOK, BISHOP, KNIGHT} {
+				fn(-1, g.transition(captured, i, pc).wdl(child, c^1), zeroing)
+			}
+		}
+	}
+}
+
+// forEachUnmove calls fn with the index of each position from which the side that just moved
+// could have reached this one without a capture or promotion. Pawn moves are included only if
+// pawns is true. The positions found may be illegal.
+func (g *tbGen) forEachUnmove(idx int, squares []int, c uint8, pawns bool, fn func(parent int)) {
+	pieces := g.sol.pieces
+	var occupied uint64
+	for _, sq := range squares {
+		occupied |= 1 << uint(sq)
+	}
+	moved := c ^ 1
+	for i, p := range pieces {
+		if p.c != moved {
+			continue
+		}
+		from := squares[i]
+		var origins uint64
+		switch p.pc {
+		case PAWN:
+			if !pawns {
+				continue
+			}
+			back, start := -8, 1
+			if moved == BLACK {
+				back, start = 8, 6
+			}
+			if to := from + back; row(to) > 0 && row(to) < 7 && occupied&(1<<uint(to)) == 0 {
+				origins |= 1 << uint(to)
+				if to += back; row(to) == start && occupied&(1<<uint(to)) == 0 {
+					origins |= 1 << uint(to)
+				}
+			}
+		case KNIGHT, KING:
+			origins = tbGenLines[p.pc][from] &^ occupied
+		default:
+			for b := BB(tbGenLines[p.pc][from] &^ occupied); b > 0; b.Clear(lsb(b)) {
+				if to := lsb(b); tbGenBetween[from][to]&occupied == 0 {
+					origins |= 1 << uint(to)
+				}
+			}
+		}
+		for b := BB(origins); b > 0; b.Clear(lsb(b)) {
+			fn(((idx>>1)+(lsb(b)-from)*g.place[i])<<1 | int(moved))
+		}
+	}
+}
+
+// solveEnding finds the WDL value of each position by working back from mates and from moves into
+// endings already solved, then finds the DTZ value of each won or lost position the same way.
+func solveEnding(name string, solved map[string]*tbSolution) *tbSolution {
+	pieces := tbGenPieces(name)
+	n := len(pieces)
+	size := 2 << uint(6*n)
+	sol := &tbSolution{name: name, pieces: pieces, legal: make([]bool, size), wdl: make([]int8, size),
+		dtz: make([]int16, size), zeroing: make([]bool, size)}
+	g := &tbGen{sol: sol, solved: solved, transitions: make(map[[3]int]*tbGenTransition),
+		place: make([]int, n)}
+	for i := range g.place {
+		g.place[i] = 1 << uint(6*(n-1-i))
+	}
+	// pending counts the moves from each position not yet known to lose.
+	pending := make([]uint8, size)
+	var squares [TB_PIECES]int
+	var next []int
+	for idx := range sol.legal {
+		sol.wdl[idx] = TB_GEN_UNKNOWN
+		c := tbGenDecode(idx, squares[:n])
+		if !tbGenLegal(pieces, squares[:n], c) {
+			continue
+		}
+		sol.legal[idx] = true
+		moves, win := 0, false
+		g.forEachMove(idx, squares[:n], c, func(child int, wdl int8, zeroing bool) {
+			moves++
+			if child >= 0 || wdl == WDL_DRAW {
+				pending[idx]++
+			} else if wdl == WDL_LOSS {
+				win = true
+			}
+		})
+		if moves == 0 && !tbGenInCheck(pieces, squares[:n], c, -1) {
+			sol.wdl[idx] = WDL_DRAW // stalemate
+		} else if moves == 0 {
+			sol.wdl[idx], sol.dtz[idx] = WDL_LOSS, -1 // mated
+			next = append(next, idx)
+		} else if win {
+			sol.wdl[idx] = WDL_WIN
+			next = append(next, idx)
+		} else if pending[idx] == 0 {
+			sol.wdl[idx] = WDL_LOSS
+			next = append(next, idx)
+		}
+	}
+	for len(next) > 0 {
+		current := next
+		next = nil
+		for _, idx := range current {
+			c := tbGenDecode(idx, squares[:n])
+			g.forEachUnmove(idx, squares[:n], c, true, func(parent int) {
+				if !sol.legal[parent] || sol.wdl[parent] != TB_GEN_UNKNOWN {
+					return
+				}
+				if sol.wdl[idx] == WDL_LOSS {
+					sol.wdl[parent] = WDL_WIN
+					next = append(next, parent)
+				} else if pending[parent]--; pending[parent] == 0 {
+					sol.wdl[parent] = WDL_LOSS
+					next = append(next, parent)
+				}
+			})
+		}
+	}
+	for idx, legal := range sol.legal {
+		if legal && sol.wdl[idx] == TB_GEN_UNKNOWN {
+			sol.wdl[idx] = WDL_DRAW
+		}
+	}
+
+	// Winning positions take the shortest path to a zeroing move or mate, and losing positions the
+	// longest. DTZ is counted in plies, and is negative for the losing side. Positions are
+	// resolved in order of distance, starting with those 1 ply from a zeroing move or mate.
+	for idx, wdl := range sol.wdl {
+		if wdl != WDL_WIN {
+			continue
+		}
+		c := tbGenDecode(idx, squares[:n])
+		g.forEachMove(idx, squares[:n], c, func(child int, wdl int8, zeroing bool) {
+			if child >= 0 {
+				wdl = sol.wdl[child]
+			}
+			if wdl == WDL_LOSS && zeroing {
+				sol.dtz[idx], sol.zeroing[idx] = 1, true
+			} else if wdl == WDL_LOSS && child >= 0 && sol.dtz[child] == -1 {
+				sol.dtz[idx] = 1 // mate
+			}
+		})
+		if sol.dtz[idx] == 1 {
+			next = append(next, idx)
+		}
+	}
+	for idx, wdl := range sol.wdl {
+		if wdl != WDL_LOSS || sol.dtz[idx] == -1 {
+			continue
+		}
+		c := tbGenDecode(idx, squares[:n])
+		pending[idx] = 0
+		g.forEachMove(idx, squares[:n], c, func(child int, wdl int8, zeroing bool) {
+			if !zeroing {
+				pending[idx]++
+			}
+		})
+		if pending[idx] == 0 {
+			sol.dtz[idx], sol.zeroing[idx] = -1, true
+			next = append(next, idx)
+		}
+	}
+	for d := int16(1); len(next) > 0; d++ {
+		if d >= 100 {
+			panic(fmt.Sprintf("%s: cursed wins and blessed losses aren't supported", name))
+		}
+		current := next
+		next = nil
+		for _, idx := range current {
+			c := tbGenDecode(idx, squares[:n])
+			g.forEachUnmove(idx, squares[:n], c, false, func(parent int) {
+				if !sol.legal[parent] || sol.dtz[parent] != 0 {
+					return
+				}
+				if sol.wdl[idx] == WDL_LOSS && sol.wdl[parent] == WDL_WIN {
+					sol.dtz[parent] = d + 1
+					next = append(next, parent)
+				} else if sol.wdl[idx] == WDL_WIN && sol.wdl[parent] == WDL_LOSS {
+					if pending[parent]--; pending[parent] == 0 {
+						sol.dtz[parent] = -(d + 1)
+						next = append(next, parent)
+					}
+				}
+			})
+		}
+	}
+	for idx, wdl := range sol.wdl {
+		if (wdl == WDL_WIN || wdl == WDL_LOSS) && sol.dtz[idx] == 0 {
+			panic(fmt.Sprintf("%s: no DTZ value found for position %d", name, idx))
+		}
+	}
+	return sol
+}
+
+// tbGenBoard sets up a position of an ending.
+func tbGenBoard(pieces []tbGenPiece, squares []int, c uint8) *Board {
+	brd := EmptyBoard()
+	for i, p := range pieces {
+		addPiece(brd, p.pc, squares[i], p.c)
+	}
+	brd.c = c
+	return brd
+}
+
+func tbGenCode(p tbGenPiece) uint8 {
+	code := uint8(p.pc) + 1
+	if p.c == BLACK {
+		code |= 8
+	}
+	return code
+}
+
+// tbGenLayout describes how the positions of an ending are stored: the order of the pieces and
+// of the groups for each side to move (white first) and file of the leading pawn, as read from
+// the table header.
+type tbGenLayout struct {
+	symmetric bool
+	pawns     [2]int // pawns of the leading color, then the other color.
+	encType   int    // 0 if three unique pieces lead, or 2 if the kings lead. Pawnless tables only.
+	pieces    [2][4][]uint8
+	order     [2][4][2]int // the position of the leading group, then of the other color's pawns.
+	norm      [2][4][]int  // the size of the group starting at each piece.
+	factor    [2][4][]uint64
+	size      [2][4]uint64
+}
+
+// newTbGenLayout lists the pieces as they're named, with pawns of the leading color first, and
+// for tables without pawns the unique pieces (or the kings) first. The order of the pieces and
+// groups is reversed for black to move, and for alternate files.
+func newTbGenLayout(pieces []tbGenPiece) *tbGenLayout {
+	l := &tbGenLayout{symmetric: tbGenName(pieces) == tbGenName(tbGenFlipColors(pieces))}
+	var counts [2][6]int
+	for _, p := range pieces {
+		counts[p.c][p.pc]++
+	}
+	leadColor := uint8(WHITE)
+	l.pawns = [2]int{counts[WHITE][PAWN], counts[BLACK][PAWN]}
+	if counts[BLACK][PAWN] > 0 && (counts[WHITE][PAWN] == 0 || counts[BLACK][PAWN] < counts[WHITE][PAWN]) {
+		leadColor, l.pawns = BLACK, [2]int{counts[BLACK][PAWN], counts[WHITE][PAWN]}
+	}
+	l.encType = 2
+	for pc := PAWN; pc < KING; pc++ {
+		if counts[WHITE][pc] == 1 || counts[BLACK][pc] == 1 {
+			l.encType = 0
+		}
+	}
+	var leading, others []tbGenPiece
+	for _, p := range pieces {
+		if l.pawns[0] > 0 && p.pc == PAWN && p.c == leadColor {
+			leading = append(leading, p)
+		} else if l.pawns[0] == 0 && (l.encType == 0 && counts[p.c][p.pc] == 1 || l.encType == 2 && p.pc == KING) {
+			leading = append(leading, p)
+		}
+	}
+	for _, p := range pieces {
+		if p.pc == PAWN && l.pawns[0] > 0 && p.c != leadColor {
+			others = append(others, p)
+		}
+	}
+	for _, p := range pieces {
+		if p.pc != PAWN && !(l.pawns[0] == 0 && (l.encType == 0 && counts[p.c][p.pc] == 1 ||
+			l.encType == 2 && p.pc == KING)) {
+			others = append(others, p)
+		}
+	}
+	files := 1
+	if l.pawns[0] > 0 {
+		files = 4
+	}
+	for side := 0; side < 2; side++ {
+		for f := 0; f < files; f++ {
+			reverse := (side+f)%2 == 1
+			var codes []uint8
+			if l.pawns[0] > 0 {
+				for _, p := range leading {
+					codes = append(codes, tbGenCode(p))
+				}
+				pieceCodes := make([]uint8, 0, len(others))
+				for _, p := range others {
+					if p.pc == PAWN {
+						codes = append(codes, tbGenCode(p))
+					} else {
+						pieceCodes = append(pieceCodes, tbGenCode(p))
+					}
+				}
+				if reverse {
+					tbGenReverse(pieceCodes)
+				}
+				codes = append(codes, pieceCodes...)
+			} else {
+				for _, p := range leading {
+					codes = append(codes, tbGenCode(p))
+				}
+				if reverse {
+					tbGenReverse(codes)
+				}
+				for _, p := range others {
+					codes = append(codes, tbGenCode(p))
+				}
+			}
+			l.pieces[side][f] = codes
+			l.setFactors(side, f, reverse)
+		}
+	}
+	return l
+}
+
+func tbGenSort(squares []int) { // insertion sort, for a few squares.
+	for i := 1; i < len(squares); i++ {
+		for j := i; j > 0 && squares[j] < squares[j-1]; j-- {
+			squares[j], squares[j-1] = squares[j-1], squares[j]
+		}
+	}
+}
+
+func tbGenReverse(codes []uint8) {
+	for i, j := 0, len(codes)-1; i < j; i, j = i+1, j-1 {
+		codes[i], codes[j] = codes[j], codes[i]
+	}
+}
+
+// setFactors follows set_norm_piece/set_norm_pawn and calc_factors_piece/calc_factors_pawn.
+func (l *tbGenLayout) setFactors(side, f int, reverse bool) {
+	pieces := l.pieces[side][f]
+	n := len(pieces)
+	norm := make([]int, n)
+	if l.pawns[0] > 0 {
+		norm[0] = l.pawns[0]
+		if l.pawns[1] > 0 {
+			norm[l.pawns[0]] = l.pawns[1]
+		}
+	} else if l.encType == 0 {
+		norm[0] = 3
+	} else {
+		norm[0] = 2
+	}
+	for i := norm[0] + l.pawns[1]; i < n; i += norm[i] {
+		for j := i; j < n && pieces[j] == pieces[i]; j++ {
+			norm[i]++
+		}
+	}
+	order, order2 := 0, 0xF
+	if l.pawns[1] > 0 {
+		order2 = 1
+	}
+	if reverse && n > norm[0]+l.pawns[1] && l.pawns[1] == 0 {
+		order = 1 // the leading group is encoded after the next group.
+	}
+	factor := make([]uint64, n)
+	i := norm[0]
+	if order2 < 0xF {
+		i += norm[i]
+	}
+	free := 64 - i
+	size := uint64(1)
+	for k := 0; i < n || k == order || k == order2; k++ {
+		if k == order {
+			factor[0] = size
+			if l.pawns[0] > 0 {
+				size *= tbGenPawnFactor[norm[0]-1][f]
+			} else if l.encType == 0 {
+				size *= 31332
+			} else {
+				size *= 462
+			}
+		} else if k == order2 {
+			factor[norm[0]] = size
+			size *= tbGenChoose(48-norm[0], norm[norm[0]])
+		} else {
+			factor[i] = size
+			size *= tbGenChoose(free, norm[i])
+			free -= norm[i]
+			i += norm[i]
+		}
+	}
+	l.norm[side][f], l.factor[side][f], l.size[side][f] = norm, factor, size
+	l.order[side][f] = [2]int{order, order2}
+}
+
+// index returns the file of the leading pawn and the index of a position stored for the given
+// side to move. Squares are rearranged into pos in the order of the table header.
+func (l *tbGenLayout) index(pieces []tbGenPiece, squares []int, side int, pos []int) (int, uint64) {
+	var used [TB_PIECES]bool
+	k, f := 0, 0
+	if l.pawns[0] > 0 {
+		lead := l.pieces[side][0][0]
+		for j, p := range pieces {
+			if tbGenCode(p) == lead {
+				pos[k], used[j] = squares[j], true
+				k++
+			}
+		}
+		tbGenSort(pos[:k])                // in order of square, as found on a bitboard.
+		for i := 1; i < l.pawns[0]; i++ { // pawn_file
+			if tbGenFlap[pos[0]] > tbGenFlap[pos[i]] {
+				pos[0], pos[i] = pos[i], pos[0]
+			}
+		}
+		f = tbGenFileToFile[pos[0]&7]
+	}
+	for codes := l.pieces[side][f]; k < len(pieces); k++ {
+		for j, p := range pieces {
+			if !used[j] && tbGenCode(p) == codes[k] {
+				pos[k], used[j] = squares[j], true
+				break
+			}
+		}
+	}
+	if l.pawns[0] > 0 {
+		return f, l.encodePawn(pos, side, f)
+	}
+	return 0, l.encodePiece(pos, side)
+}
+
+// encodePiece follows encode_piece.
+func (l *tbGenLayout) encodePiece(pos []int, side int) uint64 {
+	n := len(pos)
+	if pos[0]&0x04 > 0 {
+		for i := range pos {
+			pos[i] ^= 0x07
+		}
+	}
+	if pos[0]&0x20 > 0 {
+		for i := range pos {
+			pos[i] ^= 0x38
+		}
+	}
+	i := 0
+	for i < n && tbGenOffDiag[pos[i]] == 0 {
+		i++
+	}
+	if i < 3-l.encType/2 && tbGenOffDiag[pos[i]] > 0 {
+		for j := range pos {
+			pos[j] = (pos[j] >> 3) | (pos[j]&7)<<3
+		}
+	}
+	var idx int
+	if l.encType == 0 {
+		a := boolToInt(pos[1] > pos[0])
+		b := boolToInt(pos[2] > pos[0]) + boolToInt(pos[2] > pos[1])
+		if tbGenOffDiag[pos[0]] != 0 {
+			idx = tbGenTriangle[pos[0]]*63*62 + (pos[1]-a)*62 + pos[2] - b
+		} else if tbGenOffDiag[pos[1]] != 0 {
+			idx = 6*63*62 + tbGenDiag[pos[0]]*28*62 + tbGenLower[pos[1]]*62 + pos[2] - b
+		} else if tbGenOffDiag[pos[2]] != 0 {
+			idx = 6*63*62 + 4*28*62 + tbGenDiag[pos[0]]*7*28 + (tbGenDiag[pos[1]]-a)*28 + tbGenLower[pos[2]]
+		} else {
+			idx = 6*63*62 + 4*28*62 + 4*7*28 + tbGenDiag[pos[0]]*7*6 + (tbGenDiag[pos[1]]-a)*6 +
+				tbGenDiag[pos[2]] - b
+		}
+	} else {
+		idx = tbGenKKIdx[tbGenTriangle[pos[0]]][pos[1]]
+	}
+	norm, factor := l.norm[side][0], l.factor[side][0]
+	return l.encodeGroups(pos, norm, factor, norm[0], false, uint64(idx)*factor[0])
+}
+
+// encodePawn follows encode_pawn.
+func (l *tbGenLayout) encodePawn(pos []int, side, f int) uint64 {
+	if pos[0]&0x04 > 0 {
+		for i := range pos {
+			pos[i] ^= 0x07
+		}
+	}
+	lead := l.pawns[0]
+	for i := 1; i < lead; i++ {
+		for j := i + 1; j < lead; j++ {
+			if tbGenPawnTwist[pos[i]] < tbGenPawnTwist[pos[j]] {
+				pos[i], pos[j] = pos[j], pos[i]
+			}
+		}
+	}
+	t := lead - 1
+	idx := tbGenPawnIdx[t][tbGenFlap[pos[0]]]
+	for i := t; i > 0; i-- {
+		idx += tbGenChoose(tbGenPawnTwist[pos[i]], t-i+1)
+	}
+	norm, factor := l.norm[side][f], l.factor[side][f]
+	return l.encodeGroups(pos, norm, factor, lead, l.pawns[1] > 0, idx*factor[0])
+}
+
+// encodeGroups adds the index of each group from pos[start]. Squares taken by earlier groups are
+// skipped, and pawns of the other color (if pawnGroup) can't be on the first or last row.
+func (l *tbGenLayout) encodeGroups(pos, norm []int, factor []uint64, start int, pawnGroup bool,
+	idx uint64) uint64 {
+	for i := start; i < len(pos); i += norm[i] {
+		group := pos[i : i+norm[i]]
+		tbGenSort(group)
+		var s uint64
+		for m, p := range group {
+			j := 0
+			for _, prev := range pos[:i] {
+				if p > prev {
+					j++
+				}
+			}
+			if pawnGroup {
+				j += 8
+			}
+			s += tbGenChoose(p-j, m+1)
+		}
+		pawnGroup = false
+		idx += s * factor[i]
+	}
+	return idx
+}
+
+// encodeTable returns the contents of the WDL or DTZ table file for a solved ending.
+func encodeTable(sol *tbSolution, dtz bool) ([]byte, error) {
+	l := newTbGenLayout(sol.pieces)
+	format := tbGenFormats[sol.name]
+	n := len(sol.pieces)
+	sides, files := 2, 1
+	if dtz || l.symmetric {
+		sides = 1
+	}
+	if l.pawns[0] > 0 {
+		files = 4
+	}
+	var values, results [2][4][]int
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			values[i][f] = make([]int, l.size[i][f])
+			results[i][f] = make([]int, l.size[i][f])
+			for j := range values[i][f] {
+				values[i][f][j] = -1
+			}
+		}
+	}
+	var squares [TB_PIECES]int
+	pos := make([]int, n)
+	for idx, legal := range sol.legal {
+		if !legal {
+			continue
+		}
+		c := tbGenDecode(idx, squares[:n])
+		side := boolToInt(c == BLACK)
+		value := int(sol.wdl[idx]) + 2
+		if dtz {
+			if sol.wdl[idx] == WDL_DRAW || sol.zeroing[idx] {
+				continue // not probed.
+			}
+			side, value = 0, abs(int(sol.dtz[idx]))-1
+		} else if l.symmetric && c == BLACK {
+			continue // the colors are reversed when probing.
+		}
+		f, i := l.index(sol.pieces, squares[:n], side, pos)
+		if dtz && format.blackToMove[f] != (c == BLACK) {
+			continue
+		}
+		if old := values[side][f][i]; old >= 0 && old != value {
+			return nil, errors.New(fmt.Sprintf("%s: positions with index %d have different values",
+				sol.name, i))
+		}
+		values[side][f][i], results[side][f][i] = value, int(sol.wdl[idx])
+	}
+
+	// DTZ maps list the values stored for wins, then losses. Cursed wins and blessed losses
+	// aren't used.
+	var maps [4][4][]int
+	if dtz && format.mapped {
+		for f := 0; f < files; f++ {
+			for class, wdl := range []int{WDL_WIN, WDL_LOSS} {
+				found := make(map[int]bool)
+				for j, v := range values[0][f] {
+					if v >= 0 && results[0][f][j] == wdl && !found[v] {
+						found[v] = true
+						maps[f][class] = append(maps[f][class], v)
+					}
+				}
+				sort.Ints(maps[f][class])
+				for j, v := range values[0][f] {
+					if v >= 0 && results[0][f][j] == wdl {
+						values[0][f][j] = sort.SearchInts(maps[f][class], v)
+					}
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if dtz {
+		buf.Write(dtzMagic[:])
+	} else {
+		buf.Write(wdlMagic[:])
+	}
+	buf.WriteByte(byte(boolToInt(sides == 2) | boolToInt(files == 4)<<1))
+	for f := 0; f < files; f++ {
+		black := sides - 1 // the high nibble is used for black to move.
+		buf.WriteByte(byte(l.order[0][f][0] | l.order[black][f][0]<<4))
+		if l.pawns[1] > 0 {
+			buf.WriteByte(byte(l.order[0][f][1] | l.order[black][f][1]<<4))
+		}
+		for k := 0; k < n; k++ {
+			buf.WriteByte(l.pieces[0][f][k] | l.pieces[black][f][k]<<4)
+		}
+	}
+	if buf.Len()&1 > 0 {
+		buf.WriteByte(0)
+	}
+	var pairs [2][4]*tbPairs
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			pairs[i][f] = encodePairs(values[i][f])
+			if pairs[i][f].maxSymLen > TB_GEN_MAX_SYM {
+				return nil, errors.New(fmt.Sprintf("%s: Huffman codes are too long", sol.name))
+			}
+			flags := uint8(0)
+			if dtz {
+				flags = TB_WIN_PLIES | TB_LOSS_PLIES // values are stored in plies.
+				if format.blackToMove[f] {
+					flags |= TB_STM
+				}
+				if format.mapped {
+					flags |= TB_MAPPED
+				}
+			}
+			buf.Write(pairs[i][f].sizes(flags))
+		}
+	}
+	if dtz {
+		for f := 0; f < files && format.mapped; f++ {
+			for _, m := range maps[f] {
+				buf.WriteByte(byte(len(m)))
+				for _, v := range m {
+					buf.WriteByte(byte(v))
+				}
+			}
+		}
+		if buf.Len()&1 > 0 {
+			buf.WriteByte(0)
+		}
+	}
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			buf.Write(pairs[i][f].sparseIndex)
+		}
+	}
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			for _, n := range pairs[i][f].blockLengths {
+				binary.Write(&buf, binary.LittleEndian, uint16(n-1))
+			}
+		}
+	}
+	for f := 0; f < files; f++ {
+		for i := 0; i < sides; i++ {
+			for buf.Len()&0x3F > 0 {
+				buf.WriteByte(0)
+			}
+			buf.Write(pairs[i][f].blocks)
+		}
+	}
+	for buf.Len()%64 != 16 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes(), nil
+}
+
+const (
+	TB_GEN_BLOCK_BITS  = 6  // blocks of 64 bytes.
+	TB_GEN_SPAN_BITS   = 10 // a sparse index entry for every 1024 values.
+	TB_GEN_MAX_PAIRS   = 256
+	TB_GEN_MIN_FREQ    = 8     // pairs occurring less often aren't replaced.
+	TB_GEN_BLOCK_LIMIT = 60000 // values per block, leaving room for sparse index offsets.
+)
+
+// tbSymbol is a table value, or a pair of symbols.
+type tbSymbol struct {
+	value, left, right int // left and right are -1 for values.
+	length             int // number of values represented.
+	freq, codeLen, id  int
+}
+
+type tbPairs struct {
+	single                bool
+	value                 int
+	symbols               []*tbSymbol
+	minSymLen, maxSymLen  int
+	lowestSym, baseCodes  []int // indexed by code length - minSymLen.
+	blockLengths          []int
+	sparseIndex, blocks   []byte
+	numSymbols, numBlocks int
+}
+
+// encodePairs compresses values. Values of -1 are unused, and take the value of their neighbor.
+func encodePairs(values []int) *tbPairs {
+	prev := -1
+	for _, v := range values {
+		if v >= 0 {
+			prev = v
+			break
+		}
+	}
+	if prev < 0 {
+		prev = 0 // nothing is stored.
+	}
+	single := true
+	for i, v := range values {
+		if v < 0 {
+			values[i] = prev
+		} else if v != prev {
+			single = false
+		}
+		prev = values[i]
+	}
+	p := &tbPairs{}
+	if single {
+		p.single, p.value = true, values[0]
+		return p
+	}
+
+	// Recursive pairing: repeatedly replace the most frequent pair of adjacent symbols.
+	leaves := make(map[int]int)
+	seq := make([]int, len(values))
+	for i, v := range values {
+		if _, ok := leaves[v]; !ok {
+			leaves[v] = len(p.symbols)
+			p.symbols = append(p.symbols, &tbSymbol{value: v, left: -1, right: -1, length: 1})
+		}
+		seq[i] = leaves[v]
+	}
+	maxSymbols := len(p.symbols) + TB_GEN_MAX_PAIRS
+	counts := make([]int, maxSymbols*maxSymbols)
+	for n := 0; n < TB_GEN_MAX_PAIRS; n++ {
+		for i := range counts {
+			counts[i] = 0
+		}
+		for i := 0; i+1 < len(seq); i++ {
+			if p.symbols[seq[i]].length+p.symbols[seq[i+1]].length <= 256 { // symlen is stored in a byte.
+				counts[seq[i]*maxSymbols+seq[i+1]]++
+			}
+		}
+		bestPair, best := 0, 0
+		for pair, count := range counts {
+			if count > best {
+				bestPair, best = pair, count
+			}
+		}
+		if best < TB_GEN_MIN_FREQ {
+			break
+		}
+		left, right := bestPair/maxSymbols, bestPair%maxSymbols
+		sym := len(p.symbols)
+		p.symbols = append(p.symbols, &tbSymbol{left: left, right: right,
+			length: p.symbols[left].length + p.symbols[right].length})
+		next := seq[:0]
+		for i := 0; i < len(seq); i++ {
+			if i+1 < len(seq) && seq[i] == left && seq[i+1] == right {
+				next = append(next, sym)
+				i++
+			} else {
+				next = append(next, seq[i])
+			}
+		}
+		seq = next
+	}
+	for _, sym := range seq {
+		p.symbols[sym].freq++
+	}
+	p.assignCodes()
+
+	// Pack the symbols into blocks, and index the middle of each span.
+	blockBits := 8 << TB_GEN_BLOCK_BITS
+	var block []*tbSymbol
+	var blockStarts []int
+	pos := 0
+	flush := func() {
+		var bits bitWriter
+		for _, sym := range block {
+			bits.write(sym.code(p), sym.codeLen)
+		}
+		data := bits.bytes()
+		p.blocks = append(p.blocks, data...)
+		p.blocks = append(p.blocks, make([]byte, blockBits/8-len(data))...)
+		block = nil
+	}
+	bits, count := 0, 0
+	for _, id := range seq {
+		sym := p.symbols[id]
+		if len(block) > 0 && (bits+sym.codeLen > blockBits || count+sym.length > TB_GEN_BLOCK_LIMIT) {
+			p.blockLengths = append(p.blockLengths, count)
+			flush()
+			bits, count = 0, 0
+		}
+		if len(block) == 0 {
+			blockStarts = append(blockStarts, pos)
+		}
+		block = append(block, sym)
+		bits += sym.codeLen
+		count += sym.length
+		pos += sym.length
+	}
+	p.blockLengths = append(p.blockLengths, count)
+	flush()
+	p.numBlocks = len(p.blockLengths)
+
+	span := 1 << TB_GEN_SPAN_BITS
+	block1 := 0
+	for k := 0; k*span < len(values); k++ {
+		target := k*span + span/2
+		for block1+1 < len(blockStarts) && blockStarts[block1+1] <= target {
+			block1++
+		}
+		entry := make([]byte, 6)
+		binary.LittleEndian.PutUint32(entry, uint32(block1))
+		binary.LittleEndian.PutUint16(entry[4:], uint16(target-blockStarts[block1]))
+		p.sparseIndex = append(p.sparseIndex, entry...)
+	}
+	return p
+}
+
+// assignCodes builds a Huffman code for the symbols in use, and numbers the symbols so that
+// longer codes come first, as expected by the canonical decoder.
+func (p *tbPairs) assignCodes() {
+	var nodes []*tbHuffNode
+	for _, sym := range p.symbols {
+		if sym.freq > 0 {
+			nodes = append(nodes, &tbHuffNode{freq: sym.freq, syms: []*tbSymbol{sym}})
+		}
+	}
+	for len(nodes) > 1 {
+		a, b := popSmallest(&nodes), popSmallest(&nodes)
+		merged := append(append([]*tbSymbol(nil), a.syms...), b.syms...)
+		for _, sym := range merged {
+			sym.codeLen++
+		}
+		nodes = append(nodes, &tbHuffNode{freq: a.freq + b.freq, syms: merged})
+	}
+	if len(nodes[0].syms) == 1 {
+		nodes[0].syms[0].codeLen = 1 // a single symbol still needs a code.
+	}
+	p.minSymLen, p.maxSymLen = TB_GEN_INF, 0
+	for _, sym := range p.symbols {
+		if sym.freq > 0 {
+			p.minSymLen, p.maxSymLen = min(p.minSymLen, sym.codeLen), max(p.maxSymLen, sym.codeLen)
+		}
+	}
+	id := 0
+	for l := p.maxSymLen; l >= p.minSymLen; l-- {
+		for _, sym := range p.symbols {
+			if sym.freq > 0 && sym.codeLen == l {
+				sym.id = id
+				id++
+			}
+		}
+	}
+	for _, sym := range p.symbols {
+		if sym.freq == 0 {
+			sym.id = id
+			id++
+		}
+	}
+	p.numSymbols = id
+	// lowestSym[l] is the first symbol with a code of length l + minSymLen.
+	p.lowestSym = make([]int, p.maxSymLen-p.minSymLen+1)
+	p.baseCodes = make([]int, len(p.lowestSym))
+	for l := len(p.lowestSym) - 2; l >= 0; l-- {
+		count := 0
+		for _, sym := range p.symbols {
+			if sym.freq > 0 && sym.codeLen == l+1+p.minSymLen {
+				count++
+			}
+		}
+		p.lowestSym[l] = p.lowestSym[l+1] + count
+		p.baseCodes[l] = (p.baseCodes[l+1] + count) / 2
+	}
+}
+
+type tbHuffNode struct {
+	freq int
+	syms []*tbSymbol
+}
+
+func popSmallest(nodes *[]*tbHuffNode) *tbHuffNode {
+	best := 0
+	for i, node := range *nodes {
+		if node.freq < (*nodes)[best].freq {
+			best = i
+		}
+	}
+	node := (*nodes)[best]
+	*nodes = append((*nodes)[:best], (*nodes)[best+1:]...)
+	return node
+}
+
+func (sym *tbSymbol) code(p *tbPairs) int {
+	l := sym.codeLen - p.minSymLen
+	return p.baseCodes[l] + sym.id - p.lowestSym[l]
+}
+
+// sizes returns the table description read by setSizes.
+func (p *tbPairs) sizes(flags uint8) []byte {
+	if p.single {
+		return []byte{flags | TB_SINGLE_VALUE, byte(p.value)}
+	}
+	var buf bytes.Buffer
+	buf.Write([]byte{flags, TB_GEN_BLOCK_BITS, TB_GEN_SPAN_BITS, 0})
+	binary.Write(&buf, binary.LittleEndian, uint32(p.numBlocks))
+	buf.Write([]byte{byte(p.maxSymLen), byte(p.minSymLen)})
+	for _, id := range p.lowestSym {
+		binary.Write(&buf, binary.LittleEndian, uint16(id))
+	}
+	binary.Write(&buf, binary.LittleEndian, uint16(p.numSymbols))
+	btree := make([]byte, 3*p.numSymbols)
+	for _, sym := range p.symbols {
+		left, right := sym.value, 0xFFF
+		if sym.left >= 0 {
+			left, right = p.symbols[sym.left].id, p.symbols[sym.right].id
+		}
+		lr := btree[3*sym.id:]
+		lr[0], lr[1], lr[2] = byte(left), byte(left>>8&0xF|right<<4&0xF0), byte(right>>4)
+	}
+	buf.Write(btree)
+	if p.numSymbols&1 > 0 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// bitWriter packs codes most significant bit first.
+type bitWriter struct {
+	data []byte
+	n    uint
+}
+
+func (w *bitWriter) write(code, length int) {
+	for i := length - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if code>>uint(i)&1 > 0 {
+			w.data[w.n/8] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) bytes() []byte { return w.data }
+
+// TestSyzygyFixtures checks that the tables in SYZYGY_TEST_PATH match the generator, or rewrites
+// them when run with -gensyzygy.
+func TestSyzygyFixtures(t *testing.T) {
+	solved := solvedFixtures()
+	for _, name := range syzygyFixtures {
+		sol, ok := solved[name]
+		if !ok {
+			continue // not solved unless regenerating the tables.
+		}
+		for ext, dtz := range map[string]bool{".rtbw": false, ".rtbz": true} {
+			data, err := encodeTable(sol, dtz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(SYZYGY_TEST_PATH, name+ext)
+			if *genSyzygyFlag {
+				if err = ioutil.WriteFile(path, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			} else if existing, err := ioutil.ReadFile(path); err != nil {
+				t.Fatalf("%s is missing. Run go test -run TestSyzygyFixtures -args -gensyzygy", path)
+			} else if !bytes.Equal(existing, data) {
+				t.Errorf("%s doesn't match the generated table", path)
+			}
+		}
+	}
+}
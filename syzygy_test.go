@@ -0,0 +1,315 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Directory containing the 3- and 4-piece tables used by the probing tests, written by the
+// generator in syzygy_gen_test.go.
+const SYZYGY_TEST_PATH = "test_suites/syzygy"
+
+var syzygyPathFlag = flag.String("syzygypath", SYZYGY_TEST_PATH,
+	"Runs the probing tests against the tables in this directory, e.g. the official Syzygy tables.")
+
+func TestTablebaseIndices(t *testing.T) {
+	kkCodes := make(map[int]bool)
+	for idx := 0; idx < 10; idx++ {
+		for sq1 := 0; sq1 <= D4; sq1++ {
+			if tbMapA1D1D4[sq1] != idx || (idx == 0 && sq1 != B1) {
+				continue
+			}
+			for sq2 := 0; sq2 < 64; sq2++ {
+				if (kingMasks[sq1]|sqMaskOn[sq1])&sqMaskOn[sq2] == 0 &&
+					!(offA1H8(sq1) == 0 && offA1H8(sq2) > 0) {
+					kkCodes[tbMapKK[idx][sq2]] = true
+				}
+			}
+		}
+	}
+	if len(kkCodes) != 462 {
+		t.Errorf("Expected 462 king placements, got %d", len(kkCodes))
+	}
+	pawnCodes := make(map[int]bool)
+	for sq := A2; sq <= H7; sq++ {
+		pawnCodes[tbMapPawns[sq]] = true
+	}
+	if len(pawnCodes) != 48 || pawnCodes[48] || !pawnCodes[0] {
+		t.Errorf("Expected pawn squares to be mapped to 0..47")
+	}
+	if tbBinomial[2][5] != 10 || tbBinomial[3][62] != 37820 {
+		t.Errorf("Binomial coefficients calculated incorrectly")
+	}
+}
+
+// Builds a WDL table storing a single value for all positions, as used for drawn endings
+// such as KBvK.
+func TestSingleValueTable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syzygy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := make([]byte, 80)
+	copy(data, wdlMagic[:])
+	data[4] = 1 // white and black to move are stored separately. No pawns.
+	data[5] = 0 // group order
+	// pieces K, B, k. The low nibble is used for white to move, and the high nibble for black.
+	data[6], data[7], data[8] = 6|6<<4, 3|3<<4, 14|14<<4
+	data[10], data[11] = TB_SINGLE_VALUE, 2 // white to move: draw
+	data[12], data[13] = TB_SINGLE_VALUE, 2 // black to move: draw
+	if err = ioutil.WriteFile(filepath.Join(dir, "KBvK.rtbw"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func(tb *Tablebases) { tablebases = tb }(tablebases)
+	setTablebasePath(dir)
+	for _, fen := range []string{"8/8/8/4k3/8/8/8/KB6 w - - 0 1", "8/8/8/4k3/8/8/8/KB6 b - - 0 1",
+		"kb6/8/8/4K3/8/8/8/8 w - - 0 1"} {
+		brd := ParseFENString(fen)
+		if !tbAvailable(brd) {
+			t.Fatalf("Expected tablebase to be available for %s", fen)
+		}
+		if wdl, ok := probeWDL(brd); !ok || wdl != WDL_DRAW {
+			t.Errorf("Expected draw for %s, got %d (ok: %t)", fen, wdl, ok)
+		}
+	}
+}
+
+func loadTestTablebases(t *testing.T) {
+	if _, err := os.Stat(filepath.Join(*syzygyPathFlag, "KRvKP.rtbz")); err != nil {
+		t.Fatalf("Tablebase files not found in %s", *syzygyPathFlag)
+	}
+	setTablebasePath(*syzygyPathFlag)
+}
+
+// dtzSlack allows for the official tables, which store some DTZ values in moves rather than
+// plies, rounding odd distances up.
+func dtzSlack() int {
+	if *syzygyPathFlag == SYZYGY_TEST_PATH {
+		return 0
+	}
+	return 1
+}
+
+func TestProbeWDL(t *testing.T) {
+	defer func(tb *Tablebases) { tablebases = tb }(tablebases)
+	loadTestTablebases(t)
+	tests := []struct {
+		fen string
+		wdl int
+	}{
+		{"8/8/8/8/8/2k5/8/KQ6 w - - 0 1", WDL_WIN},
+		{"8/8/8/8/8/2k5/8/KQ6 b - - 0 1", WDL_LOSS},
+		{"4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", WDL_WIN},
+		{"8/8/4k3/8/4K3/4P3/8/8 w - - 0 1", WDL_DRAW}, // black keeps the opposition.
+		{"8/8/4k3/8/4K3/4P3/8/8 b - - 0 1", WDL_LOSS},
+		{"8/8/8/8/8/8/3P4/4k2K b - - 0 1", WDL_DRAW}, // black captures the pawn.
+		{"8/8/8/4k3/8/8/8/KN6 w - - 0 1", WDL_DRAW},
+		{"8/8/8/8/8/8/1kR5/7K b - - 0 1", WDL_DRAW}, // black can capture the rook.
+	}
+	for _, test := range tests {
+		brd := ParseFENString(test.fen)
+		if wdl, ok := probeWDL(brd); !ok || wdl != test.wdl {
+			t.Errorf("Expected WDL %d for %s, got %d (ok: %t)", test.wdl, test.fen, wdl, ok)
+		}
+	}
+}
+
+func TestProbeDTZ(t *testing.T) {
+	defer func(tb *Tablebases) { tablebases = tb }(tablebases)
+	loadTestTablebases(t)
+	brd := ParseFENString("7k/8/6K1/8/8/8/8/1Q6 w - - 0 1")
+	state := PROBE_OK
+	if dtz := probeDTZ(brd, &state); state == PROBE_FAIL || dtz != 1 {
+		t.Errorf("Expected DTZ 1, got %d", dtz)
+	}
+	moves := brd.LegalMoves()
+	ranks, dtzs, ok := rankRootMoves(brd, moves)
+	if !ok {
+		t.Fatal("Root probe failed")
+	}
+	best := bestRootRank(ranks, dtzs)
+	makeMove(brd, moves[best])
+	if !brd.InCheck() || len(brd.LegalMoves()) > 0 {
+		t.Errorf("Expected a mating move, got %s", moves[best].ToUCI())
+	}
+}
+
+// Promoting to a queen stalemates, so only the rook promotion wins.
+func TestTablebaseUnderpromotion(t *testing.T) {
+	defer func(tb *Tablebases) { tablebases = tb }(tablebases)
+	loadTestTablebases(t)
+	brd := ParseFENString("8/k1P5/8/K7/8/8/8/8 w - - 0 1")
+	s := NewSearch(SearchParams{maxDepth: 1}, NewGameTimer(0, brd.c), nil, nil, nil)
+	if !s.probeRoot(brd) || s.bestMove.ToUCI() != "c7c8r" {
+		t.Errorf("Expected the root probe to play c7c8r, got %s", s.bestMove.ToUCI())
+	}
+}
+
+// Compares the probe results for each position of the test tables with the generator's solution.
+// Positions are also probed with the colors reversed. DTZ is checked for a sample of positions.
+// Endings of 4 pieces are only solved when regenerating the tables, and are also sampled.
+func TestProbeAllPositions(t *testing.T) {
+	defer func(tb *Tablebases) { tablebases = tb }(tablebases)
+	loadTestTablebases(t)
+	for _, name := range syzygyFixtures {
+		sol, ok := solvedFixtures()[name]
+		if !ok {
+			continue
+		}
+		step := 1
+		if len(sol.pieces) > 3 {
+			step = 31
+		}
+		flipped := tbGenFlipColors(sol.pieces)
+		errors := 0
+		for idx := 0; idx < len(sol.legal) && errors <= 10; idx += step {
+			if !sol.legal[idx] {
+				continue
+			}
+			squares, c := tbGenSquares(idx, len(sol.pieces))
+			flippedSquares := make([]int, len(squares))
+			for i, sq := range squares {
+				flippedSquares[i] = sq ^ 56
+			}
+			for _, brd := range []*Board{tbGenBoard(sol.pieces, squares, c),
+				tbGenBoard(flipped, flippedSquares, c^1)} {
+				if wdl, ok := probeWDL(brd); !ok || wdl != int(sol.wdl[idx]) {
+					t.Errorf("Expected WDL %d for %s, got %d (ok: %t)", sol.wdl[idx], brd.FEN(), wdl, ok)
+					errors++
+				}
+			}
+			if idx%13 > 0 {
+				continue
+			}
+			expected := int(sol.dtz[idx])
+			if sol.wdl[idx] == WDL_DRAW {
+				expected = 0
+			}
+			state := PROBE_OK
+			brd := tbGenBoard(sol.pieces, squares, c)
+			if dtz := probeDTZ(brd, &state); state == PROBE_FAIL || abs(dtz-expected) > dtzSlack() {
+				t.Errorf("Expected DTZ %d for %s, got %d", expected, brd.FEN(), dtz)
+				errors++
+			}
+		}
+	}
+}
+
+// Values known from the rules of the game: immediate captures and mates, a skewer, and endings
+// that can't be won.
+func TestTablebaseKnownValues(t *testing.T) {
+	defer func(tb *Tablebases) { tablebases = tb }(tablebases)
+	loadTestTablebases(t)
+	tests := []struct {
+		fen      string
+		wdl, dtz int
+	}{
+		{"k7/3r4/8/8/3Q4/8/8/4K3 w - - 0 1", WDL_WIN, 1}, // Qxd7
+		{"k7/3r4/8/8/3Q4/8/8/4K3 b - - 0 1", WDL_WIN, 1}, // Rxd4
+		{"k7/8/8/8/3K3Q/8/8/r7 b - - 0 1", WDL_WIN, 3},   // Ra4+ and Rxh4
+		{"k7/8/8/8/8/8/8/K1R3r1 w - - 0 1", WDL_WIN, 1},  // Rxg1
+		{"k7/8/8/8/8/8/8/K1R3r1 b - - 0 1", WDL_WIN, 1},  // Rxc1
+		{"7k/8/8/8/1R6/1p6/8/7K w - - 0 1", WDL_WIN, 1},  // Rxb3
+		{"7K/8/8/8/8/8/pk6/7R b - - 0 1", WDL_DRAW, 0},   // a1=Q Rxa1 Kxa1
+		{"7k/5K2/5N2/4N3/8/8/8/8 w - - 0 1", WDL_WIN, 1}, // Ng6#
+		{"8/8/8/3k4/8/8/8/KNN5 w - - 0 1", WDL_DRAW, 0},  // two knights can't force mate.
+		{"7k/R7/5K2/8/8/8/8/1R6 w - - 0 1", WDL_WIN, 1},  // Rb8#, with both kings on the diagonal.
+	}
+	for _, test := range tests {
+		brd := ParseFENString(test.fen)
+		state := PROBE_OK
+		if wdl, ok := probeWDL(brd); !ok || wdl != test.wdl {
+			t.Errorf("Expected WDL %d for %s, got %d (ok: %t)", test.wdl, test.fen, wdl, ok)
+		} else if dtz := probeDTZ(brd, &state); state == PROBE_FAIL || dtz != test.dtz {
+			t.Errorf("Expected DTZ %d for %s, got %d", test.dtz, test.fen, dtz)
+		}
+	}
+	brd := ParseFENString("k7/8/8/8/3K3Q/8/8/r7 b - - 0 1")
+	moves := brd.LegalMoves()
+	ranks, dtzs, ok := rankRootMoves(brd, moves)
+	if !ok {
+		t.Fatal("Root probe failed")
+	}
+	if best := moves[bestRootRank(ranks, dtzs)]; best.ToUCI() != "a1a4" {
+		t.Errorf("Expected the skewer a1a4, got %s", best.ToUCI())
+	}
+}
+
+// Checks random positions of the 4-piece tables against the values of the positions reached by
+// each legal move. Unlike TestProbeAllPositions, this doesn't depend on the generator.
+func TestTablebaseConsistency(t *testing.T) {
+	defer func(tb *Tablebases) { tablebases = tb }(tablebases)
+	loadTestTablebases(t)
+	r := rand.New(rand.NewSource(1))
+	for _, name := range syzygyFixtures {
+		pieces := tbGenPieces(name)
+		if len(pieces) < 4 {
+			continue
+		}
+		for checked := 0; checked < 300; {
+			squares := make([]int, len(pieces))
+			for i := range squares {
+				squares[i] = r.Intn(64)
+			}
+			c := uint8(r.Intn(2))
+			if !tbGenLegal(pieces, squares, c) {
+				continue
+			}
+			checked++
+			brd := tbGenBoard(pieces, squares, c)
+			wdl, dtz, expectedWDL, expectedDTZ := checkTablebaseMoves(brd)
+			if wdl != expectedWDL || sign(dtz) != sign(expectedDTZ) || abs(dtz-expectedDTZ) > 2*dtzSlack() {
+				t.Errorf("%s: expected WDL %d and DTZ %d from the moves available, got %d and %d", brd.FEN(),
+					expectedWDL, expectedDTZ, wdl, dtz)
+			}
+		}
+	}
+}
+
+// checkTablebaseMoves probes a position, and works out its value from the positions reached by
+// each legal move. Winning positions take the shortest path to a zeroing move or mate, and losing
+// positions the longest.
+func checkTablebaseMoves(brd *Board) (wdl, dtz, expectedWDL, expectedDTZ int) {
+	state := PROBE_OK
+	wdl, _ = probeWDL(brd)
+	dtz = probeDTZ(brd, &state)
+	moves := perftMoves(brd)
+	if len(moves) == 0 && !brd.InCheck() {
+		return wdl, dtz, WDL_DRAW, 0
+	}
+	expectedWDL, win, loss := WDL_LOSS, 1<<10, 1
+	memento := brd.NewMemento()
+	for _, m := range moves {
+		zeroing := m.IsCapture() || m.Piece() == PAWN
+		makeMove(brd, m)
+		childWDL, _ := probeWDL(brd)
+		childDTZ := probeDTZ(brd, &state)
+		mate := brd.InCheck() && len(perftMoves(brd)) == 0
+		unmakeMove(brd, m, memento)
+		expectedWDL = max(expectedWDL, -childWDL)
+		if childWDL == WDL_LOSS && (zeroing || mate) {
+			win = 1
+		} else if childWDL == WDL_LOSS {
+			win = min(win, 1-childDTZ)
+		} else if childWDL == WDL_WIN && !zeroing {
+			loss = max(loss, 1+childDTZ)
+		}
+	}
+	switch expectedWDL {
+	case WDL_WIN:
+		expectedDTZ = win
+	case WDL_LOSS:
+		expectedDTZ = -loss
+	}
+	return wdl, dtz, expectedWDL, expectedDTZ
+}
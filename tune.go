@@ -0,0 +1,254 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// Texel Tuning
+
+// The evaluation parameters are tuned by minimizing the mean squared error between the result of
+// the game each position was taken from and the result predicted by the static evaluation, mapped
+// to an expected score by a sigmoid function. The error is minimized by a local search that tries
+// changing each parameter by one in turn: https://chessprogramming.wikispaces.com/Texel's+Tuning+Method
+
+// Training positions are read from an EPD file, with the game result given by the c9 opcode
+// (e.g. c9 "1-0"), or from the main line of each game in a PGN file. Positions from PGN files are
+// only used if they are quiet, since the static evaluation can't account for pending captures.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+const (
+	DEFAULT_TUNE_OUTPUT = "tuned_eval.json"
+	TUNE_MIN_PLY        = 8 // positions from the first few moves of each PGN game are skipped.
+)
+
+type TuningPosition struct {
+	brd    *Board
+	result float64 // 1 for a white win, 0.5 for a draw, and 0 for a black win.
+}
+
+// RunTuner tunes the evaluation using the positions in path, and writes an eval file to outPath
+// after each pass. Tuning stops once a pass fails to reduce the error.
+func RunTuner(path, outPath string) {
+	positions, err := loadTuningPositions(path)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	t := NewTuner(positions, runtime.NumCPU())
+	k := t.FitK()
+	best := t.Error(k)
+	fmt.Printf("%d positions loaded. K: %.4f, error: %.6f\n", len(positions), k, best)
+
+	params := evalParams()
+	for pass := 1; ; pass++ {
+		changed := 0
+		for _, p := range params {
+			for _, v := range p.values {
+				if (*v < p.max && t.tryChange(v, 1, k, &best)) ||
+					(*v > p.min && t.tryChange(v, -1, k, &best)) {
+					changed++
+				}
+			}
+		}
+		fmt.Printf("Pass %d: %d parameters changed, error: %.6f\n", pass, changed, best)
+		if err := writeEvalFile(outPath); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if changed == 0 {
+			break
+		}
+	}
+	fmt.Printf("Tuned parameters written to %s\n", outPath)
+}
+
+type Tuner struct {
+	positions [][]TuningPosition // positions are divided evenly among the workers.
+	workers   []*Worker
+	scores    []int
+}
+
+func NewTuner(positions []TuningPosition, numCPU int) *Tuner {
+	numCPU = max(1, min(numCPU, len(positions)))
+	t := &Tuner{scores: make([]int, len(positions))}
+	size := (len(positions) + numCPU - 1) / numCPU
+	for i := 0; i < len(positions); i += size {
+		w := &Worker{ptt: NewPawnTT()}
+		chunk := positions[i:min(i+size, len(positions))]
+		for _, pos := range chunk {
+			pos.brd.worker = w
+		}
+		t.positions = append(t.positions, chunk)
+		t.workers = append(t.workers, w)
+	}
+	return t
+}
+
+// tryChange adds delta to the parameter v, and keeps the change only if it reduces the error.
+func (t *Tuner) tryChange(v *int, delta int, k float64, best *float64) bool {
+	*v += delta
+	if e := t.Error(k); e < *best {
+		*best = e
+		return true
+	}
+	*v -= delta
+	return false
+}
+
+// Evaluate scores every position from white's point of view, using the current parameters.
+func (t *Tuner) Evaluate() []int {
+	mirrorEval()
+	var wg sync.WaitGroup
+	offset := 0
+	for i, chunk := range t.positions {
+		wg.Add(1)
+		go func(w *Worker, chunk []TuningPosition, scores []int) {
+			defer wg.Done()
+			*w.ptt = PawnTT{} // cached pawn structure scores may be out of date.
+			for j, pos := range chunk {
+				setMaterial(pos.brd) // material includes the piece-square tables.
+				scores[j] = evaluate(pos.brd, -INF, INF)
+				if pos.brd.c == BLACK {
+					scores[j] = -scores[j]
+				}
+			}
+		}(t.workers[i], chunk, t.scores[offset:offset+len(chunk)])
+		offset += len(chunk)
+	}
+	wg.Wait()
+	return t.scores
+}
+
+// Error returns the mean squared difference between the game results and the expected scores.
+func (t *Tuner) Error(k float64) float64 {
+	return t.meanError(t.Evaluate(), k)
+}
+
+func (t *Tuner) meanError(scores []int, k float64) float64 {
+	var sum float64
+	i := 0
+	for _, chunk := range t.positions {
+		for _, pos := range chunk {
+			diff := pos.result - expectedScore(scores[i], k)
+			sum += diff * diff
+			i++
+		}
+	}
+	return sum / float64(max(1, i))
+}
+
+// FitK finds the scaling constant K minimizing the error for the current parameters, using a
+// ternary search.
+func (t *Tuner) FitK() float64 {
+	scores := t.Evaluate()
+	lo, hi := 0.0, 4.0
+	for i := 0; i < 50; i++ {
+		a, b := lo+(hi-lo)/3, hi-(hi-lo)/3
+		if t.meanError(scores, a) < t.meanError(scores, b) {
+			hi = b
+		} else {
+			lo = a
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// expectedScore maps a score in centipawns to the expected game result for white.
+func expectedScore(score int, k float64) float64 {
+	return 1 / (1 + math.Pow(10, -k*float64(score)/400))
+}
+
+// setMaterial recalculates the material balance of brd, including the piece-square tables.
+func setMaterial(brd *Board) {
+	var sq int
+	for c := BLACK; c <= WHITE; c++ {
+		for phase := MIDGAME; phase <= ENDGAME; phase++ {
+			material := 0
+			for pc := PAWN; pc <= KING; pc++ {
+				for b := brd.pieces[c][pc]; b > 0; b.Clear(sq) {
+					sq = lsb(b)
+					material += pieceValues[pc] + mainPst[c][phase][pc][sq]
+				}
+			}
+			brd.material[c][phase] = int16(material)
+		}
+	}
+}
+
+func loadTuningPositions(path string) ([]TuningPosition, error) {
+	if strings.HasSuffix(strings.ToLower(path), ".pgn") {
+		games, err := loadPgnFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return pgnTuningPositions(games), nil
+	}
+	epds, err := loadEpdFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var positions []TuningPosition
+	for i, epd := range epds {
+		result, ok := whiteResult(strings.Trim(epd.comments[9], "\";"))
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("%s position %d: missing game result (c9)", path, i+1))
+		}
+		positions = append(positions, TuningPosition{epd.brd, result})
+	}
+	return positions, nil
+}
+
+// pgnTuningPositions returns the quiet positions from the main line of each finished game.
+func pgnTuningPositions(games []*Game) []TuningPosition {
+	var positions []TuningPosition
+	for _, g := range games {
+		result, ok := whiteResult(g.Tag("Result"))
+		if !ok {
+			continue
+		}
+		brd := g.start.Copy()
+		for ply, m := range g.MainLine() {
+			makeMove(brd, m)
+			if ply+1 >= TUNE_MIN_PLY && isQuiet(brd) {
+				positions = append(positions, TuningPosition{brd.Copy(), result})
+			}
+		}
+	}
+	return positions
+}
+
+func whiteResult(result string) (float64, bool) {
+	switch result {
+	case "1-0":
+		return 1, true
+	case "0-1":
+		return 0, true
+	case "1/2-1/2":
+		return 0.5, true
+	default:
+		return 0, false
+	}
+}
+
+// isQuiet returns true if the side to move isn't in check, and has no promotions or winning
+// captures available.
+func isQuiet(brd *Board) bool {
+	if brd.InCheck() {
+		return false
+	}
+	for _, m := range brd.LegalMoves() {
+		if m.IsPromotion() || (m.IsCapture() && getSee(brd, m.From(), m.To(), m.CapturedPiece()) > 0) {
+			return false
+		}
+	}
+	return true
+}
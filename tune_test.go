@@ -0,0 +1,55 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import "testing"
+
+var tuningTestPositions = []struct {
+	fen    string
+	result float64
+}{
+	{"r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4", 0.5},
+	{"4k3/8/8/8/8/8/PPPP4/4K3 w - - 0 1", 1},
+	{"4k3/pppp4/8/8/8/8/8/4K3 b - - 0 1", 0},
+	{"2r3k1/5ppp/8/8/8/8/5PPP/6K1 w - - 0 1", 0},
+}
+
+func loadTuningTestPositions() []TuningPosition {
+	var positions []TuningPosition
+	for _, test := range tuningTestPositions {
+		positions = append(positions, TuningPosition{ParseFENString(test.fen), test.result})
+	}
+	return positions
+}
+
+func TestSetMaterial(t *testing.T) {
+	for _, test := range tuningTestPositions {
+		brd := ParseFENString(test.fen)
+		expected := brd.material
+		setMaterial(brd)
+		if brd.material != expected {
+			t.Errorf("Expected material %v, got %v for %s", expected, brd.material, test.fen)
+		}
+	}
+}
+
+func TestTunerError(t *testing.T) {
+	tuner := NewTuner(loadTuningTestPositions(), 2)
+	k := tuner.FitK()
+	if k <= 0 || k >= 4 {
+		t.Fatalf("Expected K between 0 and 4, got %.4f", k)
+	}
+	best := tuner.Error(k)
+	if best <= 0 || best >= 0.25 {
+		t.Errorf("Expected an error between 0 and 0.25, got %.6f", best)
+	}
+	// a change that makes the evaluation worse should be undone.
+	value := tempoBonus[MIDGAME]
+	tuner.tryChange(&tempoBonus[MIDGAME], 1000, k, &best)
+	if tempoBonus[MIDGAME] != value {
+		t.Errorf("Expected TempoBonusMidgame to be restored to %d, got %d", value, tempoBonus[MIDGAME])
+	}
+}
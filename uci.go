@@ -13,7 +13,9 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -26,34 +28,51 @@ import (
 
 // Info
 type Info struct {
-	score, depth, nodeCount int
-	t                       time.Duration // time elapsed
-	stk                     Stack
+	score, depth, selDepth int
+	nodeCount, tbHits      int
+	hashFull               int           // permille of the main TT used by the current search.
+	multiPV                int           // PV rank in multi-PV mode, or 0 if only a single PV is requested.
+	lowerBound, upperBound bool          // score is a bound, found by a search outside the aspiration window.
+	t                      time.Duration // time elapsed
+	pv                     *PV
 }
 
-// TODO: add proper error handling in UCI adapter.
+// Invalid input from the GUI is answered with an info string, and the engine keeps its last valid
+// state.
 type UCIAdapter struct {
-	brd    *Board
-	search *Search
-	wg     *sync.WaitGroup
-	result chan SearchResult
+	brd     *Board
+	history GameHistory // positions played prior to brd since the last irreversible move.
+	search  *Search
+	wg      *sync.WaitGroup
+	result  chan SearchResult
+	out     io.Writer
 
 	moveCounter int
-
-	optionPonder bool
-	optionDebug  bool
+	perftCancel chan bool // closed to abort a perft count in progress.
+	book        *Book
+
+	optionMultiPV    int
+	optionPonder     bool
+	optionDebug      bool
+	optionOwnBook    bool
+	optionBookRandom bool
+	optionBookFile   string
 }
 
 func NewUCIAdapter() *UCIAdapter {
 	return &UCIAdapter{
-		wg:     new(sync.WaitGroup),
-		result: make(chan SearchResult),
+		wg:               new(sync.WaitGroup),
+		result:           make(chan SearchResult, 1), // a finished ponder search never blocks.
+		out:              os.Stdout,
+		optionMultiPV:    1,
+		optionBookRandom: true,
+		optionBookFile:   DEFAULT_BOOK_FILE,
 	}
 }
 
 func (uci *UCIAdapter) Send(s string) { // log the UCI command s and print to standard I/O.
-	log.Printf("engine: " + s)
-	fmt.Print(s)
+	log.Print("engine: " + s)
+	fmt.Fprint(uci.out, s)
 }
 
 func (uci *UCIAdapter) BestMove(result SearchResult) {
@@ -61,13 +80,53 @@ func (uci *UCIAdapter) BestMove(result SearchResult) {
 		result.ponderMove.ToUCI()))
 }
 
+// QueueResult holds the result of a ponder search until it is requested by the GUI.
+func (uci *UCIAdapter) QueueResult(result SearchResult) {
+	uci.result <- result
+}
+
+func (uci *UCIAdapter) SearchFinished() {
+	uci.wg.Done()
+}
+
 // Printed to standard output at end of each non-trivial iterative deepening pass.
-// Score given in centipawns. Time given in milliseconds. PV given as list of moves.
-// Example: info score cp 13  depth 1 nodes 13 time 15 pv f1b5 h1h2
+// Score given in centipawns, or in moves to mate. Time given in milliseconds. PV given as list of moves.
+// Example: info score cp 13 depth 1 seldepth 3 nodes 13 nps 866 hashfull 0 tbhits 0 time 15 pv f1b5 h1h2
+// Example: info score mate -2 depth 6 seldepth 8 nodes 2941 nps 98033 hashfull 1 tbhits 0 time 30 pv f7f6 d1h5
+// In multi-PV mode, one line is sent per PV, prefixed by its rank:
+// Example: info multipv 2 score cp 9 depth 1 seldepth 2 nodes 13 nps 866 hashfull 0 tbhits 0 time 15 pv e2e4 e7e5
+// A score outside the aspiration window is followed by lowerbound or upperbound:
+// Example: info score cp 41 lowerbound depth 9 seldepth 21 nodes 129949 nps 1286623 hashfull 31 tbhits 0 time 101 pv e2e4
 func (uci *UCIAdapter) Info(info Info) {
 	nps := int64(float64(info.nodeCount) / info.t.Seconds())
-	uci.Send(fmt.Sprintf("info score cp %d depth %d nodes %d nps %d time %d pv %s\n", info.score,
-		info.depth, info.nodeCount, nps, int(info.t/time.Millisecond), info.stk[0].pv.ToUCI()))
+	var multiPV, bound string
+	if info.multiPV > 0 {
+		multiPV = fmt.Sprintf("multipv %d ", info.multiPV)
+	}
+	if info.lowerBound {
+		bound = "lowerbound "
+	} else if info.upperBound {
+		bound = "upperbound "
+	}
+	uci.Send(fmt.Sprintf("info %sscore %s %sdepth %d seldepth %d nodes %d nps %d hashfull %d tbhits %d time %d pv %s\n",
+		multiPV, uciScore(info.score), bound, info.depth, info.selDepth, info.nodeCount, nps, info.hashFull,
+		info.tbHits, int(info.t/time.Millisecond), info.pv.ToUCI()))
+}
+
+// Mate scores are given in moves rather than plies. A negative value means the engine is being mated.
+func uciScore(score int) string {
+	if score >= MIN_MATE && score <= MATE {
+		return fmt.Sprintf("mate %d", (MATE-score+1)/2)
+	} else if score <= -MIN_MATE && score >= -MATE {
+		return fmt.Sprintf("mate %d", -(MATE+score)/2)
+	}
+	return fmt.Sprintf("cp %d", score)
+}
+
+// Sent before each root move is searched, once the search has run for at least CURRMOVE_MIN.
+// Example: info depth 12 currmove e2e4 currmovenumber 1
+func (uci *UCIAdapter) CurrentMove(depth int, m Move, number int) {
+	uci.Send(fmt.Sprintf("info depth %d currmove %s currmovenumber %d\n", depth, m.ToUCI(), number))
 }
 
 func (uci *UCIAdapter) InfoString(s string) {
@@ -78,15 +137,11 @@ func (uci *UCIAdapter) Read(reader *bufio.Reader) {
 	var input string
 	var uciFields []string
 
-	f, err := os.OpenFile("./log.txt", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	f, dir, err := openLogFile()
 	if err != nil {
-		fmt.Printf("info string error opening file: %v\n", err)
+		fmt.Fprintf(uci.out, "info string error opening file: %v\n", err)
 	} else {
-		dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
-		if err != nil {
-			// log.Fatal(err)
-		}
-		fmt.Printf("info string log file created: %s\n", dir)
+		fmt.Fprintf(uci.out, "info string log file created: %s\n", dir)
 	}
 
 	defer f.Close()
@@ -95,7 +150,11 @@ func (uci *UCIAdapter) Read(reader *bufio.Reader) {
 	ponder := false
 
 	for {
-		input, _ = reader.ReadString('\n')
+		input, err = reader.ReadString('\n')
+		if err != nil && input == "" { // the GUI closed the input stream.
+			uci.stopSearch()
+			return
+		}
 		log.Println("gui: " + input)
 		uciFields = strings.Fields(input)
 
@@ -134,8 +193,7 @@ func (uci *UCIAdapter) Read(reader *bufio.Reader) {
 				// 	to wait for the engine to finish initializing.
 				// 	This command must always be answered with "readyok" and can be sent also when the engine is calculating
 				// 	in which case the engine should also immediately answer with "readyok" without stopping the search.
-			case "isready":
-				uci.wg.Wait()
+			case "isready": // answered immediately, even while searching.
 				uci.Send("readyok\n")
 				// * setoption name  [value ]
 				// 	this is sent to the engine when the user wants to change the internal parameters
@@ -152,7 +210,11 @@ func (uci *UCIAdapter) Read(reader *bufio.Reader) {
 				// 	   "setoption name NalimovPath value c:\chess\tb\4;c:\chess\tb\5\n"
 			case "setoption": // setoption name option_name
 				if len(uciFields) > 2 && uciFields[1] == "name" {
-					uci.setOption(uciFields[2:])
+					if err = uci.setOption(uciFields[2:]); err != nil {
+						uci.InfoString(err.Error() + "\n")
+					}
+				} else {
+					uci.invalid(uciFields)
 				}
 				uci.Send("readyok\n")
 				// * register
@@ -185,8 +247,11 @@ func (uci *UCIAdapter) Read(reader *bufio.Reader) {
 				//    As the engine's reaction to "ucinewgame" can take some time the GUI should always send "isready"
 				//    after "ucinewgame" to wait for the engine to finish its operation.
 			case "ucinewgame":
+				uci.stopSearch()
+				ponder = false
 				resetMainTt()
 				uci.brd = StartPos()
+				uci.history.Clear()
 				uci.Send("readyok\n")
 				// * position [fen  | startpos ]  moves  ....
 				// 	set up the position described in fenstring on the internal board and
@@ -195,30 +260,42 @@ func (uci *UCIAdapter) Read(reader *bufio.Reader) {
 				// 	Note: no "new" command is needed. However, if this position is from a different game than
 				// 	the last position sent to the engine, the GUI should have sent a "ucinewgame" inbetween.
 			case "position":
-				uci.wg.Wait()
-				uci.position(uciFields[1:])
+				uci.stopSearch()
+				ponder = false
+				if err = uci.position(uciFields[1:]); err != nil {
+					uci.InfoString(err.Error() + "\n")
+				}
 				uci.Send("readyok\n")
 				// * go
 				// 	start calculating on the current position set up with the "position" command.
 				// 	There are a number of commands that can follow this command, all will be sent in the same string.
 				// 	If one command is not send its value should be interpreted as it would not influence the search.
 			case "go":
-				if uci.brd != nil {
-					ponder = uci.start(uciFields[1:]) // parse any parameters given by GUI and begin searching.
-					if !uci.optionPonder || !ponder {
+				if uci.brd == nil {
+					uci.InfoString("You must set the current position via the position command before searching.\n")
+				} else if len(uciFields) > 1 && uciFields[1] == "perft" {
+					uci.stopSearch()
+					ponder = false
+					uci.perft(uciFields[2:]) // Not a UCI command. Used to verify move generation.
+				} else {
+					uci.stopSearch() // a new search may only be started once the previous one finishes.
+					// parse any parameters given by GUI and begin searching.
+					if ponder, err = uci.start(uciFields[1:]); err != nil {
+						uci.InfoString(err.Error() + "\n")
+					} else if !uci.optionPonder || !ponder {
 						uci.moveCounter++
 					}
-				} else {
-					uci.InfoString("You must set the current position via the position command before searching.\n")
 				}
 				// * stop
 				// 	stop calculating as soon as possible,
 				// 	don't forget the "bestmove" and possibly the "ponder" token when finishing the search
 			case "stop": // stop calculating and return a result as soon as possible.
+				uci.stopPerft()
 				if uci.search != nil {
 					uci.search.Abort()
 					if ponder {
 						uci.BestMove(<-uci.result)
+						ponder = false
 					}
 				}
 				// * ponderhit
@@ -228,13 +305,25 @@ func (uci *UCIAdapter) Read(reader *bufio.Reader) {
 				if uci.search != nil && ponder {
 					uci.search.gt.Start()
 					uci.BestMove(<-uci.result)
+					ponder = false
 				}
 				uci.moveCounter++
 			case "quit": // quit the program as soon as possible
+				uci.stopSearch()
 				return
 
+			case "eval": // Not a UCI command. Prints each term of the static evaluation from console.
+				if uci.brd != nil {
+					uci.Send(traceEval(uci.brd).String())
+				} else {
+					uci.InfoString("No position has been set.\n")
+				}
 			case "print": // Not a UCI command. Used to print the board for debugging from console
-				uci.brd.Print() // while in UCI mode.
+				if uci.brd != nil { // while in UCI mode.
+					uci.brd.Print()
+				} else {
+					uci.InfoString("No position has been set.\n")
+				}
 			default:
 				uci.invalid(uciFields)
 			}
@@ -254,7 +343,21 @@ func (uci *UCIAdapter) debug(uciFields []string) bool {
 }
 
 func (uci *UCIAdapter) invalid(uciFields []string) {
-	uci.InfoString("invalid command.\n")
+	uci.InfoString(fmt.Sprintf("invalid command: %s\n", strings.Join(uciFields, " ")))
+}
+
+// stopSearch aborts any search or perft count in progress and waits for it to finish. The result
+// of an aborted ponder search is discarded.
+func (uci *UCIAdapter) stopSearch() {
+	if uci.search != nil {
+		uci.search.Abort()
+	}
+	uci.stopPerft()
+	uci.wg.Wait()
+	select {
+	case <-uci.result:
+	default:
+	}
 }
 
 func (uci *UCIAdapter) identify() {
@@ -266,9 +369,26 @@ func (uci *UCIAdapter) identify() {
 
 func (uci *UCIAdapter) option() { // option name option_name [ parameters ]
 	// tells the GUI which parameters can be changed in the engine.
+	uci.Send(fmt.Sprintf("option name Hash type spin default %d min %d max %d\n", DEFAULT_HASH_MB,
+		MIN_HASH_MB, MAX_HASH_MB))
 	uci.Send("option name Ponder type check default false\n")
 	numCPU := runtime.NumCPU()
 	uci.Send(fmt.Sprintf("option name CPU type spin default %d min 1 max %d\n", numCPU, numCPU))
+	uci.Send(fmt.Sprintf("option name MultiPV type spin default 1 min 1 max %d\n", MAX_MULTI_PV))
+	uci.Send("option name OwnBook type check default false\n")
+	uci.Send(fmt.Sprintf("option name BookFile type string default %s\n", DEFAULT_BOOK_FILE))
+	uci.Send("option name BookRandom type check default true\n")
+	uci.Send("option name SyzygyPath type string default <empty>\n")
+	uci.Send("option name EvalFile type string default <empty>\n")
+	uci.Send("option name NNUEFile type string default <empty>\n")
+	uci.Send("option name EvalMode type combo default Classical var Classical var NNUE\n")
+	uci.Send("option name SearchMode type combo default YBWC var YBWC var LazySMP\n")
+	uci.Send("option name UCI_Chess960 type check default false\n")
+	uci.Send(fmt.Sprintf("option name Move Overhead type spin default %d min 0 max %d\n",
+		int(DEFAULT_MOVE_OVERHEAD/time.Millisecond), int(MAX_MOVE_OVERHEAD/time.Millisecond)))
+	for _, p := range tuningParams {
+		uci.Send(p.Option())
+	}
 }
 
 // some example options from Toga 1.3.1:
@@ -303,35 +423,203 @@ func (uci *UCIAdapter) option() { // option name option_name [ parameters ]
 // Engine: option name Toga King Safety Margin type spin default 1700 min 500 max 3000
 // Engine: option name Toga Extended History Pruning type check default false
 
-func (uci *UCIAdapter) setOption(uciFields []string) {
-	switch uciFields[0] {
+// setOption parses the fields following "setoption name", given as option_name [value x]. Both the
+// name and the value may contain spaces.
+func (uci *UCIAdapter) setOption(uciFields []string) error {
+	name, value := strings.Join(uciFields, " "), ""
+	for i, field := range uciFields {
+		if field == "value" {
+			name, value = strings.Join(uciFields[:i], " "), strings.Join(uciFields[i+1:], " ")
+			break
+		}
+	}
+	invalidValue := errors.New(fmt.Sprintf("invalid value for option %s: %s", name, value))
+	switch name {
+	// option name Hash type spin default DEFAULT_HASH_MB min MIN_HASH_MB max MAX_HASH_MB
+	case "Hash":
+		mb, err := strconv.Atoi(value)
+		if err != nil || mb < MIN_HASH_MB || mb > MAX_HASH_MB {
+			return invalidValue
+		}
+		uci.stopSearch() // make sure no search is using the current table before replacing it.
+		resizeMainTt(mb)
+		if uci.optionDebug {
+			uci.InfoString(fmt.Sprintf("main TT resized to %d MB\n", mb))
+		}
 	case "Ponder": // example: setoption name Ponder value true
-		if len(uciFields) == 3 {
-			switch uciFields[2] {
-			case "true":
-				uci.optionPonder = true
-			case "false":
-				uci.optionPonder = false
-			default:
-				uci.invalid(uciFields)
-			}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalidValue
 		}
+		uci.optionPonder = enabled
 		// option name CPU type spin default 0 min 1 max numCPU
 	case "CPU":
-		if len(uciFields) == 3 {
-			numCPU, err := strconv.Atoi(uciFields[2])
-			if err != nil {
-				uci.invalid(uciFields)
-				return
-			}
-			if numCPU > 0 && runtime.NumCPU() >= numCPU {
-				if uci.optionDebug {
-					uci.InfoString(fmt.Sprintf("setting up load balancer for %d CPU\n", numCPU))
-				}
-				setupLoadBalancer(numCPU)
-			}
+		numCPU, err := strconv.Atoi(value)
+		if err != nil || numCPU < 1 || numCPU > runtime.NumCPU() {
+			return invalidValue
+		}
+		uci.stopSearch() // workers can't be replaced while searching.
+		if uci.optionDebug {
+			uci.InfoString(fmt.Sprintf("setting up load balancer for %d CPU\n", numCPU))
+		}
+		setupLoadBalancer(numCPU)
+		// option name MultiPV type spin default 1 min 1 max MAX_MULTI_PV
+	case "MultiPV":
+		multiPV, err := strconv.Atoi(value)
+		if err != nil || multiPV < 1 || multiPV > MAX_MULTI_PV {
+			return invalidValue
+		}
+		uci.optionMultiPV = multiPV
+	case "OwnBook": // example: setoption name OwnBook value true
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalidValue
+		}
+		uci.optionOwnBook = enabled
+		if enabled {
+			uci.loadBook()
+		}
+		// option name BookFile type string default DEFAULT_BOOK_FILE
+	case "BookFile":
+		if value == "" {
+			return invalidValue
+		}
+		uci.optionBookFile = value
+		uci.book = nil
+		if uci.optionOwnBook {
+			uci.loadBook()
+		}
+		// option name SyzygyPath type string default <empty>
+	case "SyzygyPath": // directories containing tablebase files, separated by ':' (';' on Windows).
+		uci.stopSearch() // make sure no search is probing the current tables.
+		uci.InfoString(setTablebasePath(value))
+		// option name EvalFile type string default <empty>
+	case "EvalFile": // JSON file of evaluation parameters. <empty> restores the built-in values.
+		uci.stopSearch() // make sure no search is evaluating with the current parameters.
+		uci.InfoString(setEvalFile(value))
+		// option name NNUEFile type string default <empty>
+	case "NNUEFile": // network weights used when EvalMode is NNUE. <empty> unloads the network.
+		uci.stopSearch() // make sure no search is using the current network.
+		uci.InfoString(setNetworkPath(value))
+		// option name EvalMode type combo default Classical var Classical var NNUE
+	case "EvalMode":
+		mode, ok := parseEvalMode(value)
+		if !ok {
+			return invalidValue
+		}
+		if mode == EVAL_NNUE && network == nil {
+			return errors.New("EvalMode NNUE requires a network to be loaded with NNUEFile")
 		}
+		uci.stopSearch() // make sure the evaluation doesn't change mid-search.
+		evalMode = mode
+		// option name SearchMode type combo default YBWC var YBWC var LazySMP
+	case "SearchMode":
+		mode, ok := parseSearchMode(value)
+		if !ok {
+			return invalidValue
+		}
+		uci.stopSearch() // make sure the mode doesn't change mid-search.
+		searchMode = mode
+		// option name UCI_Chess960 type check default false
+	case "UCI_Chess960": // if true, castling moves are sent as the king capturing its own rook.
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalidValue
+		}
+		uci.stopSearch() // make sure moves sent by the current search use the same notation.
+		chess960 = enabled
+		// option name Move Overhead type spin default 10 min 0 max 5000
+	case "Move Overhead": // milliseconds lost to GUI and network latency on each move.
+		ms, err := strconv.Atoi(value)
+		if err != nil || ms < 0 || time.Duration(ms)*time.Millisecond > MAX_MOVE_OVERHEAD {
+			return invalidValue
+		}
+		moveOverhead = time.Duration(ms) * time.Millisecond
+	case "BookRandom": // if false, always play the book move with the highest weight.
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalidValue
+		}
+		uci.optionBookRandom = enabled
 	default:
+		p := findTuningParam(name)
+		if p == nil {
+			return errors.New(fmt.Sprintf("unknown option: %s", name))
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return invalidValue
+		}
+		uci.stopSearch() // parameters are only read by the search, so they can't change mid-search.
+		return p.Set(n)
+	}
+	return nil
+}
+
+func (uci *UCIAdapter) loadBook() {
+	if uci.book != nil {
+		return
+	}
+	book, err := LoadBook(uci.optionBookFile)
+	if err != nil {
+		uci.InfoString(err.Error() + "\n")
+		return
+	}
+	uci.book = book
+	if uci.optionDebug {
+		uci.InfoString(fmt.Sprintf("loaded %d book entries from %s\n", len(book.entries), uci.optionBookFile))
+	}
+}
+
+// Returns a book move for the current position, or NO_MOVE if the book shouldn't be used.
+func (uci *UCIAdapter) bookMove() Move {
+	if !uci.optionOwnBook || uci.book == nil {
+		return NO_MOVE
+	}
+	return uci.book.Move(uci.brd, uci.optionBookRandom)
+}
+
+// go perft <depth>
+// Prints the number of leaf nodes below each legal move, followed by the total.
+// Example: e2e4: 13160
+func (uci *UCIAdapter) perft(uciFields []string) {
+	if len(uciFields) == 0 {
+		uci.invalid(uciFields)
+		return
+	}
+	depth, err := strconv.Atoi(uciFields[0])
+	if err != nil || depth < 1 || depth > MAX_DEPTH {
+		uci.invalid(uciFields)
+		return
+	}
+	uci.wg.Wait()
+	cancel := make(chan bool)
+	uci.perftCancel = cancel
+	brd := uci.brd.Copy()
+	uci.wg.Add(1)
+	go func() { // count in the background, like a search, so that stop and quit are still read.
+		defer uci.wg.Done()
+		start := time.Now()
+		results := Divide(brd, depth, len(loadBalancer.workers), nil, cancel)
+		select {
+		case <-cancel:
+			uci.InfoString("perft stopped\n") // the counts are incomplete.
+			return
+		default:
+		}
+		for _, result := range results {
+			uci.Send(fmt.Sprintf("%s: %d\n", result.move.ToUCI(), result.count))
+		}
+		uci.Send(fmt.Sprintf("\nNodes searched: %d (%d ms)\n\n", results.Total(),
+			int(time.Since(start)/time.Millisecond)))
+	}()
+}
+
+// stopPerft aborts any perft count in progress without waiting for it to finish.
+func (uci *UCIAdapter) stopPerft() {
+	if uci.perftCancel != nil {
+		close(uci.perftCancel)
+		uci.perftCancel = nil
 	}
 }
 
@@ -347,24 +635,29 @@ func (uci *UCIAdapter) register(uciFields []string) {
 // 	start calculating on the current position set up with the "position" command.
 // 	There are a number of commands that can follow this command, all will be sent in the same string.
 // 	If one command is not send its value should be interpreted as it would not influence the search.
-func (uci *UCIAdapter) start(uciFields []string) bool {
-	var timeLimit int
+func (uci *UCIAdapter) start(uciFields []string) (bool, error) {
+	var nodeLimit, mateLimit int
 	maxDepth := MAX_DEPTH
 	gt := NewGameTimer(uci.moveCounter, uci.brd.c) // TODO: this will be inaccurate in pondering mode.
 	ponder := false
 	var allowedMoves []Move
+	infinite := false
 	for len(uciFields) > 0 {
-		// fmt.Println(uci_fields[0])
-		switch uciFields[0] {
+		param := uciFields[0]
+		uciFields = uciFields[1:]
+		switch param {
 
 		// 	* searchmoves  ....
 		// 		restrict search to this moves only
 		// 		Example: After "position startpos" and "go infinite searchmoves e2e4 d2d4"
 		// 		the engine should only search the two moves e2e4 and d2d4 in the initial position.
 		case "searchmoves":
-			uciFields = uciFields[1:]
 			for len(uciFields) > 0 && IsMove(uciFields[0]) {
-				allowedMoves = append(allowedMoves, ParseMove(uci.brd, uciFields[0]))
+				m, err := ParseMove(uci.brd, uciFields[0])
+				if err != nil {
+					return false, err
+				}
+				allowedMoves = append(allowedMoves, m)
 				uciFields = uciFields[1:]
 			}
 
@@ -373,101 +666,124 @@ func (uci *UCIAdapter) start(uciFields []string) bool {
 			if uci.optionPonder {
 				ponder = true
 			}
-			uciFields = uciFields[1:]
 
-		case "wtime": // white has x msec left on the clock
-			timeLimit, _ = strconv.Atoi(uciFields[1])
-			gt.remaining[WHITE] = time.Duration(timeLimit) * time.Millisecond
-			uciFields = uciFields[2:]
-
-		case "btime": // black has x msec left on the clock
-			timeLimit, _ = strconv.Atoi(uciFields[1])
-			gt.remaining[BLACK] = time.Duration(timeLimit) * time.Millisecond
-			uciFields = uciFields[2:]
-
-		case "winc": //	white increment per move in mseconds if x > 0
-			timeLimit, _ = strconv.Atoi(uciFields[1])
-			gt.inc[WHITE] = time.Duration(timeLimit) * time.Millisecond
-			uciFields = uciFields[2:]
-
-		case "binc": //	black increment per move in mseconds if x > 0
-			timeLimit, _ = strconv.Atoi(uciFields[1])
-			gt.inc[BLACK] = time.Duration(timeLimit) * time.Millisecond
-			uciFields = uciFields[2:]
-
-		// 	* movestogo: there are x moves to the next time control, this will only be sent if x > 0,
-		// 		if you don't get this and get the wtime and btime it's sudden death
-		case "movestogo":
-			remaining, _ := strconv.Atoi(uciFields[1])
-			gt.movesRemaining = remaining
-			uciFields = uciFields[2:]
-
-		case "depth": // search x plies only
-			maxDepth, _ = strconv.Atoi(uciFields[1])
-			uciFields = uciFields[2:]
-
-		case "nodes": // search x nodes only
-			uci.invalid(uciFields)
-			uciFields = uciFields[2:]
-
-		case "mate": // search for a mate in x moves
-			uci.invalid(uciFields)
-			uciFields = uciFields[2:]
-
-		case "movetime": // search exactly x mseconds
-			timeLimit, _ = strconv.Atoi(uciFields[1])
-			gt.SetMoveTime(time.Duration(timeLimit) * time.Millisecond)
-			uciFields = uciFields[2:]
 		// * infinite: search until the "stop" command. Do not exit the search without being
 		// told so in this mode!
 		case "infinite":
 			gt.SetMoveTime(MAX_TIME)
+			infinite = true
+
+		case "wtime", "btime", "winc", "binc", "movestogo", "depth", "nodes", "mate", "movetime":
+			if len(uciFields) == 0 {
+				return false, errors.New(fmt.Sprintf("missing value for go %s", param))
+			}
+			value, err := strconv.Atoi(uciFields[0])
+			if err != nil {
+				return false, errors.New(fmt.Sprintf("invalid value for go %s: %s", param, uciFields[0]))
+			}
 			uciFields = uciFields[1:]
+			t := time.Duration(max(0, value)) * time.Millisecond // the clock may have run out.
+			switch param {
+			case "wtime": // white has x msec left on the clock
+				gt.remaining[WHITE] = t
+			case "btime": // black has x msec left on the clock
+				gt.remaining[BLACK] = t
+			case "winc": //	white increment per move in mseconds if x > 0
+				gt.inc[WHITE] = t
+			case "binc": //	black increment per move in mseconds if x > 0
+				gt.inc[BLACK] = t
+			// 	* movestogo: there are x moves to the next time control, this will only be sent if x > 0,
+			// 		if you don't get this and get the wtime and btime it's sudden death
+			case "movestogo":
+				if value < 1 {
+					return false, errors.New(fmt.Sprintf("invalid value for go movestogo: %d", value))
+				}
+				gt.movesRemaining = value
+			case "depth": // search x plies only
+				if value < 1 {
+					return false, errors.New(fmt.Sprintf("invalid value for go depth: %d", value))
+				}
+				maxDepth = min(value, MAX_DEPTH)
+			case "nodes": // search x nodes only
+				nodeLimit = max(0, value)
+			case "mate": // search for a mate in x moves
+				mateLimit = max(0, value)
+			case "movetime": // search exactly x mseconds
+				gt.SetMoveTime(t)
+			}
 		default:
-			uciFields = uciFields[1:]
+		}
+	}
+	// book moves are only played when the GUI expects a move to be made.
+	if !ponder && !infinite && len(allowedMoves) == 0 && mateLimit == 0 {
+		if m := uci.bookMove(); m != NO_MOVE {
+			uci.search = nil
+			uci.BestMove(SearchResult{m, NO_MOVE})
+			return false, nil
 		}
 	}
 	uci.wg.Add(1)
 
 	// type SearchParams struct {
-	// 	max_depth         int
-	// 	verbose, ponder, restrict_search bool
+	// 	maxDepth, multiPV               int
+	// 	nodeLimit, mateLimit            int
+	// 	verbose, ponder, restrictSearch bool
 	// }
-	uci.search = NewSearch(SearchParams{maxDepth, uci.optionDebug, ponder, len(allowedMoves) > 0},
-		gt, uci, allowedMoves)
+	uci.search = NewSearch(SearchParams{maxDepth, uci.optionMultiPV, nodeLimit, mateLimit, uci.optionDebug,
+		ponder, len(allowedMoves) > 0}, gt, uci, allowedMoves, append(GameHistory(nil), uci.history...))
 	go uci.search.Start(uci.brd.Copy()) // starting the search also starts the clock
-	return ponder
+	return ponder, nil
 }
 
 // position [fen  | startpos ]  moves  ....
-func (uci *UCIAdapter) position(uciFields []string) {
-	if len(uciFields) == 0 {
-		uci.brd = StartPos()
-	} else if uciFields[0] == "startpos" {
-		uci.brd = StartPos()
-		uciFields = uciFields[1:]
-		if len(uciFields) > 1 && uciFields[0] == "moves" {
-			uci.playMoveSequence(uciFields[1:])
+// The current position is only replaced if the new position and all moves are valid.
+func (uci *UCIAdapter) position(uciFields []string) error {
+	var moves []string
+	for i, field := range uciFields {
+		if field == "moves" {
+			uciFields, moves = uciFields[:i], uciFields[i+1:]
+			break
 		}
+	}
+	var brd *Board
+	if len(uciFields) == 0 || uciFields[0] == "startpos" {
+		brd = StartPos()
 	} else if uciFields[0] == "fen" {
-		uci.brd = ParseFENSlice(uciFields[1:])
-		if len(uciFields) > 7 {
-			uci.playMoveSequence(uciFields[7:])
+		var err error
+		if brd, err = ParseFENSlice(uciFields[1:]); err != nil {
+			return err
 		}
 	} else {
-		uci.invalid(uciFields)
+		return errors.New(fmt.Sprintf("invalid position: %s", strings.Join(uciFields, " ")))
+	}
+	var history GameHistory // the game history is rebuilt from the move sequence given by the GUI.
+	if err := playMoveSequence(brd, &history, moves); err != nil {
+		return err
 	}
+	uci.brd, uci.history = brd, history
+	return nil
 }
 
-func (uci *UCIAdapter) playMoveSequence(uciFields []string) {
-	var move Move
-	if uciFields[0] == "moves" {
-		uciFields = uciFields[1:]
+func playMoveSequence(brd *Board, history *GameHistory, moves []string) error {
+	for _, moveStr := range moves {
+		move, err := ParseMove(brd, moveStr)
+		if err != nil {
+			return err
+		}
+		history.MakeMove(brd, move)
 	}
-	for _, moveStr := range uciFields {
-		move = ParseMove(uci.brd, moveStr)
-		makeMove(uci.brd, move)
+	return nil
+}
+
+// openLogFile opens the log file used to record communication with the GUI, and returns the
+// directory containing the engine executable.
+func openLogFile() (*os.File, string, error) {
+	f, err := os.OpenFile("./log.txt", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return f, "", err
 	}
+	dir, _ := filepath.Abs(filepath.Dir(os.Args[0]))
+	return f, dir, nil
 }
 
 func StartPos() *Board {
@@ -0,0 +1,178 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readUCI feeds the commands to a new UCI adapter and waits for it to reach the end of input.
+func readUCI(t *testing.T, uci *UCIAdapter, commands string) {
+	done := make(chan bool)
+	go func() {
+		uci.Read(bufio.NewReader(strings.NewReader(commands)))
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("UCI adapter did not finish reading commands:\n%s", commands)
+	}
+}
+
+func TestUCIInvalidInput(t *testing.T) {
+	var out bytes.Buffer
+	uci := NewUCIAdapter()
+	uci.out = &out
+	readUCI(t, uci, strings.Join([]string{
+		"print",
+		"go depth 1",
+		"position startpos moves e2e4",
+		"position startpos moves e2e4 e7e4",
+		"position startpos moves e2e4 e9e5",
+		"position fen rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBN w KQkq - 0 1",
+		"position fen 8/8/8/8/8/8/8/8 w - - 0 1",
+		"position sideways",
+		"go wtime",
+		"go depth x",
+		"go depth 0",
+		"go searchmoves e2e4",
+		"setoption name Hash value lots",
+		"setoption name Ponder value maybe",
+		"setoption name Nonexistent value 1",
+		"setoption",
+		"debug sometimes",
+		"xyzzy",
+	}, "\n")+"\n")
+	expected := StartPos()
+	makeMove(expected, mustParseMove(t, expected, "e2e4"))
+	if !CompareBoards(uci.brd, expected) {
+		t.Errorf("Expected the last valid position to be kept after invalid commands")
+	}
+	for _, str := range []string{
+		"No position has been set",
+		"You must set the current position",
+		"Illegal move: e7e4",
+		"Invalid move: e9e5",
+		"missing value for go wtime",
+		"invalid value for go depth: x",
+		"invalid value for option Hash: lots",
+		"unknown option: Nonexistent",
+		"invalid command: xyzzy",
+	} {
+		if !strings.Contains(out.String(), "info string "+str) {
+			t.Errorf("Expected output to contain \"info string %s\"", str)
+		}
+	}
+}
+
+var fuzzCommands = []string{
+	"uci", "isready", "ucinewgame", "stop", "ponderhit", "print", "debug on", "debug off", "quit",
+	"position", "position startpos", "position fen", "position moves", "go", "go perft", "go ponder",
+	"setoption name", "setoption name Ponder value", "setoption name MultiPV value",
+	"setoption name UCI_Chess960 value", "register later",
+}
+
+var fuzzArgs = []string{
+	"startpos", "fen", "moves", "e2e4", "e7e5", "g1f3", "a7a8q", "e1g1", "e1h1", "depth", "nodes",
+	"movetime", "wtime", "btime", "winc", "binc", "movestogo", "mate", "searchmoves", "ponder",
+	"value", "true", "false", "-1", "0", "1", "2", "x", "8/8/8/8/8/8/8/8", "rnbqkbnr/pppppppp/8/8",
+	"4k3/8/8/8/8/8/8/4K3", "w", "b", "KQkq", "-", "e3",
+}
+
+// The adapter should recover from any sequence of commands without panicking or hanging.
+func TestUCIFuzz(t *testing.T) {
+	defer func() { chess960 = false }()
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		var commands bytes.Buffer
+		for j := 0; j < 30; j++ {
+			commands.WriteString(fuzzCommands[r.Intn(len(fuzzCommands))])
+			for k := r.Intn(6); k > 0; k-- {
+				commands.WriteString(" " + fuzzArgs[r.Intn(len(fuzzArgs))])
+			}
+			if r.Intn(4) == 0 { // keep searches short.
+				commands.WriteString(fmt.Sprintf(" depth %d movetime %d", 1+r.Intn(2), r.Intn(50)))
+			}
+			commands.WriteString("\n")
+		}
+		uci := NewUCIAdapter()
+		uci.out = ioutil.Discard
+		readUCI(t, uci, commands.String())
+	}
+}
+
+func TestUCITuningOptions(t *testing.T) {
+	defer func(value int) { tempoBonus[MIDGAME] = value }(tempoBonus[MIDGAME])
+	var out bytes.Buffer
+	uci := NewUCIAdapter()
+	uci.out = &out
+	readUCI(t, uci, "setoption name TempoBonusMidgame value 12\n"+
+		"setoption name TempoBonusMidgame value 1000\n")
+	if tempoBonus[MIDGAME] != 12 {
+		t.Errorf("Expected TempoBonusMidgame to be 12, got %d", tempoBonus[MIDGAME])
+	}
+	if !strings.Contains(out.String(), "info string value for option TempoBonusMidgame must be between") {
+		t.Errorf("Expected an out of range value to be rejected")
+	}
+	if option := findTuningParam("TempoBonusMidgame").Option(); !strings.Contains(option, " default 5 ") {
+		t.Errorf("Expected the built-in default to be reported after setoption, got %s", option)
+	}
+}
+
+// Options named before the midgame/endgame split set both phases.
+func TestUCITuningOptionAlias(t *testing.T) {
+	defer func(values [2]int) { tempoBonus = values }(tempoBonus)
+	uci := NewUCIAdapter()
+	uci.out = ioutil.Discard
+	readUCI(t, uci, "setoption name TempoBonus value 17\n")
+	if tempoBonus[MIDGAME] != 17 || tempoBonus[ENDGAME] != 17 {
+		t.Errorf("Expected TempoBonus to set both phases to 17, got %v", tempoBonus)
+	}
+}
+
+// The clock starts on ponderhit while the search is running. Run with -race to check that the time
+// limits are published safely.
+func TestUCIPonderhit(t *testing.T) {
+	var out bytes.Buffer
+	uci := NewUCIAdapter()
+	uci.out = &out
+	readUCI(t, uci, "setoption name Ponder value true\n"+
+		"position fen r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4\n"+
+		"go ponder wtime 2000 btime 2000\n"+
+		"ponderhit\n")
+	if !strings.Contains(out.String(), "bestmove ") || strings.Contains(out.String(), "bestmove 0000") {
+		t.Errorf("Expected a best move after ponderhit")
+	}
+}
+
+// Perft runs in the background, so a deep count can be stopped like a search.
+func TestUCIPerft(t *testing.T) {
+	var out bytes.Buffer
+	uci := NewUCIAdapter()
+	uci.out = &out
+	readUCI(t, uci, "position startpos\n")
+	uci.perft([]string{"3"}) // the end of input would stop the count, so wait for it here.
+	uci.wg.Wait()
+	if !strings.Contains(out.String(), "Nodes searched: 8902 ") {
+		t.Errorf("Expected 8902 nodes at depth 3:\n%s", out.String())
+	}
+
+	for _, command := range []string{"stop", "quit", "go depth 1"} {
+		out.Reset()
+		readUCI(t, uci, "position startpos\ngo perft 10\n"+command+"\n")
+		if !strings.Contains(out.String(), "perft stopped") || strings.Contains(out.String(), "Nodes searched") {
+			t.Errorf("Expected %s to stop perft:\n%s", command, out.String())
+		}
+	}
+}
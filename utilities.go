@@ -16,7 +16,6 @@ func RunTestSuite(testSuite string, depth, timeout int) {
 		fmt.Println(err)
 		return
 	}
-	var moveStr string
 	sum, score := 0, 0
 	var gt *GameTimer
 	var search *Search
@@ -25,11 +24,10 @@ func RunTestSuite(testSuite string, depth, timeout int) {
 	for i, epd := range test {
 		gt = NewGameTimer(0, epd.brd.c)
 		gt.SetMoveTime(time.Duration(timeout) * time.Millisecond)
-		search = NewSearch(SearchParams{depth, false, false, false}, gt, nil, nil)
+		search = NewSearch(SearchParams{depth, 1, 0, 0, false, false, false}, gt, nil, nil, nil)
 		search.Start(epd.brd)
 
-		moveStr = ToSAN(epd.brd, search.bestMove)
-		if correctMove(epd, moveStr) {
+		if correctMove(epd, search.bestMove) {
 			score += 1
 			fmt.Printf("-")
 		} else {
@@ -45,16 +43,18 @@ func RunTestSuite(testSuite string, depth, timeout int) {
 	fmt.Printf("Total score: %d/%d\n", score, len(test))
 	fmt.Printf("Overhead: %.4fm\n", float64(loadBalancer.Overhead())/1000000.0)
 	fmt.Printf("Timeout: %.1fs\n", float64(timeout)/1000.0)
+	fmt.Printf("Search mode: %s\n", searchModeName(searchMode))
 }
 
-func correctMove(epd *EPD, moveStr string) bool {
+// correctMove returns true if m is one of the best moves for epd, and isn't a move to avoid.
+func correctMove(epd *EPD, m Move) bool {
 	for _, a := range epd.avoidMoves {
-		if moveStr == a {
+		if avoidMove, err := ParseSAN(epd.brd, a); err == nil && m == avoidMove {
 			return false
 		}
 	}
 	for _, b := range epd.bestMoves {
-		if moveStr == b {
+		if bestMove, err := ParseSAN(epd.brd, b); err == nil && m == bestMove {
 			return true
 		}
 	}
@@ -106,6 +106,10 @@ func CompareBoards(brd, other *Board) bool {
 		fmt.Println("Board.castle unequal")
 		equal = false
 	}
+	if brd.castleRooks != other.castleRooks {
+		fmt.Println("Board.castleRooks unequal")
+		equal = false
+	}
 	if brd.enpTarget != other.enpTarget {
 		fmt.Println("Board.enpTarget unequal")
 		equal = false
@@ -114,6 +118,10 @@ func CompareBoards(brd, other *Board) bool {
 		fmt.Println("Board.halfmoveClock unequal")
 		equal = false
 	}
+	if brd.fullmoveNumber != other.fullmoveNumber {
+		fmt.Println("Board.fullmoveNumber unequal")
+		equal = false
+	}
 	if brd.endgameCounter != other.endgameCounter {
 		fmt.Println("Board.endgameCounter unequal")
 		equal = false
@@ -124,7 +132,7 @@ func CompareBoards(brd, other *Board) bool {
 func isBoardConsistent(brd *Board) bool {
 	var squares [64]Piece
 	var occupied [2]BB
-	var material [2]int16
+	var material [2][2]int16
 
 	var sq int
 	for sq = 0; sq < 64; sq++ {
@@ -142,7 +150,8 @@ func isBoardConsistent(brd *Board) bool {
 
 			for bb := brd.pieces[c][pc]; bb > 0; bb.Clear(sq) {
 				sq = furthestForward(c, bb)
-				material[c] += int16(pc.Value() + mainPst[c][pc][sq])
+				material[c][MIDGAME] += int16(pc.Value() + mainPst[c][MIDGAME][pc][sq])
+				material[c][ENDGAME] += int16(pc.Value() + mainPst[c][ENDGAME][pc][sq])
 				if squares[sq] != EMPTY {
 					fmt.Printf("brd.pieces[%d][%d] overlaps with another pieces bitboard at %s.\n", c, pc, SquareString(sq))
 					consistent = false
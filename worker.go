@@ -8,6 +8,7 @@ package main
 import (
 	// "fmt"
 	"sync"
+	"sync/atomic"
 )
 
 // Each worker maintains a list of active split points for which it is responsible.
@@ -42,10 +43,23 @@ type Worker struct {
 	recycler  *Recycler
 	currentSp *SplitPoint
 
+	selDepth int32 // deepest ply reached by this worker during the current search.
+
 	mask  uint8
 	index uint8
 }
 
+// maxSelDepth returns the deepest ply reached by any worker during the current search.
+func maxSelDepth() int {
+	var d int32
+	for _, w := range loadBalancer.workers {
+		if wd := atomic.LoadInt32(&w.selDepth); wd > d {
+			d = wd
+		}
+	}
+	return int(d)
+}
+
 func (w *Worker) IsCancelled() bool {
 	for sp := w.currentSp; sp != nil; sp = sp.parent {
 		if sp.Cancel() {
@@ -0,0 +1,390 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+// This module implements communication over standard I/O using version 2 of the Chess Engine
+// Communication Protocol (CECP), also known as the XBoard or WinBoard protocol.  This allows the
+// engine to be used with GUIs that don't support UCI.
+
+// CECP specification:  https://www.gnu.org/software/xboard/engine-intf.html
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type XBoardAdapter struct {
+	startBrd *Board // position at which the current game began.
+	brd      *Board
+	moves    []Move // moves played since startBrd. Used to take back moves.
+	history  GameHistory
+	search   *Search
+	wg       *sync.WaitGroup
+	out      io.Writer
+
+	discard int32 // set atomically when the result of the current search should be ignored.
+
+	engineColor uint8
+	force       bool // engine plays neither color.
+	analyze     bool
+	post        bool // send thinking output.
+
+	movesPerSession          int // 0 indicates all remaining moves must be played in baseTime.
+	baseTime, increment      time.Duration
+	moveTime                 time.Duration // exact time per move set via 'st', or 0 if not set.
+	engineTime, opponentTime time.Duration
+	maxDepth                 int
+}
+
+func NewXBoardAdapter() *XBoardAdapter {
+	xb := &XBoardAdapter{
+		wg:          new(sync.WaitGroup),
+		out:         os.Stdout,
+		engineColor: BLACK,
+		maxDepth:    MAX_DEPTH,
+		baseTime:    MAX_TIME,
+	}
+	xb.engineTime, xb.opponentTime = xb.baseTime, xb.baseTime
+	xb.setBoard(StartPos())
+	return xb
+}
+
+func (xb *XBoardAdapter) Send(s string) { // log the command s and print to standard I/O.
+	log.Print("engine: " + s)
+	fmt.Fprint(xb.out, s)
+}
+
+// Thinking output is sent at the end of each iterative deepening pass when posting is enabled.
+// Score given in centipawns. Time given in centiseconds. PV given as list of moves.
+// Example: 9 16 29 129949 e2e4 e7e6 d2d4 d7d5 e4e5 d5e4 b1c3 d8g5 c1g5
+// Bounds found outside the aspiration window are not reported, since CECP has no way to mark them.
+func (xb *XBoardAdapter) Info(info Info) {
+	if xb.post && !info.lowerBound && !info.upperBound {
+		xb.Send(fmt.Sprintf("%d %d %d %d %s\n", info.depth, info.score, int(info.t/(10*time.Millisecond)),
+			info.nodeCount, info.pv.ToUCI()))
+	}
+}
+
+// CECP only reports the move being searched in response to the '.' command in analysis mode.
+func (xb *XBoardAdapter) CurrentMove(depth int, m Move, number int) {}
+
+// Lines beginning with '#' are ignored by the GUI, but are shown in its debug log.
+func (xb *XBoardAdapter) InfoString(s string) {
+	xb.Send("# " + s)
+}
+
+func (xb *XBoardAdapter) BestMove(result SearchResult) {
+	if xb.analyze || atomic.LoadInt32(&xb.discard) == 1 {
+		return
+	}
+	if result.bestMove.IsMove() {
+		xb.makeMove(result.bestMove)
+		xb.Send(fmt.Sprintf("move %s\n", result.bestMove.ToUCI()))
+	}
+	if result := xb.gameResult(); result != "" {
+		xb.Send(result + "\n")
+	}
+}
+
+// The engine never ponders in XBoard mode, so results are always sent immediately.
+func (xb *XBoardAdapter) QueueResult(result SearchResult) {
+	xb.BestMove(result)
+}
+
+func (xb *XBoardAdapter) SearchFinished() {
+	xb.wg.Done()
+}
+
+func (xb *XBoardAdapter) Read(reader *bufio.Reader) {
+	f, _, err := openLogFile()
+	if err != nil {
+		fmt.Fprintf(xb.out, "# error opening file: %v\n", err)
+	}
+	defer f.Close()
+	log.SetOutput(f)
+
+	for {
+		input, err := reader.ReadString('\n')
+		log.Println("gui: " + input)
+		fields := strings.Fields(input)
+		if len(fields) == 0 {
+			if err != nil { // GUI has closed the connection.
+				xb.stop(true)
+				return
+			}
+			continue
+		}
+		switch fields[0] {
+		case "xboard": // the engine is already in XBoard mode.
+		case "protover":
+			xb.Send(fmt.Sprintf("feature ping=1 setboard=1 playother=1 usermove=1 time=1 draw=0 sigint=0 "+
+				"sigterm=0 reuse=1 analyze=1 colors=0 name=0 egt=\"syzygy\" myname=\"GopherCheck %s\" done=1\n", version))
+		case "accepted", "rejected", "random", "hard", "easy", "computer", "name", "rating", "ics", ".":
+			// features and game information not used by the engine.
+		case "new": // reset the board and clocks, and play black.
+			xb.stop(true)
+			resetMainTt()
+			xb.setBoard(StartPos())
+			xb.force, xb.engineColor = false, BLACK
+			xb.maxDepth, xb.moveTime = MAX_DEPTH, 0
+			xb.engineTime, xb.opponentTime = xb.baseTime, xb.baseTime
+			if xb.analyze {
+				xb.think()
+			}
+		case "setboard":
+			xb.stop(true)
+			if brd, err := ParseFENSlice(fields[1:]); err != nil {
+				xb.Send(fmt.Sprintf("tellusererror Illegal position: %s\n", err))
+			} else {
+				xb.setBoard(brd)
+			}
+			if xb.analyze {
+				xb.think()
+			}
+		case "force": // stop playing either side.
+			xb.stop(true)
+			xb.force = true
+		case "go": // play the side to move, and start thinking.
+			xb.stop(true)
+			xb.force, xb.engineColor = false, xb.brd.c
+			xb.think()
+		case "playother": // play the side not on move.
+			xb.stop(true)
+			xb.force, xb.engineColor = false, xb.brd.Enemy()
+		case "usermove":
+			if len(fields) > 1 {
+				xb.userMove(fields[1])
+			}
+		case "?": // move now.
+			if xb.search != nil && !xb.analyze {
+				xb.search.Abort()
+			}
+		case "level": // level MPS BASE INC
+			if len(fields) == 4 {
+				xb.level(fields[1:])
+			}
+		case "st": // exact number of seconds per move.
+			if len(fields) > 1 {
+				xb.moveTime = parseSeconds(fields[1])
+			}
+		case "sd": // maximum search depth.
+			if len(fields) > 1 {
+				if depth, err := strconv.Atoi(fields[1]); err == nil && depth > 0 {
+					xb.maxDepth = depth
+				}
+			}
+		case "time": // time remaining on the engine's clock, in centiseconds.
+			if len(fields) > 1 {
+				xb.engineTime = parseCentiseconds(fields[1])
+			}
+		case "otim": // time remaining on the opponent's clock, in centiseconds.
+			if len(fields) > 1 {
+				xb.opponentTime = parseCentiseconds(fields[1])
+			}
+		case "analyze": // search the current position until told otherwise, without making a move.
+			xb.stop(true)
+			xb.analyze = true
+			xb.think()
+		case "exit": // leave analysis mode.
+			xb.stop(true)
+			xb.analyze = false
+		case "undo": // take back one move.
+			xb.takeBack(1)
+		case "remove": // take back one move for each side.
+			xb.takeBack(2)
+		case "post":
+			xb.post = true
+		case "nopost":
+			xb.post = false
+		case "result": // the game has ended.
+			xb.stop(true)
+			xb.force = true
+		case "egtpath": // egtpath syzygy PATH
+			if len(fields) > 2 && fields[1] == "syzygy" {
+				if xb.analyze {
+					xb.stop(true)
+				} else {
+					xb.wg.Wait() // make sure no search is probing the current tables.
+				}
+				xb.InfoString(setTablebasePath(strings.Join(fields[2:], " ")))
+				if xb.analyze {
+					xb.think()
+				}
+			}
+		case "ping":
+			if !xb.analyze {
+				xb.wg.Wait() // any move from the current search must be sent before replying.
+			}
+			if len(fields) > 1 {
+				xb.Send(fmt.Sprintf("pong %s\n", fields[1]))
+			}
+		case "quit":
+			xb.stop(true)
+			return
+		case "print": // Not an XBoard command. Used to print the board for debugging from console
+			xb.wg.Wait()
+			xb.brd.Print()
+		default:
+			if IsMove(fields[0]) { // moves may be sent without the usermove prefix.
+				xb.userMove(fields[0])
+			} else {
+				xb.Send(fmt.Sprintf("Error (unknown command): %s\n", fields[0]))
+			}
+		}
+	}
+}
+
+// stop aborts any search in progress and waits for it to finish. If discard is set, the engine
+// won't play the move found by the search.
+func (xb *XBoardAdapter) stop(discard bool) {
+	if xb.search != nil {
+		if discard {
+			atomic.StoreInt32(&xb.discard, 1)
+		}
+		xb.search.Abort()
+		xb.wg.Wait()
+	}
+}
+
+func (xb *XBoardAdapter) userMove(str string) {
+	xb.stop(true)
+	m, err := ParseMove(xb.brd, str)
+	if err != nil {
+		xb.Send(fmt.Sprintf("Illegal move: %s\n", str))
+		return
+	}
+	xb.makeMove(m)
+	if xb.analyze || (!xb.force && xb.brd.c == xb.engineColor) {
+		xb.think()
+	}
+}
+
+// think starts a search of the current position. In analysis mode, the search continues until
+// stopped by the GUI.
+func (xb *XBoardAdapter) think() {
+	if result := xb.gameResult(); result != "" {
+		if !xb.analyze {
+			xb.Send(result + "\n")
+		}
+		return
+	}
+	c := xb.brd.c
+	movesPlayed := len(xb.moves) / 2 // moves played by the side to move since the game began.
+	gt := NewGameTimer(movesPlayed, c)
+	if xb.analyze {
+		gt.SetMoveTime(MAX_TIME)
+	} else if xb.moveTime > 0 {
+		gt.SetMoveTime(xb.moveTime)
+	} else {
+		gt.remaining[c], gt.remaining[c^1] = xb.engineTime, xb.opponentTime
+		gt.inc = [2]time.Duration{xb.increment, xb.increment}
+		if xb.movesPerSession > 0 { // conventional time control
+			gt.movesRemaining = xb.movesPerSession - (movesPlayed % xb.movesPerSession)
+		}
+	}
+	atomic.StoreInt32(&xb.discard, 0)
+	xb.wg.Add(1)
+	xb.search = NewSearch(SearchParams{xb.maxDepth, 1, 0, 0, false, false, false}, gt, xb, nil,
+		append(GameHistory(nil), xb.history...))
+	go xb.search.Start(xb.brd.Copy()) // starting the search also starts the clock
+}
+
+// level MPS BASE INC
+// MPS is the number of moves per time control, or 0 for sudden death. BASE is given in minutes,
+// or as minutes:seconds. INC is the increment in seconds.
+func (xb *XBoardAdapter) level(fields []string) {
+	mps, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return
+	}
+	var base time.Duration
+	baseFields := strings.Split(fields[1], ":")
+	minutes, _ := strconv.Atoi(baseFields[0])
+	base = time.Duration(minutes) * time.Minute
+	if len(baseFields) > 1 {
+		seconds, _ := strconv.Atoi(baseFields[1])
+		base += time.Duration(seconds) * time.Second
+	}
+	xb.movesPerSession, xb.baseTime, xb.increment = mps, base, parseSeconds(fields[2])
+	xb.engineTime, xb.opponentTime = base, base
+	xb.moveTime = 0
+}
+
+func (xb *XBoardAdapter) setBoard(brd *Board) {
+	xb.startBrd = brd
+	xb.brd = brd.Copy()
+	xb.moves = xb.moves[:0]
+	xb.history.Clear()
+}
+
+func (xb *XBoardAdapter) makeMove(m Move) {
+	xb.moves = append(xb.moves, m)
+	xb.history.MakeMove(xb.brd, m)
+}
+
+// takeBack undoes the last n moves by replaying the game from its starting position.
+func (xb *XBoardAdapter) takeBack(n int) {
+	xb.stop(true)
+	if len(xb.moves) < n {
+		return
+	}
+	moves := xb.moves[:len(xb.moves)-n]
+	xb.brd = xb.startBrd.Copy()
+	xb.history.Clear()
+	xb.moves = nil
+	for _, m := range moves {
+		xb.makeMove(m)
+	}
+	if xb.analyze {
+		xb.think()
+	}
+}
+
+// gameResult returns the result command to send to the GUI if the game has ended, or an empty
+// string if the game is still in progress.
+func (xb *XBoardAdapter) gameResult() string {
+	brd := xb.brd
+	if len(brd.LegalMoves()) == 0 {
+		if !brd.InCheck() {
+			return "1/2-1/2 {Stalemate}"
+		} else if brd.c == WHITE {
+			return "0-1 {Black mates}"
+		} else {
+			return "1-0 {White mates}"
+		}
+	}
+	if brd.halfmoveClock >= 100 {
+		return "1/2-1/2 {50 move rule}"
+	}
+	repetitions := 0
+	for _, hashKey := range xb.history {
+		if hashKey == brd.hashKey {
+			repetitions++
+		}
+	}
+	if repetitions >= 2 {
+		return "1/2-1/2 {Draw by repetition}"
+	}
+	return ""
+}
+
+func parseSeconds(str string) time.Duration {
+	seconds, _ := strconv.ParseFloat(str, 64)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func parseCentiseconds(str string) time.Duration {
+	centiseconds, _ := strconv.Atoi(str)
+	return time.Duration(centiseconds) * 10 * time.Millisecond
+}
@@ -0,0 +1,80 @@
+//-----------------------------------------------------------------------------------
+// ♛ GopherCheck ♛
+// Copyright © 2014 Stephen J. Lovell
+//-----------------------------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readXBoard feeds the commands to the XBoard adapter and waits for it to reach the end of input.
+func readXBoard(t *testing.T, xb *XBoardAdapter, commands string) {
+	done := make(chan bool)
+	go func() {
+		xb.Read(bufio.NewReader(strings.NewReader(commands)))
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("XBoard adapter did not finish reading commands:\n%s", commands)
+	}
+}
+
+// expectInOrder checks that each string appears in out after the one before it.
+func expectInOrder(t *testing.T, out string, strs ...string) {
+	pos := 0
+	for _, str := range strs {
+		i := strings.Index(out[pos:], str)
+		if i < 0 {
+			t.Errorf("Expected %q after position %d of output:\n%s", str, pos, out)
+			return
+		}
+		pos += i + len(str)
+	}
+}
+
+func TestXBoardSession(t *testing.T) {
+	var out bytes.Buffer
+	xb := NewXBoardAdapter()
+	xb.out = &out
+	readXBoard(t, xb, strings.Join([]string{
+		"xboard",
+		"protover 2",
+		"level 40 5 0",
+		"time 1000",
+		"otim 2000",
+		"new",
+		"ping 1",
+	}, "\n")+"\n")
+	if xb.engineTime != 5*time.Minute || xb.opponentTime != 5*time.Minute {
+		t.Errorf("Expected new to reset both clocks to 5m, got %v and %v", xb.engineTime, xb.opponentTime)
+	}
+	expectInOrder(t, out.String(), "feature ", "done=1", "pong 1")
+
+	out.Reset()
+	readXBoard(t, xb, strings.Join([]string{
+		"sd 3",
+		"usermove e2e4", // the engine plays black, and replies to the move.
+		"ping 2",
+		"force",
+		"undo", // take back the engine's reply.
+		"ping 3",
+		"go",
+		"ping 4",
+		"usermove e9e5",
+	}, "\n")+"\n")
+	expectInOrder(t, out.String(), "move ", "pong 2", "pong 3", "move ", "pong 4", "Illegal move: e9e5")
+	if len(xb.moves) != 2 || xb.moves[0].ToUCI() != "e2e4" || xb.brd.c != WHITE {
+		t.Errorf("Expected e2e4 and a reply to have been played, got %d moves", len(xb.moves))
+	}
+	if strings.Count(out.String(), "move ") != 2 {
+		t.Errorf("Expected the engine to move once before and once after undo:\n%s", out.String())
+	}
+}